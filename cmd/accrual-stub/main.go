@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/caarlos0/env/v11"
+
+	"github.com/RIBorisov/gophermart/internal/accrualstub"
+	"github.com/RIBorisov/gophermart/internal/logger"
+)
+
+func main() {
+	log := &logger.Log{}
+	log.Initialize("DEBUG")
+
+	cfg := accrualstub.Config{}
+	if err := env.Parse(&cfg); err != nil {
+		log.Fatal("failed parse env", err)
+	}
+	flag.StringVar(&cfg.RunAddress, "a", cfg.RunAddress, "Host:port where server running")
+	flag.Parse()
+
+	if err := run(cfg, log); err != nil {
+		log.Fatal("failed run accrual stub", err)
+	}
+}
+
+func run(cfg accrualstub.Config, log *logger.Log) error {
+	const timeoutShutdown = time.Second * 5
+
+	ctx, cancelCtx := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancelCtx()
+
+	seed := uint64(time.Now().UnixNano())
+	stub, err := accrualstub.New(cfg, rand.New(rand.NewPCG(seed, seed)))
+	if err != nil {
+		return fmt.Errorf("failed create accrual stub: %w", err)
+	}
+
+	srv := &http.Server{Addr: cfg.RunAddress, Handler: stub.Handler(), ReadHeaderTimeout: timeoutShutdown}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), timeoutShutdown)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Err("failed make graceful shutdown", err)
+		}
+	}()
+
+	log.Info("starting accrual stub", "RUN_ADDRESS", cfg.RunAddress, "config", cfg)
+	if err = srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed listen and serve: %w", err)
+	}
+
+	return nil
+}
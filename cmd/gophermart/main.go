@@ -16,6 +16,7 @@ import (
 	"github.com/RIBorisov/gophermart/internal/external/accrual"
 	"github.com/RIBorisov/gophermart/internal/handlers"
 	"github.com/RIBorisov/gophermart/internal/logger"
+	"github.com/RIBorisov/gophermart/internal/models/orders"
 	"github.com/RIBorisov/gophermart/internal/service"
 	"github.com/RIBorisov/gophermart/internal/storage"
 )
@@ -40,7 +41,7 @@ func runApp(cfg *config.Config, log *logger.Log) error {
 
 	g, ctx := errgroup.WithContext(rootCtx)
 
-	store, err := storage.LoadStorage(ctx, cfg, log)
+	store, err := loadStore(ctx, cfg, log)
 	if err != nil {
 		return fmt.Errorf("failed load storage: %w", err)
 	}
@@ -51,27 +52,67 @@ func runApp(cfg *config.Config, log *logger.Log) error {
 		}
 	}()
 
-	svc := &service.Service{Log: log, Storage: store, Config: cfg}
+	keys, err := loadKeys(cfg, log)
+	if err != nil {
+		return fmt.Errorf("failed load jwt keys: %w", err)
+	}
+	if cfg.Auth.JWTKeysDir != "" {
+		g.Go(func() error {
+			reloadKeysOnHangup(ctx, cfg, log, keys)
+			log.Debug("closing reloadKeysOnHangup goroutine")
+			return nil
+		})
+	}
 
-	ordersCh := make(chan string)
+	policy, err := service.NewPolicy(cfg.Policy)
+	if err != nil {
+		return fmt.Errorf("failed load login and password policy: %w", err)
+	}
+
+	hasher, err := service.NewPasswordHasher(cfg.PasswordHash, cfg.Secret)
+	if err != nil {
+		return fmt.Errorf("failed configure password hashing: %w", err)
+	}
 
-	const (
-		workerNum       = 5
-		timeoutShutdown = time.Second * 5
+	breaker := accrual.NewBreaker(
+		accrual.NewHTTPClient(cfg.Service),
+		log,
+		cfg.Service.AccrualBreakerThreshold,
+		cfg.Service.AccrualBreakerCooldown,
 	)
+	svc := &service.Service{
+		Log:         log,
+		Storage:     store,
+		Accrual:     breaker,
+		Revocations: service.NewRevocationCache(cfg.Auth.RevocationCacheTTL),
+		Keys:        keys,
+		Notifier:    &service.LogNotifier{Log: log},
+		Policy:      policy,
+		LoginGuard:  service.NewLoginGuard(store, cfg.Auth),
+		Hasher:      hasher,
+		Config:      cfg,
+	}
 
-	for range workerNum {
-		g.Go(func() error {
-			for o := range ordersCh {
-				svc.Log.Info("incoming new order", "order_id", o)
-				if err = accrual.FetchAndUpdateOrders(ctx, svc, o); err != nil {
-					return fmt.Errorf("failed to process order: %w", err)
-				}
-			}
-			return nil
-		})
+	if err = svc.CheckLegacyPasswordHashes(ctx); err != nil {
+		return fmt.Errorf("failed check password hashes: %w", err)
 	}
 
+	// buffered, so the workers are able to gather claimed orders into batches
+	ordersCh := make(chan orders.Pending, cfg.Service.AccrualClaimBatchSize)
+
+	const timeoutShutdown = time.Second * 5
+
+	// limiter is shared by all workers, so the accrual system limits are honored by the whole process
+	limiter := accrual.NewLimiter(cfg.Service.AccrualRateLimit)
+	pool := accrual.NewPool(svc, limiter, ordersCh, cfg.Service.AccrualWorkers)
+	svc.Monitor = &accrual.Monitor{Breaker: breaker, Pool: pool}
+
+	g.Go(func() error {
+		pool.Run(ctx)
+		svc.Log.Debug("closing accrual workers", "stats", pool.Stats())
+		return nil
+	})
+
 	g.Go(func() error {
 		accrual.GetOrders(ctx, svc, ordersCh)
 		<-ctx.Done()
@@ -79,6 +120,14 @@ func runApp(cfg *config.Config, log *logger.Log) error {
 		return nil
 	})
 
+	if cfg.Service.LedgerReconcileInterval > 0 {
+		g.Go(func() error {
+			reconcileLedger(ctx, svc, cfg.Service.LedgerReconcileInterval)
+			svc.Log.Debug("closing reconcileLedger goroutine")
+			return nil
+		})
+	}
+
 	r := handlers.NewRouter(svc)
 
 	srv := &http.Server{
@@ -131,6 +180,65 @@ func runApp(cfg *config.Config, log *logger.Log) error {
 	return nil
 }
 
+// loadStore returns in-memory storage when DATABASE_URI is not provided, otherwise Postgres storage.
+func loadStore(ctx context.Context, cfg *config.Config, log *logger.Log) (service.Store, error) {
+	if cfg.Service.DatabaseDSN == "" {
+		log.Warn("DATABASE_URI is empty, using in-memory storage, data will be lost on shutdown")
+		return storage.NewMemory(), nil
+	}
+
+	return storage.LoadStorage(ctx, cfg, log)
+}
+
+// loadKeys reads the keys from JWT_KEYS_DIR, when it is not provided an ephemeral key is generated,
+// so tokens become invalid on restart and can't be verified by other instances.
+func loadKeys(cfg *config.Config, log *logger.Log) (*service.KeySet, error) {
+	if cfg.Auth.JWTKeysDir == "" {
+		log.Warn("JWT_KEYS_DIR is empty, using ephemeral signing key: tokens will be invalid after restart " +
+			"and rejected by other instances, so don't run more than one instance this way")
+		return service.NewEphemeralKeySet()
+	}
+
+	return service.LoadKeySet(cfg.Auth.JWTKeysDir, cfg.Auth.JWTSigningKID)
+}
+
+// reloadKeysOnHangup rereads the keys on SIGHUP, the old keys are kept when the new ones are broken.
+func reloadKeysOnHangup(ctx context.Context, cfg *config.Config, log *logger.Log, keys *service.KeySet) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := keys.Load(cfg.Auth.JWTKeysDir, cfg.Auth.JWTSigningKID); err != nil {
+				log.Err("failed reload jwt keys", err)
+				continue
+			}
+			log.Info("jwt keys reloaded", "dir", cfg.Auth.JWTKeysDir)
+		}
+	}
+}
+
+// reconcileLedger compares balances with the ledger on start and then every interval.
+func reconcileLedger(ctx context.Context, svc *service.Service, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := svc.ReconcileLedger(ctx); err != nil && ctx.Err() == nil {
+			svc.Log.Err("failed reconcile ledger", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 func enableGracefulShutdown(ctx context.Context, svc *service.Service, srv *http.Server) {
 	ctx, cancelCtx := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
 	defer cancelCtx()
@@ -0,0 +1,239 @@
+// Package accrualstub is a fake accrual system for local development and chaos testing of gophermart.
+package accrualstub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	accmodels "github.com/RIBorisov/gophermart/internal/models/accrual"
+	"github.com/RIBorisov/gophermart/internal/models/money"
+)
+
+type Config struct {
+	RunAddress string `env:"RUN_ADDRESS" envDefault:"localhost:8080"`
+	// Rules is a list of "prefix:reward" separated by ";", the longest matching prefix wins and
+	// orders matching no rule are not registered (204). Empty prefix matches all orders.
+	Rules string `env:"STUB_RULES" envDefault:":100"`
+	// ProcessingDelay is how long the order stays REGISTERED and PROCESSING before it becomes PROCESSED.
+	ProcessingDelay time.Duration `env:"STUB_PROCESSING_DELAY" envDefault:"5s"`
+	// InvalidRate is the probability the order is rated INVALID, it is decided once per order.
+	InvalidRate float64 `env:"STUB_INVALID_RATE" envDefault:"0"`
+	// UnregisteredRate and ErrorRate are the probabilities to respond with 204 and 500 to any request.
+	UnregisteredRate float64 `env:"STUB_UNREGISTERED_RATE" envDefault:"0"`
+	ErrorRate        float64 `env:"STUB_ERROR_RATE" envDefault:"0"`
+	// RateLimit is requests per minute, exceeded requests get 429 with Retry-After. Zero means no limit.
+	RateLimit int `env:"STUB_RATE_LIMIT" envDefault:"0"`
+}
+
+type rule struct {
+	prefix string
+	reward money.Amount
+}
+
+// parseRules parses Config.Rules, e.g. "7:729.98;5:10;:1".
+func parseRules(raw string) ([]rule, error) {
+	var rules []rule
+	for _, item := range strings.Split(raw, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		prefix, reward, ok := strings.Cut(item, ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", errInvalidRule, item)
+		}
+		amount, err := money.Parse(reward)
+		if err != nil || amount < 0 {
+			return nil, fmt.Errorf("%w: %q", errInvalidRule, item)
+		}
+		rules = append(rules, rule{prefix: strings.TrimSpace(prefix), reward: amount})
+	}
+
+	return rules, nil
+}
+
+type order struct {
+	registeredAt time.Time
+	invalid      bool
+}
+
+// Server serves accrual system API GET /api/orders/{orderID} and the batch lookup POST /api/orders/batch
+// accepting JSON array of order numbers. Orders are registered on the first request.
+type Server struct {
+	orders      map[string]*order
+	windowStart time.Time
+	// now is replaced in tests
+	now      func() time.Time
+	rnd      *rand.Rand
+	rules    []rule
+	cfg      Config
+	requests int
+	mu       sync.Mutex
+}
+
+// New creates Server, rnd drives the random behaviors, so they are reproducible with a seeded source.
+func New(cfg Config, rnd *rand.Rand) (*Server, error) {
+	rules, err := parseRules(cfg.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{orders: make(map[string]*order), now: time.Now, rnd: rnd, rules: rules, cfg: cfg}, nil
+}
+
+func (s *Server) Handler() http.Handler {
+	router := chi.NewRouter()
+	router.Get("/api/orders/{orderID}", s.orderInfo)
+	router.Post("/api/orders/batch", s.ordersInfo)
+
+	return router
+}
+
+// orderInfoResponse differs from accrual.OrderInfoResponse by omitting accrual of not processed orders.
+type orderInfoResponse struct {
+	Accrual *money.Amount    `json:"accrual,omitempty"`
+	Order   string           `json:"order"`
+	Status  accmodels.Status `json:"status"`
+}
+
+func (s *Server) orderInfo(w http.ResponseWriter, r *http.Request) {
+	orderNo := chi.URLParam(r, "orderID")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.serve(w) {
+		return
+	}
+	resp, ok := s.info(orderNo)
+	if !ok || s.rnd.Float64() < s.cfg.UnregisteredRate {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+	}
+}
+
+// ordersInfo responds with info of registered orders only.
+func (s *Server) ordersInfo(w http.ResponseWriter, r *http.Request) {
+	var orderNos []string
+	if err := json.NewDecoder(r.Body).Decode(&orderNos); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.serve(w) {
+		return
+	}
+	list := make([]orderInfoResponse, 0, len(orderNos))
+	for _, orderNo := range orderNos {
+		if resp, ok := s.info(orderNo); ok && s.rnd.Float64() >= s.cfg.UnregisteredRate {
+			list = append(list, resp)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+	}
+}
+
+// serve applies the rate limit and random failures, it returns false when the response has been written.
+func (s *Server) serve(w http.ResponseWriter) bool {
+	if retryAfter, ok := s.allow(); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = fmt.Fprintf(w, "No more than %d requests per minute allowed", s.cfg.RateLimit)
+		return false
+	}
+	if s.rnd.Float64() < s.cfg.ErrorRate {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return false
+	}
+
+	return true
+}
+
+// info registers the order on the first request and returns its current state,
+// it returns false for orders matching no reward rule.
+func (s *Server) info(orderNo string) (orderInfoResponse, bool) {
+	reward, ok := s.reward(orderNo)
+	if !ok {
+		return orderInfoResponse{}, false
+	}
+
+	o, ok := s.orders[orderNo]
+	if !ok {
+		o = &order{registeredAt: s.now(), invalid: s.rnd.Float64() < s.cfg.InvalidRate}
+		s.orders[orderNo] = o
+	}
+
+	resp := orderInfoResponse{Order: orderNo}
+	switch elapsed := s.now().Sub(o.registeredAt); {
+	case elapsed < s.cfg.ProcessingDelay/2:
+		resp.Status = accmodels.Registered
+	case elapsed < s.cfg.ProcessingDelay:
+		resp.Status = accmodels.Processing
+	case o.invalid:
+		resp.Status = accmodels.Invalid
+	default:
+		resp.Status = accmodels.Processed
+		resp.Accrual = &reward
+	}
+
+	return resp, true
+}
+
+// allow counts the request in a fixed one minute window, when the limit is exceeded
+// it returns time left until the window ends.
+func (s *Server) allow() (time.Duration, bool) {
+	if s.cfg.RateLimit <= 0 {
+		return 0, true
+	}
+
+	now := s.now()
+	if now.Sub(s.windowStart) >= time.Minute {
+		s.windowStart = now
+		s.requests = 0
+	}
+	if s.requests >= s.cfg.RateLimit {
+		return s.windowStart.Add(time.Minute).Sub(now), false
+	}
+	s.requests++
+
+	return 0, true
+}
+
+// reward returns reward of the longest rule prefix matching the order.
+func (s *Server) reward(orderNo string) (money.Amount, bool) {
+	var matched *rule
+	for i, r := range s.rules {
+		if strings.HasPrefix(orderNo, r.prefix) && (matched == nil || len(r.prefix) > len(matched.prefix)) {
+			matched = &s.rules[i]
+		}
+	}
+	if matched == nil {
+		return 0, false
+	}
+
+	return matched.reward, true
+}
+
+var errInvalidRule = errors.New("invalid reward rule, expected prefix:reward")
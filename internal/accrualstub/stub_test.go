@@ -0,0 +1,155 @@
+package accrualstub
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	accmodels "github.com/RIBorisov/gophermart/internal/models/accrual"
+	"github.com/RIBorisov/gophermart/internal/models/money"
+)
+
+func newTestServer(t *testing.T, cfg Config) (*Server, *time.Time) {
+	t.Helper()
+
+	srv, err := New(cfg, rand.New(rand.NewPCG(1, 1)))
+	require.NoError(t, err)
+	now := time.Now()
+	srv.now = func() time.Time { return now }
+
+	return srv, &now
+}
+
+func get(t *testing.T, h http.Handler, orderNo string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/orders/"+orderNo, http.NoBody)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    []rule
+		wantErr bool
+	}{
+		{name: "Positive #1", raw: "7:729.98; 5:10", want: []rule{
+			{prefix: "7", reward: money.FromFloat(729.98)},
+			{prefix: "5", reward: money.FromFloat(10)},
+		}},
+		{name: "Positive #2", raw: ":1;", want: []rule{{prefix: "", reward: money.FromFloat(1)}}},
+		{name: "Positive #3", raw: "", want: nil},
+		{name: "Negative #1", raw: "7", wantErr: true},
+		{name: "Negative #2", raw: "7:abc", wantErr: true},
+		{name: "Negative #3", raw: "7:-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRules(tt.raw)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, errInvalidRule)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestOrderLifecycle(t *testing.T) {
+	srv, now := newTestServer(t, Config{Rules: ":1;71:729.98;7:5", ProcessingDelay: 10 * time.Second})
+	h := srv.Handler()
+
+	wantStatuses := []struct {
+		after   time.Duration
+		status  accmodels.Status
+		accrual string
+	}{
+		{after: 0, status: accmodels.Registered},
+		{after: 5 * time.Second, status: accmodels.Processing},
+		{after: 5 * time.Second, status: accmodels.Processed, accrual: "729.98"},
+	}
+	for _, want := range wantStatuses {
+		*now = now.Add(want.after)
+
+		w := get(t, h, "7177570715")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var got map[string]any
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+		assert.Equal(t, "7177570715", got["order"])
+		assert.Equal(t, string(want.status), got["status"])
+		if want.accrual == "" {
+			assert.NotContains(t, got, "accrual")
+		} else {
+			assert.Equal(t, 729.98, got["accrual"])
+		}
+	}
+}
+
+func TestNotRegistered(t *testing.T) {
+	srv, _ := newTestServer(t, Config{Rules: "7:1"})
+
+	assert.Equal(t, http.StatusNoContent, get(t, srv.Handler(), "5116141762").Code)
+	assert.Equal(t, http.StatusOK, get(t, srv.Handler(), "7177570715").Code)
+}
+
+func TestInvalid(t *testing.T) {
+	srv, _ := newTestServer(t, Config{Rules: ":1", InvalidRate: 1})
+
+	var got orderInfoResponse
+	require.NoError(t, json.NewDecoder(get(t, srv.Handler(), "7177570715").Body).Decode(&got))
+	assert.Equal(t, accmodels.Status(accmodels.Invalid), got.Status)
+	assert.Nil(t, got.Accrual)
+}
+
+func TestChaos(t *testing.T) {
+	srv, _ := newTestServer(t, Config{Rules: ":1", ErrorRate: 1})
+	assert.Equal(t, http.StatusInternalServerError, get(t, srv.Handler(), "7177570715").Code)
+
+	srv, _ = newTestServer(t, Config{Rules: ":1", UnregisteredRate: 1})
+	assert.Equal(t, http.StatusNoContent, get(t, srv.Handler(), "7177570715").Code)
+}
+
+func TestRateLimit(t *testing.T) {
+	srv, now := newTestServer(t, Config{Rules: ":1", RateLimit: 2})
+	h := srv.Handler()
+
+	assert.Equal(t, http.StatusOK, get(t, h, "7177570715").Code)
+	*now = now.Add(15 * time.Second)
+	assert.Equal(t, http.StatusOK, get(t, h, "7177570715").Code)
+
+	w := get(t, h, "7177570715")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "45", w.Header().Get("Retry-After"))
+	assert.Equal(t, "No more than 2 requests per minute allowed", w.Body.String())
+
+	*now = now.Add(45 * time.Second)
+	assert.Equal(t, http.StatusOK, get(t, h, "7177570715").Code)
+}
+
+func TestBatch(t *testing.T) {
+	srv, _ := newTestServer(t, Config{Rules: "7:729.98"})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/orders/batch",
+		strings.NewReader(`["7177570715", "5116141762"]`))
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var got []orderInfoResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+	reward := money.FromFloat(729.98)
+	assert.Equal(t, []orderInfoResponse{{Order: "7177570715", Status: accmodels.Processed, Accrual: &reward}}, got)
+}
@@ -1,29 +1,137 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/caarlos0/env/v11"
+
+	"github.com/RIBorisov/gophermart/internal/models/money"
 )
 
 type Service struct {
-	RunAddress            string        `env:"RUN_ADDRESS" envDefault:"localhost:8089"`
-	AccrualSystemAddress  string        `env:"ACCRUAL_SYSTEM_ADDRESS" envDefault:"http://localhost:8080"`
-	AccrualOrderInfoRoute string        `env:"ACCRUAL_ORDER_INFO_ROUTE" envDefault:"/api/orders/{orderID}"`
-	DatabaseDSN           string        `env:"DATABASE_URI" envDefault:""`
-	AccrualPollInterval   time.Duration `env:"ACCRUAL_POLL_INTERVAL" envDefault:"10s"`
-	Timeout               time.Duration `env:"READ_TIMEOUT" envDefault:"5s"`
-	IdleTimeout           time.Duration `env:"IDLE_TIMEOUT" envDefault:"120s"`
+	RunAddress            string `env:"RUN_ADDRESS" envDefault:"localhost:8089"`
+	AccrualSystemAddress  string `env:"ACCRUAL_SYSTEM_ADDRESS" envDefault:"http://localhost:8080"`
+	AccrualOrderInfoRoute string `env:"ACCRUAL_ORDER_INFO_ROUTE" envDefault:"/api/orders/{orderID}"`
+	DatabaseDSN           string `env:"DATABASE_URI" envDefault:""`
+	// AccrualBatchRoute accepts JSON array of order numbers and responds with array of order info,
+	// batch lookup is disabled when it is empty.
+	AccrualBatchRoute       string        `env:"ACCRUAL_BATCH_ROUTE" envDefault:""`
+	AccrualBatchSize        int           `env:"ACCRUAL_BATCH_SIZE" envDefault:"50"`
+	AccrualRequestTimeout   time.Duration `env:"ACCRUAL_REQUEST_TIMEOUT" envDefault:"5s"`
+	AccrualRetryCount       int           `env:"ACCRUAL_RETRY_COUNT" envDefault:"2"`
+	AccrualPollInterval     time.Duration `env:"ACCRUAL_POLL_INTERVAL" envDefault:"10s"`
+	AccrualClaimLease       time.Duration `env:"ACCRUAL_CLAIM_LEASE" envDefault:"1m"`
+	AccrualClaimBatchSize   int           `env:"ACCRUAL_CLAIM_BATCH_SIZE" envDefault:"100"`
+	AccrualRateLimit        int           `env:"ACCRUAL_RATE_LIMIT" envDefault:"0"`
+	AccrualBackoffBase      time.Duration `env:"ACCRUAL_BACKOFF_BASE" envDefault:"10s"`
+	AccrualBackoffMax       time.Duration `env:"ACCRUAL_BACKOFF_MAX" envDefault:"10m"`
+	AccrualOrderMaxAge      time.Duration `env:"ACCRUAL_ORDER_MAX_AGE" envDefault:"24h"`
+	AccrualUnregisteredTTL  time.Duration `env:"ACCRUAL_UNREGISTERED_TTL" envDefault:"10m"`
+	AccrualMaxFailures      int           `env:"ACCRUAL_MAX_FAILURES" envDefault:"10"`
+	AccrualBreakerThreshold int           `env:"ACCRUAL_BREAKER_THRESHOLD" envDefault:"5"`
+	AccrualBreakerCooldown  time.Duration `env:"ACCRUAL_BREAKER_COOLDOWN" envDefault:"30s"`
+	AccrualWorkers          int           `env:"ACCRUAL_WORKERS" envDefault:"5"`
+	AccrualWebhookWindow    time.Duration `env:"ACCRUAL_WEBHOOK_WINDOW" envDefault:"5m"`
+	// LedgerReconcileInterval is how often balances are reconciled with the ledger, 0 disables it.
+	LedgerReconcileInterval time.Duration `env:"LEDGER_RECONCILE_INTERVAL" envDefault:"10m"`
+	// InstanceID identifies the instance among others sharing the database, setting it requires JWT_KEYS_DIR,
+	// so tokens issued by one instance are accepted by the others.
+	InstanceID  string        `env:"INSTANCE_ID" envDefault:""`
+	Timeout     time.Duration `env:"READ_TIMEOUT" envDefault:"5s"`
+	IdleTimeout time.Duration `env:"IDLE_TIMEOUT" envDefault:"120s"`
 }
 
 type Secret struct {
-	SecretKey string `env:"SECRET_KEY,unset" envDefault:"Qpm9^vmz13@ja"`
+	// SecretKey verifies password hashes made before versioned hashes, it has no default, so deployments
+	// having such hashes must set it.
+	SecretKey string `env:"SECRET_KEY,unset"`
+	// AccrualWebhookKey signs accrual callbacks, the callback endpoint is disabled when it is empty.
+	AccrualWebhookKey string `env:"ACCRUAL_WEBHOOK_KEY,unset" envDefault:""`
+	// MetricsToken is the bearer token of the metrics scraper, /metrics is disabled when it is empty.
+	MetricsToken string `env:"METRICS_TOKEN,unset" envDefault:""`
+	// PasswordPeppers are secrets mixed into password hashes by key id, e.g. "2024:secret1,2025:secret2".
+	// Keep every pepper some hash refers to, otherwise the passwords can't be verified.
+	PasswordPeppers map[string]string `env:"PASSWORD_PEPPERS,unset"`
+}
+
+type Auth struct {
+	AccessTokenTTL  time.Duration `env:"ACCESS_TOKEN_TTL" envDefault:"15m"`
+	RefreshTokenTTL time.Duration `env:"REFRESH_TOKEN_TTL" envDefault:"720h"`
+	// RevocationCacheTTL is how long a token found not revoked isn't checked in storage again, so
+	// a token revoked by another instance may be accepted by this one for that long.
+	RevocationCacheTTL time.Duration `env:"REVOCATION_CACHE_TTL" envDefault:"30s"`
+	// JWTKeysDir contains <kid>.pem private keys access tokens are signed with, an ephemeral key is used
+	// when it is empty, which is fit for a single instance only.
+	JWTKeysDir string `env:"JWT_KEYS_DIR" envDefault:""`
+	// JWTSigningKID picks the signing key, the key with the greatest kid is used when it is empty.
+	JWTSigningKID string `env:"JWT_SIGNING_KID" envDefault:""`
+	// CookieSecure marks the auth cookies to be sent over HTTPS only, disable it for local plain HTTP setups.
+	CookieSecure bool `env:"AUTH_COOKIE_SECURE" envDefault:"true"`
+	// PasswordResetTTL is how long the password reset token may be used.
+	PasswordResetTTL time.Duration `env:"PASSWORD_RESET_TTL" envDefault:"30m"`
+	// LoginMaxFailures failed logins in a row lock the login for LoginLockout, every failure before
+	// that postpones the next attempt by LoginDelayBase doubled with each failure. Failures are kept
+	// in the storage, so the limit is shared by all instances.
+	LoginMaxFailures int           `env:"LOGIN_MAX_FAILURES" envDefault:"5"`
+	LoginDelayBase   time.Duration `env:"LOGIN_DELAY_BASE" envDefault:"1s"`
+	LoginLockout     time.Duration `env:"LOGIN_LOCKOUT" envDefault:"15m"`
+	// LoginFailureWindow is how long a failure is remembered, attempts are counted from zero after it.
+	LoginFailureWindow time.Duration `env:"LOGIN_FAILURE_WINDOW" envDefault:"15m"`
+	// LoginIPMaxFailures failed logins of any logins from one address lock the address for LoginLockout.
+	LoginIPMaxFailures int `env:"LOGIN_IP_MAX_FAILURES" envDefault:"50"`
+	// TOTPIssuer names the service in authenticator apps.
+	TOTPIssuer string `env:"TOTP_ISSUER" envDefault:"Gophermart"`
+	// TwoFactorTokenTTL is how long the login with the password verified waits for the second factor.
+	TwoFactorTokenTTL time.Duration `env:"TWO_FACTOR_TOKEN_TTL" envDefault:"5m"`
+	// WithdrawTwoFactorThreshold is the greatest withdrawal made without the second factor,
+	// zero lets any withdrawal without it.
+	WithdrawTwoFactorThreshold money.Amount `env:"WITHDRAW_2FA_THRESHOLD" envDefault:"0"`
+}
+
+// Policy is what logins and passwords must look like, logins are trimmed and lowercased before the checks.
+type Policy struct {
+	LoginPattern      string `env:"LOGIN_PATTERN" envDefault:"^[a-z0-9][a-z0-9._@-]*$"`
+	LoginMinLength    int    `env:"LOGIN_MIN_LENGTH" envDefault:"3"`
+	LoginMaxLength    int    `env:"LOGIN_MAX_LENGTH" envDefault:"64"`
+	PasswordMinLength int    `env:"PASSWORD_MIN_LENGTH" envDefault:"8"`
+	PasswordMaxLength int    `env:"PASSWORD_MAX_LENGTH" envDefault:"64"`
+	// PasswordDenyListFile contains common and breached passwords one per line, which are rejected
+	// case-insensitively. Lines starting with # are ignored.
+	PasswordDenyListFile string `env:"PASSWORD_DENY_LIST_FILE" envDefault:""`
+}
+
+// PasswordHash is how new password hashes are made, hashes made otherwise are upgraded on login.
+type PasswordHash struct {
+	// Algorithm is either argon2id or bcrypt.
+	Algorithm string `env:"PASSWORD_HASH_ALGORITHM" envDefault:"argon2id"`
+	// PepperKID is the key id of PasswordPeppers used for new hashes, no pepper is used when it is empty.
+	PepperKID string `env:"PASSWORD_PEPPER_KID" envDefault:""`
+	// Argon2Memory is in KiB.
+	Argon2Memory  uint32 `env:"ARGON2_MEMORY" envDefault:"19456"`
+	Argon2Time    uint32 `env:"ARGON2_TIME" envDefault:"2"`
+	Argon2Threads uint8  `env:"ARGON2_THREADS" envDefault:"1"`
+	BcryptCost    int    `env:"BCRYPT_COST" envDefault:"10"`
 }
 
 type Config struct {
-	Secret  Secret
-	Service Service
+	Secret       Secret
+	Auth         Auth
+	Policy       Policy
+	PasswordHash PasswordHash
+	Service      Service
+}
+
+// defaultInstanceID identifies running process among other gophermart instances, e.g. in order leases.
+func defaultInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "gophermart"
+	}
+
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
 }
 
 func LoadConfig() (*Config, error) {
@@ -42,6 +150,12 @@ func LoadConfig() (*Config, error) {
 	if flags.DatabaseDSN != "" {
 		cfg.Service.DatabaseDSN = flags.DatabaseDSN
 	}
+	if cfg.Service.InstanceID == "" {
+		cfg.Service.InstanceID = defaultInstanceID()
+	} else if cfg.Auth.JWTKeysDir == "" {
+		// every instance would sign tokens with its own ephemeral key rejected by the others
+		return nil, errors.New("JWT_KEYS_DIR is required when INSTANCE_ID is set")
+	}
 
 	return cfg, nil
 }
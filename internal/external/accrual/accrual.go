@@ -4,15 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"sync"
 	"time"
 
-	"github.com/go-resty/resty/v2"
-
+	accmodels "github.com/RIBorisov/gophermart/internal/models/accrual"
+	"github.com/RIBorisov/gophermart/internal/models/orders"
 	"github.com/RIBorisov/gophermart/internal/service"
+	"github.com/RIBorisov/gophermart/internal/storage"
 )
 
-func GetOrders(ctx context.Context, svc *service.Service, ordersCh chan<- string) {
+func GetOrders(ctx context.Context, svc *service.Service, ordersCh chan<- orders.Pending) {
 	ticker := time.NewTicker(svc.Config.Service.AccrualPollInterval)
 	for {
 		select {
@@ -28,7 +28,12 @@ func GetOrders(ctx context.Context, svc *service.Service, ordersCh chan<- string
 			if len(oList) > 0 {
 				svc.Log.Info("got order ids for processing", "count", len(oList))
 				for _, o := range oList {
-					ordersCh <- o
+					select {
+					case <-ctx.Done():
+						close(ordersCh)
+						return
+					case ordersCh <- o:
+					}
 				}
 			} else {
 				svc.Log.Info("not found orders for processing in db")
@@ -37,53 +42,143 @@ func GetOrders(ctx context.Context, svc *service.Service, ordersCh chan<- string
 	}
 }
 
-type retryCtrl struct {
-	retry bool
-	wait  time.Duration
-	mu    sync.Mutex
+// FetchAndUpdateOrders fetches accrual info of the order and saves it. Every request waits for the limiter
+// shared by all workers, so Retry-After and the limit reported by the accrual system are honored globally.
+func FetchAndUpdateOrders(ctx context.Context, svc *service.Service, limiter *Limiter, order orders.Pending) error {
+	for {
+		if err := limiter.Wait(ctx); err != nil {
+			return fmt.Errorf("failed wait for accrual rate limiter: %w", err)
+		}
+		svc.Log.Info("starting process order", "order_id", order.Number)
+
+		data, fetchErr := svc.FetchOrderInfo(ctx, order.Number)
+		if throttled(svc, limiter, fetchErr) {
+			continue
+		}
+
+		return applyOrderInfo(ctx, svc, &order, data, fetchErr)
+	}
 }
 
-func FetchAndUpdateOrders(ctx context.Context, svc *service.Service, orderID string) error {
-	retry := &retryCtrl{}
-	client := resty.New().SetBaseURL(svc.Config.Service.AccrualSystemAddress)
+// FetchOrdersInfo fetches accrual info of the batch with one request waiting for the limiter like
+// FetchAndUpdateOrders does. service.ErrBatchUnsupported is returned when batch lookup is unavailable.
+func FetchOrdersInfo(
+	ctx context.Context,
+	svc *service.Service,
+	limiter *Limiter,
+	batch []orders.Pending,
+) (map[string]*accmodels.OrderInfoResponse, error) {
+	if !svc.BatchSupported() {
+		return nil, service.ErrBatchUnsupported
+	}
+
+	orderNos := make([]string, 0, len(batch))
+	for _, o := range batch {
+		orderNos = append(orderNos, o.Number)
+	}
 	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			if retry.retry {
-				svc.Log.Info("Waiting for retry", "seconds", retry.wait)
-				time.Sleep(retry.wait)
-				retry.mu.Lock()
-				retry.wait = 0 * time.Second
-				retry.retry = false
-				retry.mu.Unlock()
-			}
-			svc.Log.Info("starting process order", "order_id", orderID)
-			data, fetchErr := svc.FetchOrderInfo(ctx, client, orderID)
-			if fetchErr != nil {
-				var errToManyRequests *service.ToManyRequestsError
-				if errors.As(fetchErr, &errToManyRequests) {
-					retry.mu.Lock()
-					retry.retry = true
-					retry.wait = errToManyRequests.RetryAfter
-					retry.mu.Unlock()
-					continue
-				} else {
-					return fmt.Errorf("failed fetch order info: %w", fetchErr)
-				}
-			}
+		if err := limiter.Wait(ctx); err != nil {
+			return nil, fmt.Errorf("failed wait for accrual rate limiter: %w", err)
+		}
+		svc.Log.Info("starting process orders batch", "count", len(orderNos))
 
-			if data == nil {
-				svc.Log.Info("not found orders for processing in accrual service")
-				continue
-			}
-			if err := svc.UpdateOrder(ctx, data); err != nil {
-				return fmt.Errorf("failed update order: %w", err)
-			}
+		infos, err := svc.FetchOrdersInfo(ctx, orderNos)
+		if throttled(svc, limiter, err) {
+			continue
+		}
+
+		return infos, err
+	}
+}
+
+// UpdateBatchOrder saves the order info from FetchOrdersInfo result, the order missing in it is not registered.
+// When the batch request failed, fetchErr is applied to every order of the batch.
+func UpdateBatchOrder(
+	ctx context.Context,
+	svc *service.Service,
+	order orders.Pending,
+	infos map[string]*accmodels.OrderInfoResponse,
+	fetchErr error,
+) error {
+	if fetchErr != nil {
+		return applyOrderInfo(ctx, svc, &order, nil, fetchErr)
+	}
+
+	data, ok := infos[order.Number]
+	if !ok {
+		return applyOrderInfo(ctx, svc, &order, nil, service.ErrOrderNotRegistered)
+	}
+
+	return applyOrderInfo(ctx, svc, &order, data, nil)
+}
+
+// throttled pauses the limiter when the accrual system reported too many requests and adopts its limit,
+// or when the circuit breaker is open, so all workers back off together. It returns true when
+// the request should be repeated.
+func throttled(svc *service.Service, limiter *Limiter, err error) bool {
+	var (
+		errToManyRequests *service.ToManyRequestsError
+		errCircuitOpen    *service.CircuitOpenError
+	)
+	switch {
+	case errors.As(err, &errToManyRequests):
+		svc.Log.Info("pausing accrual requests", "seconds", errToManyRequests.RetryAfter)
+		limiter.Pause(errToManyRequests.RetryAfter)
+		if errToManyRequests.Limit > 0 {
+			limiter.SetRate(errToManyRequests.Limit)
 		}
-		break
+	case errors.As(err, &errCircuitOpen):
+		svc.Log.Debug("accrual circuit breaker is open, pausing accrual requests", "seconds", errCircuitOpen.RetryAfter)
+		limiter.Pause(errCircuitOpen.RetryAfter)
+	default:
+		return false
+	}
+
+	return true
+}
+
+// applyOrderInfo saves result of the accrual request. Orders unknown to the accrual system follow
+// service.HandleUnregisteredOrder policy and orders which got accrual system error are postponed with backoff.
+func applyOrderInfo(
+	ctx context.Context,
+	svc *service.Service,
+	order *orders.Pending,
+	data *accmodels.OrderInfoResponse,
+	fetchErr error,
+) error {
+	var errServer *service.AccrualServerError
+	switch {
+	case fetchErr == nil:
+		return skipStaleUpdate(svc, svc.UpdateOrder(ctx, order, data))
+	case errors.Is(fetchErr, service.ErrOrderNotRegistered):
+		return skipStaleUpdate(svc, svc.HandleUnregisteredOrder(ctx, order))
+	case errors.As(fetchErr, &errServer):
+		svc.Log.Warn("accrual system failed, postponing order",
+			"order_id", order.Number, "status", errServer.StatusCode)
+		return skipStaleUpdate(svc, svc.PostponeOrder(ctx, order))
+	default:
+		return fmt.Errorf("failed fetch order info: %w", fetchErr)
+	}
+}
+
+// skipStaleUpdate logs storage.TransitionError instead of returning it: the order has been
+// already moved into terminal status, e.g. by another response, so there is nothing to retry.
+// storage.ErrLeaseLost is skipped the same way, the order is processed by the instance holding the lease.
+func skipStaleUpdate(svc *service.Service, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, storage.ErrLeaseLost) {
+		svc.Log.Warn("order lease lost, skipping update", "err", err)
+		return nil
+	}
+
+	var errTransition *storage.TransitionError
+	if !errors.As(err, &errTransition) {
+		return fmt.Errorf("failed update order: %w", err)
 	}
+	svc.Log.Warn("rejected illegal order status transition",
+		"order_id", errTransition.Number, "from", errTransition.From, "to", errTransition.To)
 
 	return nil
 }
@@ -0,0 +1,123 @@
+package accrual
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RIBorisov/gophermart/internal/config"
+	"github.com/RIBorisov/gophermart/internal/logger"
+	"github.com/RIBorisov/gophermart/internal/models"
+	accmodels "github.com/RIBorisov/gophermart/internal/models/accrual"
+	"github.com/RIBorisov/gophermart/internal/models/money"
+	"github.com/RIBorisov/gophermart/internal/models/orders"
+	"github.com/RIBorisov/gophermart/internal/models/register"
+	"github.com/RIBorisov/gophermart/internal/service"
+	"github.com/RIBorisov/gophermart/internal/storage"
+)
+
+func TestFetchAndUpdateOrders(t *testing.T) {
+	const orderNo = "7177570715"
+	log := &logger.Log{}
+	log.Initialize("DEBUG")
+
+	var (
+		processing = FakeResponse{Info: &accmodels.OrderInfoResponse{Status: accmodels.Processing}}
+		processed  = FakeResponse{Info: &accmodels.OrderInfoResponse{Status: accmodels.Processed, Accrual: 72998}}
+		throttled  = FakeResponse{Err: &service.ToManyRequestsError{RetryAfter: 10 * time.Millisecond}}
+	)
+	tests := []struct {
+		name        string
+		script      []FakeResponse
+		runs        int
+		wantCalls   int
+		wantStatus  orders.Status
+		wantBalance money.Amount
+	}{
+		{
+			name:        "Processed",
+			script:      []FakeResponse{processed},
+			runs:        1,
+			wantCalls:   1,
+			wantStatus:  orders.Processed,
+			wantBalance: money.FromFloat(729.98),
+		},
+		{
+			name:       "Processing is postponed",
+			script:     []FakeResponse{processing},
+			runs:       1,
+			wantCalls:  1,
+			wantStatus: orders.Processing,
+		},
+		{
+			name:        "Retried after too many requests",
+			script:      []FakeResponse{throttled, processed},
+			runs:        1,
+			wantCalls:   2,
+			wantStatus:  orders.Processed,
+			wantBalance: money.FromFloat(729.98),
+		},
+		{
+			name:       "Unregistered is postponed",
+			script:     nil,
+			runs:       1,
+			wantCalls:  1,
+			wantStatus: orders.New,
+		},
+		{
+			name:        "Processed twice is credited once",
+			script:      []FakeResponse{processed},
+			runs:        2,
+			wantCalls:   2,
+			wantStatus:  orders.Processed,
+			wantBalance: money.FromFloat(729.98),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := storage.NewMemory()
+			userID, err := mem.SaveUser(context.Background(), &register.Request{Login: "Vasiliy", Password: "pwd"})
+			require.NoError(t, err)
+			ctx := context.WithValue(context.Background(), models.CtxUserIDKey, userID)
+			require.NoError(t, mem.SaveOrder(ctx, orderNo))
+
+			client := NewFakeClient().Script(orderNo, tt.script...)
+			svc := &service.Service{Log: log, Storage: mem, Accrual: client, Config: &config.Config{
+				Service: config.Service{
+					AccrualBackoffBase:     time.Minute,
+					AccrualBackoffMax:      time.Hour,
+					AccrualOrderMaxAge:     time.Hour,
+					AccrualUnregisteredTTL: time.Hour,
+				},
+			}}
+
+			lease := &orders.Lease{Owner: "test", Duration: time.Minute, BatchSize: 10}
+			claimed, err := mem.GetOrdersList(ctx, lease)
+			require.NoError(t, err)
+			require.Len(t, claimed, 1)
+
+			limiter := NewLimiter(0)
+			for range tt.runs {
+				require.NoError(t, FetchAndUpdateOrders(ctx, svc, limiter, claimed[0]))
+			}
+			assert.Equal(t, tt.wantCalls, client.Calls(orderNo))
+
+			oList, err := mem.GetUserOrders(ctx)
+			require.NoError(t, err)
+			require.Len(t, oList, 1)
+			assert.Equal(t, tt.wantStatus, oList[0].Status)
+
+			b, err := mem.GetBalance(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantBalance, b.Current)
+
+			// finished and postponed orders are not due for polling
+			left, err := mem.GetOrdersList(ctx, lease)
+			require.NoError(t, err)
+			assert.Empty(t, left)
+		})
+	}
+}
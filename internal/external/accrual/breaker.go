@@ -0,0 +1,157 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/RIBorisov/gophermart/internal/logger"
+	accmodels "github.com/RIBorisov/gophermart/internal/models/accrual"
+	"github.com/RIBorisov/gophermart/internal/service"
+)
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// Breaker is a circuit breaker around service.AccrualClient. After threshold failures in a row it opens
+// and rejects requests with *service.CircuitOpenError for the cool-down, then lets a single probe request
+// through: the probe success closes the breaker and its failure opens it again.
+//
+// Responses which are the part of accrual system contract (not registered order, too many requests)
+// are successful, while cancelled requests don't change the state.
+type Breaker struct {
+	openedAt time.Time
+	client   service.AccrualClient
+	// now is replaced in tests
+	now       func() time.Time
+	log       *logger.Log
+	state     BreakerState
+	failures  int
+	threshold int
+	cooldown  time.Duration
+	probing   bool
+	mu        sync.Mutex
+}
+
+// NewBreaker wraps the client, zero threshold disables the breaker.
+func NewBreaker(client service.AccrualClient, log *logger.Log, threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		client:    client,
+		now:       time.Now,
+		log:       log,
+		state:     BreakerClosed,
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+func (b *Breaker) FetchOrderInfo(ctx context.Context, orderNo string) (*accmodels.OrderInfoResponse, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+
+	info, err := b.client.FetchOrderInfo(ctx, orderNo)
+	b.done(err)
+
+	return info, err
+}
+
+func (b *Breaker) BatchSupported() bool {
+	batch, ok := b.client.(service.BatchAccrualClient)
+	return ok && batch.BatchSupported()
+}
+
+func (b *Breaker) FetchOrdersInfo(
+	ctx context.Context,
+	orderNos []string,
+) (map[string]*accmodels.OrderInfoResponse, error) {
+	batch, ok := b.client.(service.BatchAccrualClient)
+	if !ok {
+		return nil, service.ErrBatchUnsupported
+	}
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+
+	infos, err := batch.FetchOrdersInfo(ctx, orderNos)
+	b.done(err)
+
+	return infos, err
+}
+
+func (b *Breaker) allow() error {
+	// half-open breaker waits for the probe, so other requests are retried shortly
+	const probeWait = time.Second
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if left := b.openedAt.Add(b.cooldown).Sub(b.now()); left > 0 {
+			return &service.CircuitOpenError{RetryAfter: left}
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		b.log.Info("accrual circuit breaker is half-open, probing accrual system")
+	case BreakerHalfOpen:
+		if b.probing {
+			return &service.CircuitOpenError{RetryAfter: probeWait}
+		}
+		b.probing = true
+	}
+
+	return nil
+}
+
+func (b *Breaker) done(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if !isBreakerFailure(err) {
+		if b.state != BreakerClosed {
+			b.log.Info("accrual circuit breaker is closed")
+		}
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.threshold <= 0 || (b.state == BreakerClosed && b.failures < b.threshold) {
+		return
+	}
+	b.state = BreakerOpen
+	b.openedAt = b.now()
+	b.log.Warn("accrual circuit breaker is open", "failures", b.failures, "cooldown", b.cooldown, "error", err)
+}
+
+func isBreakerFailure(err error) bool {
+	var errToManyRequests *service.ToManyRequestsError
+	switch {
+	case err == nil,
+		errors.Is(err, service.ErrOrderNotRegistered),
+		errors.Is(err, service.ErrBatchUnsupported),
+		errors.As(err, &errToManyRequests):
+		return false
+	default:
+		return true
+	}
+}
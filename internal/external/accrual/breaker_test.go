@@ -0,0 +1,108 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RIBorisov/gophermart/internal/logger"
+	accmodels "github.com/RIBorisov/gophermart/internal/models/accrual"
+	"github.com/RIBorisov/gophermart/internal/service"
+)
+
+func TestBreaker(t *testing.T) {
+	const (
+		downOrder      = "7177570715"
+		upOrder        = "3682151158"
+		throttledOrder = "5116141762"
+		cooldown       = 30 * time.Second
+	)
+	log := &logger.Log{}
+	log.Initialize("DEBUG")
+
+	client := NewFakeClient().
+		Script(downOrder, FakeResponse{Err: &service.AccrualServerError{StatusCode: http.StatusServiceUnavailable}}).
+		Script(upOrder, FakeResponse{Info: &accmodels.OrderInfoResponse{Status: accmodels.Processing}}).
+		Script(throttledOrder, FakeResponse{Err: &service.ToManyRequestsError{RetryAfter: time.Minute}})
+
+	breaker := NewBreaker(client, log, 2, cooldown)
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// contract responses are not failures
+	for _, orderNo := range []string{throttledOrder, "2377225624", throttledOrder} {
+		_, err := breaker.FetchOrderInfo(ctx, orderNo)
+		require.Error(t, err)
+	}
+	assert.Equal(t, BreakerClosed, breaker.State())
+
+	for range 2 {
+		_, err := breaker.FetchOrderInfo(ctx, downOrder)
+		var errServer *service.AccrualServerError
+		require.ErrorAs(t, err, &errServer)
+	}
+	assert.Equal(t, BreakerOpen, breaker.State())
+
+	_, err := breaker.FetchOrderInfo(ctx, upOrder)
+	var errCircuitOpen *service.CircuitOpenError
+	require.ErrorAs(t, err, &errCircuitOpen)
+	assert.Equal(t, cooldown, errCircuitOpen.RetryAfter)
+	assert.Equal(t, 0, client.Calls(upOrder))
+
+	// the failed probe opens the breaker again
+	now = now.Add(cooldown)
+	_, err = breaker.FetchOrderInfo(ctx, downOrder)
+	require.False(t, errors.As(err, &errCircuitOpen))
+	assert.Equal(t, BreakerOpen, breaker.State())
+
+	// the successful probe closes it
+	now = now.Add(cooldown)
+	_, err = breaker.FetchOrderInfo(ctx, upOrder)
+	require.NoError(t, err)
+	assert.Equal(t, BreakerClosed, breaker.State())
+	assert.Equal(t, 1, client.Calls(upOrder))
+}
+
+type blockingClient struct {
+	release chan struct{}
+}
+
+func (c *blockingClient) FetchOrderInfo(ctx context.Context, orderNo string) (*accmodels.OrderInfoResponse, error) {
+	<-c.release
+	return &accmodels.OrderInfoResponse{Order: orderNo, Status: accmodels.Processing}, nil
+}
+
+func TestBreakerHalfOpenSingleProbe(t *testing.T) {
+	log := &logger.Log{}
+	log.Initialize("DEBUG")
+
+	client := &blockingClient{release: make(chan struct{})}
+	breaker := NewBreaker(client, log, 1, time.Second)
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+
+	breaker.done(errors.New("connection refused"))
+	require.Equal(t, BreakerOpen, breaker.State())
+	now = now.Add(time.Second)
+
+	probeDone := make(chan error)
+	go func() {
+		_, err := breaker.FetchOrderInfo(context.Background(), "7177570715")
+		probeDone <- err
+	}()
+	require.Eventually(t, func() bool { return breaker.State() == BreakerHalfOpen }, time.Second, time.Millisecond)
+
+	_, err := breaker.FetchOrderInfo(context.Background(), "3682151158")
+	var errCircuitOpen *service.CircuitOpenError
+	require.ErrorAs(t, err, &errCircuitOpen)
+
+	close(client.release)
+	require.NoError(t, <-probeDone)
+	assert.Equal(t, BreakerClosed, breaker.State())
+}
@@ -0,0 +1,155 @@
+package accrual
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+
+	"github.com/RIBorisov/gophermart/internal/config"
+	accmodels "github.com/RIBorisov/gophermart/internal/models/accrual"
+	"github.com/RIBorisov/gophermart/internal/service"
+)
+
+// HTTPClient is service.BatchAccrualClient talking to the accrual system over HTTP. It is safe for concurrent use
+// and shares keep-alive connections between workers. Requests failed on transport level are retried,
+// while the accrual system responses are mapped to service errors and left to the caller.
+type HTTPClient struct {
+	client     *resty.Client
+	route      string
+	batchRoute string
+	// batchUnsupported is set once the accrual system responded it has no batch endpoint
+	batchUnsupported atomic.Bool
+}
+
+func NewHTTPClient(cfg config.Service) *HTTPClient {
+	const retryWaitTime = 100 * time.Millisecond
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = max(cfg.AccrualWorkers, 1)
+
+	client := resty.New().
+		SetTransport(transport).
+		SetBaseURL(cfg.AccrualSystemAddress).
+		SetTimeout(cfg.AccrualRequestTimeout).
+		SetRetryCount(cfg.AccrualRetryCount).
+		SetRetryWaitTime(retryWaitTime).
+		SetRetryMaxWaitTime(cfg.AccrualRequestTimeout)
+
+	return &HTTPClient{client: client, route: cfg.AccrualOrderInfoRoute, batchRoute: cfg.AccrualBatchRoute}
+}
+
+func (c *HTTPClient) FetchOrderInfo(ctx context.Context, orderNo string) (*accmodels.OrderInfoResponse, error) {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetPathParam("orderID", orderNo).
+		Get(c.route)
+	if err != nil {
+		return nil, fmt.Errorf("failed make request to accrual: %w", err)
+	}
+
+	switch code := resp.StatusCode(); {
+	case code == http.StatusOK:
+		var updatedInfo accmodels.OrderInfoResponse
+		if err = json.Unmarshal(resp.Body(), &updatedInfo); err != nil {
+			return nil, fmt.Errorf("failed decode accrual response: %w", err)
+		}
+		return &updatedInfo, nil
+	case code == http.StatusNoContent:
+		return nil, service.ErrOrderNotRegistered
+	case code == http.StatusTooManyRequests:
+		return nil, toManyRequests(resp)
+	case code >= http.StatusInternalServerError:
+		return nil, &service.AccrualServerError{StatusCode: code, Body: resp.String()}
+	default:
+		return nil, fmt.Errorf("got unexpected accrual response status %d: %s", code, resp.String())
+	}
+}
+
+func (c *HTTPClient) BatchSupported() bool {
+	return c.batchRoute != "" && !c.batchUnsupported.Load()
+}
+
+// FetchOrdersInfo posts order numbers to the batch route. When the accrual system responds that
+// the route doesn't exist, batch lookup is turned off and service.ErrBatchUnsupported is returned.
+func (c *HTTPClient) FetchOrdersInfo(
+	ctx context.Context,
+	orderNos []string,
+) (map[string]*accmodels.OrderInfoResponse, error) {
+	if !c.BatchSupported() {
+		return nil, service.ErrBatchUnsupported
+	}
+
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(orderNos).
+		Post(c.batchRoute)
+	if err != nil {
+		return nil, fmt.Errorf("failed make batch request to accrual: %w", err)
+	}
+
+	switch code := resp.StatusCode(); {
+	case code == http.StatusOK:
+		var list []accmodels.OrderInfoResponse
+		if err = json.Unmarshal(resp.Body(), &list); err != nil {
+			return nil, fmt.Errorf("failed decode accrual batch response: %w", err)
+		}
+		infos := make(map[string]*accmodels.OrderInfoResponse, len(list))
+		for i := range list {
+			infos[list[i].Order] = &list[i]
+		}
+		return infos, nil
+	case code == http.StatusNotFound || code == http.StatusMethodNotAllowed || code == http.StatusNotImplemented:
+		c.batchUnsupported.Store(true)
+		return nil, service.ErrBatchUnsupported
+	case code == http.StatusTooManyRequests:
+		return nil, toManyRequests(resp)
+	case code >= http.StatusInternalServerError:
+		return nil, &service.AccrualServerError{StatusCode: code, Body: resp.String()}
+	default:
+		return nil, fmt.Errorf("got unexpected accrual batch response status %d: %s", code, resp.String())
+	}
+}
+
+func toManyRequests(resp *resty.Response) *service.ToManyRequestsError {
+	return &service.ToManyRequestsError{
+		RetryAfter: parseRetryAfter(resp.Header().Get("Retry-After")),
+		Limit:      parseRequestsLimit(resp.String()),
+		Message:    "Got StatusTooManyRequests error, should wait..."}
+}
+
+// parseRetryAfter parses Retry-After header in seconds, a minute is returned when header is missing or invalid.
+func parseRetryAfter(header string) time.Duration {
+	const defaultRetryAfter = time.Minute
+
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds < 0 {
+		return defaultRetryAfter
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+var requestsLimitRe = regexp.MustCompile(`No more than (\d+) requests per minute`)
+
+// parseRequestsLimit extracts the limit from the accrual system 429 response body,
+// e.g. "No more than 10 requests per minute allowed".
+func parseRequestsLimit(body string) int {
+	match := requestsLimitRe.FindStringSubmatch(body)
+	if match == nil {
+		return 0
+	}
+	limit, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0
+	}
+
+	return limit
+}
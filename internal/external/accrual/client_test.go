@@ -0,0 +1,174 @@
+package accrual
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RIBorisov/gophermart/internal/config"
+	accmodels "github.com/RIBorisov/gophermart/internal/models/accrual"
+	"github.com/RIBorisov/gophermart/internal/service"
+)
+
+func TestParseRequestsLimit(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{name: "Positive #1", body: "No more than 10 requests per minute allowed", want: 10},
+		{name: "Positive #2", body: "No more than 250 requests per minute allowed\n", want: 250},
+		{name: "Negative #1", body: "Too Many Requests", want: 0},
+		{name: "Negative #2", body: "", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRequestsLimit(tt.body); got != tt.want {
+				t.Errorf("parseRequestsLimit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+	}{
+		{name: "Positive #1", header: "60", want: time.Minute},
+		{name: "Positive #2", header: "0", want: 0},
+		{name: "Negative #1 (missing)", header: "", want: time.Minute},
+		{name: "Negative #2 (invalid)", header: "soon", want: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.header); got != tt.want {
+				t.Errorf("parseRetryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPClient(t *testing.T) {
+	var dropped atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.URL.Path, "/api/orders/") {
+		case "200":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"order": "200", "status": "PROCESSED", "accrual": 729.98}`))
+		case "204":
+			w.WriteHeader(http.StatusNoContent)
+		case "429":
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte("No more than 10 requests per minute allowed"))
+		case "500":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "dropped":
+			// the first connection is dropped without response, the retry succeeds
+			if !dropped.Swap(true) {
+				conn, _, err := w.(http.Hijacker).Hijack()
+				require.NoError(t, err)
+				_ = conn.Close()
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"order": "dropped", "status": "PROCESSING"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	client := NewHTTPClient(config.Service{
+		AccrualSystemAddress:  srv.URL,
+		AccrualOrderInfoRoute: "/api/orders/{orderID}",
+		AccrualRequestTimeout: time.Second,
+		AccrualRetryCount:     1,
+	})
+	ctx := context.Background()
+
+	info, err := client.FetchOrderInfo(ctx, "200")
+	require.NoError(t, err)
+	assert.Equal(t, accmodels.OrderInfoResponse{Order: "200", Status: accmodels.Processed, Accrual: 72998}, *info)
+
+	info, err = client.FetchOrderInfo(ctx, "dropped")
+	require.NoError(t, err)
+	assert.Equal(t, accmodels.Status(accmodels.Processing), info.Status)
+
+	_, err = client.FetchOrderInfo(ctx, "204")
+	assert.ErrorIs(t, err, service.ErrOrderNotRegistered)
+
+	_, err = client.FetchOrderInfo(ctx, "429")
+	var errToManyRequests *service.ToManyRequestsError
+	require.ErrorAs(t, err, &errToManyRequests)
+	assert.Equal(t, time.Minute, errToManyRequests.RetryAfter)
+	assert.Equal(t, 10, errToManyRequests.Limit)
+
+	_, err = client.FetchOrderInfo(ctx, "500")
+	var errServer *service.AccrualServerError
+	require.ErrorAs(t, err, &errServer)
+	assert.Equal(t, http.StatusInternalServerError, errServer.StatusCode)
+
+	_, err = client.FetchOrderInfo(ctx, "400")
+	assert.Error(t, err)
+	assert.False(t, errors.As(err, &errServer))
+}
+
+func TestHTTPClientBatch(t *testing.T) {
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path != "/api/orders/batch" || r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var orderNos []string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&orderNos))
+		assert.Equal(t, []string{"7177570715", "2377225624"}, orderNos)
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"order": "7177570715", "status": "PROCESSED", "accrual": 729.98}]`))
+	}))
+	defer srv.Close()
+
+	cfg := config.Service{
+		AccrualSystemAddress:  srv.URL,
+		AccrualOrderInfoRoute: "/api/orders/{orderID}",
+		AccrualBatchRoute:     "/api/orders/batch",
+		AccrualRequestTimeout: time.Second,
+	}
+	ctx := context.Background()
+
+	client := NewHTTPClient(cfg)
+	require.True(t, client.BatchSupported())
+	infos, err := client.FetchOrdersInfo(ctx, []string{"7177570715", "2377225624"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]*accmodels.OrderInfoResponse{
+		"7177570715": {Order: "7177570715", Status: accmodels.Processed, Accrual: 72998},
+	}, infos)
+
+	// the accrual system without batch endpoint turns batch lookup off after the first request
+	cfg.AccrualBatchRoute = "/api/orders/unknown"
+	client = NewHTTPClient(cfg)
+	requests.Store(0)
+	for range 2 {
+		_, err = client.FetchOrdersInfo(ctx, []string{"7177570715"})
+		assert.ErrorIs(t, err, service.ErrBatchUnsupported)
+	}
+	assert.False(t, client.BatchSupported())
+	assert.Equal(t, int64(1), requests.Load())
+
+	cfg.AccrualBatchRoute = ""
+	assert.False(t, NewHTTPClient(cfg).BatchSupported())
+}
@@ -0,0 +1,136 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	accmodels "github.com/RIBorisov/gophermart/internal/models/accrual"
+	"github.com/RIBorisov/gophermart/internal/service"
+)
+
+// FakeResponse is a scripted result of FakeClient.FetchOrderInfo, either Info or Err is set.
+type FakeResponse struct {
+	Info *accmodels.OrderInfoResponse
+	Err  error
+}
+
+// FakeClient is service.BatchAccrualClient replaying scripted responses per order without network.
+// Responses of the order are returned one by one and the last one is repeated, orders without
+// a script are reported as not registered. Batch lookup is off until EnableBatch is called.
+type FakeClient struct {
+	scripts    map[string][]FakeResponse
+	calls      map[string]int
+	batchCalls int
+	batch      bool
+	mu         sync.Mutex
+}
+
+func NewFakeClient() *FakeClient {
+	return &FakeClient{scripts: make(map[string][]FakeResponse), calls: make(map[string]int)}
+}
+
+// Script appends responses for the order.
+func (c *FakeClient) Script(orderNo string, responses ...FakeResponse) *FakeClient {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.scripts[orderNo] = append(c.scripts[orderNo], responses...)
+
+	return c
+}
+
+// Calls returns how many times the order has been requested.
+func (c *FakeClient) Calls(orderNo string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.calls[orderNo]
+}
+
+// EnableBatch turns batch lookup on.
+func (c *FakeClient) EnableBatch() *FakeClient {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.batch = true
+
+	return c
+}
+
+// BatchCalls returns how many batch lookups have been made.
+func (c *FakeClient) BatchCalls() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.batchCalls
+}
+
+func (c *FakeClient) FetchOrderInfo(ctx context.Context, orderNo string) (*accmodels.OrderInfoResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.next(orderNo)
+}
+
+func (c *FakeClient) BatchSupported() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.batch
+}
+
+// FetchOrdersInfo replays the next response of every order, the first scripted error
+// other than service.ErrOrderNotRegistered fails the whole batch.
+func (c *FakeClient) FetchOrdersInfo(
+	ctx context.Context,
+	orderNos []string,
+) (map[string]*accmodels.OrderInfoResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.batch {
+		return nil, service.ErrBatchUnsupported
+	}
+	c.batchCalls++
+
+	infos := make(map[string]*accmodels.OrderInfoResponse, len(orderNos))
+	for _, orderNo := range orderNos {
+		info, err := c.next(orderNo)
+		if errors.Is(err, service.ErrOrderNotRegistered) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		infos[orderNo] = info
+	}
+
+	return infos, nil
+}
+
+func (c *FakeClient) next(orderNo string) (*accmodels.OrderInfoResponse, error) {
+	script := c.scripts[orderNo]
+	call := c.calls[orderNo]
+	c.calls[orderNo]++
+	if len(script) == 0 {
+		return nil, service.ErrOrderNotRegistered
+	}
+
+	resp := script[min(call, len(script)-1)]
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	info := *resp.Info
+	info.Order = orderNo
+
+	return &info, nil
+}
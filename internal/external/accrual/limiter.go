@@ -0,0 +1,97 @@
+package accrual
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket shared by all accrual workers of the process. Besides the rate limit
+// it supports global pause, so Retry-After received by one worker is honored by all of them.
+type Limiter struct {
+	last        time.Time
+	pausedUntil time.Time
+	tokens      float64
+	// rate is tokens per second, zero means no limit
+	rate float64
+	mu   sync.Mutex
+}
+
+// NewLimiter creates limiter allowing perMinute requests per minute, zero perMinute means no limit.
+func NewLimiter(perMinute int) *Limiter {
+	l := &Limiter{last: time.Now()}
+	l.SetRate(perMinute)
+
+	return l
+}
+
+// SetRate changes the limit, e.g. after the accrual system reported its own one.
+func (l *Limiter) SetRate(perMinute int) {
+	const secondsInMinute = 60
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now())
+	l.rate = float64(perMinute) / secondsInMinute
+	l.tokens = min(l.tokens, 1)
+}
+
+// Pause blocks all waiters for the given duration, overlapping pauses are merged.
+func (l *Limiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// Wait blocks until request is allowed or ctx is done.
+func (l *Limiter) Wait(ctx context.Context) error {
+	for {
+		wait := l.reserve()
+		if wait <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes a token and returns zero or returns how long to wait before the next try.
+func (l *Limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now)
+	}
+	if l.rate == 0 {
+		return 0
+	}
+
+	l.refill(now)
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// refill adds tokens accumulated since the last call, bucket holds at most one token
+// so requests are spread evenly, the caller must hold the mutex.
+func (l *Limiter) refill(now time.Time) {
+	if l.rate > 0 {
+		l.tokens = min(1, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+}
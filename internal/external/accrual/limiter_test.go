@@ -0,0 +1,47 @@
+package accrual
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiterUnlimited(t *testing.T) {
+	l := NewLimiter(0)
+	start := time.Now()
+	for range 100 {
+		assert.NoError(t, l.Wait(context.Background()))
+	}
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestLimiterRate(t *testing.T) {
+	// 1200 per minute is one request per 50ms
+	l := NewLimiter(1200)
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	for range 3 {
+		assert.NoError(t, l.Wait(context.Background()))
+	}
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, 90*time.Millisecond)
+	assert.Less(t, elapsed, 300*time.Millisecond)
+}
+
+func TestLimiterPause(t *testing.T) {
+	l := NewLimiter(0)
+	l.Pause(100 * time.Millisecond)
+	l.Pause(10 * time.Millisecond)
+
+	start := time.Now()
+	assert.NoError(t, l.Wait(context.Background()))
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+
+	l.Pause(time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.Wait(ctx), context.DeadlineExceeded)
+}
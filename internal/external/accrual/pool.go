@@ -0,0 +1,186 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/RIBorisov/gophermart/internal/models/orders"
+	"github.com/RIBorisov/gophermart/internal/service"
+	"github.com/RIBorisov/gophermart/internal/storage"
+)
+
+// Pool is a supervised pool of accrual workers. An order which fails processing is logged, counted and
+// requeued with backoff, a panicking worker is restarted, so the pool stops only on ctx cancellation.
+// Workers group orders available in the channel into batches of ACCRUAL_BATCH_SIZE, which are looked up
+// with one request when the accrual client supports it and order by order otherwise.
+type Pool struct {
+	svc     *service.Service
+	limiter *Limiter
+	orders  <-chan orders.Pending
+
+	processed    atomic.Int64
+	failed       atomic.Int64
+	deadLettered atomic.Int64
+	restarts     atomic.Int64
+	size         int
+	batchSize    int
+}
+
+// PoolStats is a snapshot of Pool counters.
+type PoolStats struct {
+	Processed    int64
+	Failed       int64
+	DeadLettered int64
+	Restarts     int64
+}
+
+func NewPool(svc *service.Service, limiter *Limiter, ordersCh <-chan orders.Pending, size int) *Pool {
+	return &Pool{
+		svc:       svc,
+		limiter:   limiter,
+		orders:    ordersCh,
+		size:      size,
+		batchSize: max(svc.Config.Service.AccrualBatchSize, 1),
+	}
+}
+
+// Run starts workers and blocks until ctx is done or orders channel is closed.
+func (p *Pool) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := range p.size {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.supervise(ctx, i)
+		}()
+	}
+	wg.Wait()
+}
+
+func (p *Pool) Stats() PoolStats {
+	return PoolStats{
+		Processed:    p.processed.Load(),
+		Failed:       p.failed.Load(),
+		DeadLettered: p.deadLettered.Load(),
+		Restarts:     p.restarts.Load(),
+	}
+}
+
+// supervise restarts the worker until it finishes normally.
+func (p *Pool) supervise(ctx context.Context, workerID int) {
+	for !p.work(ctx, workerID) {
+		p.restarts.Add(1)
+		p.svc.Log.Warn("restarting accrual worker", "worker_id", workerID)
+	}
+	p.svc.Log.Debug("accrual worker stopped", "worker_id", workerID)
+}
+
+// work processes orders until the channel is closed and returns false when the worker has panicked.
+func (p *Pool) work(ctx context.Context, workerID int) (finished bool) {
+	var current *orders.Pending
+	defer func() {
+		if r := recover(); r != nil {
+			p.svc.Log.Err("accrual worker panicked", r)
+			if current != nil {
+				p.fail(ctx, current, fmt.Errorf("worker panicked: %v", r))
+			}
+			finished = false
+		}
+	}()
+
+	for {
+		batch, ok := p.nextBatch()
+		if !ok {
+			return true
+		}
+
+		infos, batchErr := FetchOrdersInfo(ctx, p.svc, p.limiter, batch)
+		for _, o := range batch {
+			current = &o
+			p.svc.Log.Info("incoming new order", "order_id", o.Number, "worker_id", workerID)
+
+			var err error
+			if errors.Is(batchErr, service.ErrBatchUnsupported) {
+				err = FetchAndUpdateOrders(ctx, p.svc, p.limiter, o)
+			} else {
+				err = UpdateBatchOrder(ctx, p.svc, o, infos, batchErr)
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					// shutting down, the lease expires and another instance picks the order up
+					return true
+				}
+				p.fail(ctx, current, err)
+				continue
+			}
+			p.processed.Add(1)
+		}
+		current = nil
+	}
+}
+
+// nextBatch waits for an order and adds to it orders already available in the channel up to batch size.
+// It returns false when the channel is closed.
+func (p *Pool) nextBatch() ([]orders.Pending, bool) {
+	o, ok := <-p.orders
+	if !ok {
+		return nil, false
+	}
+
+	batch := []orders.Pending{o}
+	for len(batch) < p.batchSize {
+		select {
+		case o, ok := <-p.orders:
+			if !ok {
+				return batch, true
+			}
+			batch = append(batch, o)
+		default:
+			return batch, true
+		}
+	}
+
+	return batch, true
+}
+
+func (p *Pool) fail(ctx context.Context, order *orders.Pending, cause error) {
+	p.failed.Add(1)
+	p.svc.Log.Err("failed process order, requeue", fmt.Sprintf("order_id=%s: %v", order.Number, cause))
+
+	deadLettered, err := p.svc.FailOrder(ctx, order, cause)
+	if err != nil {
+		if errors.Is(err, storage.ErrLeaseLost) {
+			p.svc.Log.Warn("order lease lost, skipping requeue", "order_id", order.Number)
+			return
+		}
+		if !errors.Is(err, context.Canceled) {
+			p.svc.Log.Err("failed requeue order", err)
+		}
+		return
+	}
+	if deadLettered {
+		p.deadLettered.Add(1)
+		p.svc.Log.Err("order moved to dead-letter state", fmt.Sprintf("order_id=%s", order.Number))
+	}
+}
+
+// Monitor is service.AccrualMonitor reporting the breaker state and the pool counters.
+type Monitor struct {
+	Breaker *Breaker
+	Pool    *Pool
+}
+
+func (m *Monitor) Stats() service.AccrualStats {
+	stats := m.Pool.Stats()
+
+	return service.AccrualStats{
+		BreakerState: string(m.Breaker.State()),
+		Processed:    stats.Processed,
+		Failed:       stats.Failed,
+		DeadLettered: stats.DeadLettered,
+		Restarts:     stats.Restarts,
+	}
+}
@@ -0,0 +1,174 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RIBorisov/gophermart/internal/config"
+	"github.com/RIBorisov/gophermart/internal/logger"
+	"github.com/RIBorisov/gophermart/internal/models"
+	accmodels "github.com/RIBorisov/gophermart/internal/models/accrual"
+	"github.com/RIBorisov/gophermart/internal/models/orders"
+	"github.com/RIBorisov/gophermart/internal/models/register"
+	"github.com/RIBorisov/gophermart/internal/service"
+	"github.com/RIBorisov/gophermart/internal/storage"
+)
+
+type panickingStore struct {
+	*storage.Memory
+	panicOn string
+}
+
+func (s *panickingStore) UpdateOrder(ctx context.Context, data *orders.UpdateOrder) error {
+	if data.Number == s.panicOn {
+		panic("unexpected storage state")
+	}
+	return s.Memory.UpdateOrder(ctx, data)
+}
+
+func TestPool(t *testing.T) {
+	const (
+		processedOrder    = "7177570715"
+		failingOrder      = "3682151158"
+		panickingOrder    = "5116141762"
+		serverErrorOrder  = "5830317037"
+		unregisteredOrder = "2377225624"
+	)
+	log := &logger.Log{}
+	log.Initialize("DEBUG")
+
+	processed := FakeResponse{Info: &accmodels.OrderInfoResponse{Status: accmodels.Processed, Accrual: 10000}}
+	client := NewFakeClient().
+		Script(processedOrder, processed).
+		Script(panickingOrder, processed).
+		Script(failingOrder, FakeResponse{Err: errors.New("unexpected accrual response")}).
+		Script(serverErrorOrder, FakeResponse{Err: &service.AccrualServerError{StatusCode: http.StatusInternalServerError}})
+
+	cfg := &config.Config{Service: config.Service{
+		AccrualBackoffBase: time.Second,
+		AccrualBackoffMax:  time.Minute,
+		AccrualOrderMaxAge: time.Hour,
+		AccrualMaxFailures: 1,
+	}}
+
+	mem := storage.NewMemory()
+	userID, err := mem.SaveUser(context.Background(), &register.Request{Login: "Vasiliy", Password: "pwd"})
+	require.NoError(t, err)
+	ctx := context.WithValue(context.Background(), models.CtxUserIDKey, userID)
+	for _, o := range []string{processedOrder, failingOrder, panickingOrder, serverErrorOrder, unregisteredOrder} {
+		require.NoError(t, mem.SaveOrder(ctx, o))
+	}
+
+	svc := &service.Service{
+		Log:     log,
+		Config:  cfg,
+		Storage: &panickingStore{Memory: mem, panicOn: panickingOrder},
+		Accrual: client,
+	}
+
+	claimed, err := mem.GetOrdersList(ctx, &orders.Lease{Owner: "test", Duration: time.Minute, BatchSize: 10})
+	require.NoError(t, err)
+	require.Len(t, claimed, 5)
+
+	ordersCh := make(chan orders.Pending, len(claimed))
+	for _, o := range claimed {
+		ordersCh <- o
+	}
+	close(ordersCh)
+
+	pool := NewPool(svc, NewLimiter(0), ordersCh, 1)
+	pool.Run(context.Background())
+
+	assert.Equal(t, PoolStats{Processed: 3, Failed: 2, DeadLettered: 2, Restarts: 1}, pool.Stats())
+
+	b, err := mem.GetBalance(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "100", b.Current.String())
+
+	oList, err := mem.GetUserOrders(ctx)
+	require.NoError(t, err)
+	statuses := make(map[string]orders.Status, len(oList))
+	for _, o := range oList {
+		statuses[o.OrderID] = o.Status
+	}
+	assert.Equal(t, map[string]orders.Status{
+		processedOrder:    orders.Processed,
+		failingOrder:      orders.New,
+		panickingOrder:    orders.New,
+		serverErrorOrder:  orders.New,
+		unregisteredOrder: orders.Invalid,
+	}, statuses)
+
+	// dead-lettered orders are not claimed anymore and postponed one is not due yet
+	left, err := mem.GetOrdersList(ctx, &orders.Lease{Owner: "test", Duration: time.Minute, BatchSize: 10})
+	require.NoError(t, err)
+	assert.Empty(t, left)
+}
+
+func TestPoolBatch(t *testing.T) {
+	const (
+		processedOrder    = "7177570715"
+		processingOrder   = "3682151158"
+		unregisteredOrder = "2377225624"
+	)
+	log := &logger.Log{}
+	log.Initialize("DEBUG")
+
+	client := NewFakeClient().
+		EnableBatch().
+		Script(processedOrder, FakeResponse{Info: &accmodels.OrderInfoResponse{Status: accmodels.Processed, Accrual: 10000}}).
+		Script(processingOrder, FakeResponse{Info: &accmodels.OrderInfoResponse{Status: accmodels.Processing}})
+
+	cfg := &config.Config{Service: config.Service{
+		AccrualBatchSize:       10,
+		AccrualBackoffBase:     time.Second,
+		AccrualBackoffMax:      time.Minute,
+		AccrualOrderMaxAge:     time.Hour,
+		AccrualUnregisteredTTL: time.Hour,
+		AccrualMaxFailures:     1,
+	}}
+
+	mem := storage.NewMemory()
+	userID, err := mem.SaveUser(context.Background(), &register.Request{Login: "Vasiliy", Password: "pwd"})
+	require.NoError(t, err)
+	ctx := context.WithValue(context.Background(), models.CtxUserIDKey, userID)
+	for _, o := range []string{processedOrder, processingOrder, unregisteredOrder} {
+		require.NoError(t, mem.SaveOrder(ctx, o))
+	}
+
+	svc := &service.Service{Log: log, Config: cfg, Storage: mem, Accrual: client}
+
+	claimed, err := mem.GetOrdersList(ctx, &orders.Lease{Owner: "test", Duration: time.Minute, BatchSize: 10})
+	require.NoError(t, err)
+	require.Len(t, claimed, 3)
+
+	ordersCh := make(chan orders.Pending, len(claimed))
+	for _, o := range claimed {
+		ordersCh <- o
+	}
+	close(ordersCh)
+
+	pool := NewPool(svc, NewLimiter(0), ordersCh, 1)
+	pool.Run(context.Background())
+
+	assert.Equal(t, PoolStats{Processed: 3}, pool.Stats())
+	assert.Equal(t, 1, client.BatchCalls())
+
+	oList, err := mem.GetUserOrders(ctx)
+	require.NoError(t, err)
+	statuses := make(map[string]orders.Status, len(oList))
+	for _, o := range oList {
+		statuses[o.OrderID] = o.Status
+	}
+	assert.Equal(t, map[string]orders.Status{
+		processedOrder:    orders.Processed,
+		processingOrder:   orders.Processing,
+		unregisteredOrder: orders.New,
+	}, statuses)
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	accmodels "github.com/RIBorisov/gophermart/internal/models/accrual"
+	"github.com/RIBorisov/gophermart/internal/service"
+	"github.com/RIBorisov/gophermart/internal/storage"
+)
+
+// AccrualCallback accepts order info pushed by the accrual system. Repeated callbacks are idempotent:
+// a callback for the order already moved into the same terminal status is acknowledged with 200.
+func AccrualCallback(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data accmodels.OrderInfoResponse
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if data.Order == "" {
+			http.Error(w, "Empty order number", http.StatusBadRequest)
+			return
+		}
+		if _, err := data.Status.ConvertToOrderStatus(); err != nil {
+			http.Error(w, "Invalid order status", http.StatusBadRequest)
+			return
+		}
+
+		err := svc.UpdateOrder(r.Context(), nil, &data)
+
+		var errTransition *storage.TransitionError
+		switch {
+		case err == nil:
+			svc.Log.Info("order updated by accrual callback", "order_id", data.Order, "status", data.Status)
+		case errors.Is(err, storage.ErrOrderNotExists):
+			http.Error(w, storage.ErrOrderNotExists.Error(), http.StatusNotFound)
+			return
+		case errors.As(err, &errTransition) && errTransition.From == errTransition.To:
+			svc.Log.Debug("skipped repeated accrual callback", "order_id", data.Order, "status", data.Status)
+		case errors.As(err, &errTransition):
+			svc.Log.Warn("rejected illegal order status transition",
+				"order_id", errTransition.Number, "from", errTransition.From, "to", errTransition.To)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		default:
+			svc.Log.Err("failed update order by accrual callback", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/RIBorisov/gophermart/internal/config"
+	"github.com/RIBorisov/gophermart/internal/logger"
+	myMW "github.com/RIBorisov/gophermart/internal/middleware"
+	"github.com/RIBorisov/gophermart/internal/models/orders"
+	"github.com/RIBorisov/gophermart/internal/service"
+	"github.com/RIBorisov/gophermart/internal/storage"
+	"github.com/RIBorisov/gophermart/internal/storage/mocks"
+)
+
+func TestAccrualCallback(t *testing.T) {
+	const (
+		route = "/internal/accrual/callback"
+		key   = "webhook-key"
+		body  = `{"order": "7177570715", "status": "PROCESSED", "accrual": 729.98}`
+	)
+	log := &logger.Log{}
+	log.Initialize("DEBUG")
+	cfg, err := config.LoadConfig()
+	assert.NoError(t, err)
+	cfg.Secret.AccrualWebhookKey = key
+	cfg.Service.AccrualWebhookWindow = time.Minute
+
+	now := time.Now().Unix()
+	tests := []struct {
+		name           string
+		body           string
+		timestamp      int64
+		signKey        string
+		callTimes      int
+		storeErr       error
+		wantStatusCode int
+	}{
+		{
+			name:           "Positive #1",
+			body:           body,
+			timestamp:      now,
+			signKey:        key,
+			callTimes:      1,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "Positive #2 (repeated callback)",
+			body:           body,
+			timestamp:      now,
+			signKey:        key,
+			callTimes:      1,
+			storeErr:       &storage.TransitionError{From: orders.Processed, To: orders.Processed},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "Negative #1 (wrong key)",
+			body:           body,
+			timestamp:      now,
+			signKey:        "another-key",
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:           "Negative #2 (expired)",
+			body:           body,
+			timestamp:      now - 120,
+			signKey:        key,
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:           "Negative #3 (invalid status)",
+			body:           `{"order": "7177570715", "status": "DONE"}`,
+			timestamp:      now,
+			signKey:        key,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "Negative #4 (unknown order)",
+			body:           body,
+			timestamp:      now,
+			signKey:        key,
+			callTimes:      1,
+			storeErr:       storage.ErrOrderNotExists,
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "Negative #5 (conflicting status)",
+			body:           body,
+			timestamp:      now,
+			signKey:        key,
+			callTimes:      1,
+			storeErr:       &storage.TransitionError{From: orders.Invalid, To: orders.Processed},
+			wantStatusCode: http.StatusConflict,
+		},
+		{
+			name:           "Negative #6",
+			body:           body,
+			timestamp:      now,
+			signKey:        key,
+			callTimes:      1,
+			storeErr:       errors.New("unexpected error"),
+			wantStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name:           "Negative #7 (too large)",
+			body:           `{"order": "7177570715", "status": "PROCESSED", "pad": "` + strings.Repeat("x", 64<<10) + `"}`,
+			timestamp:      now,
+			signKey:        key,
+			wantStatusCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockStore := mocks.NewMockStore(ctrl)
+			mockStore.EXPECT().UpdateOrder(gomock.Any(), gomock.Any()).Times(tt.callTimes).Return(tt.storeErr)
+
+			svc := &service.Service{Config: cfg, Log: log, Storage: mockStore}
+			router := NewRouter(svc)
+
+			req := newSignedCallback(t, route, tt.body, tt.signKey, tt.timestamp)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+		})
+	}
+}
+
+func TestAccrualCallbackReplay(t *testing.T) {
+	const (
+		route = "/internal/accrual/callback"
+		key   = "webhook-key"
+		body  = `{"order": "7177570715", "status": "PROCESSING"}`
+	)
+	log := &logger.Log{}
+	log.Initialize("DEBUG")
+	cfg, err := config.LoadConfig()
+	assert.NoError(t, err)
+	cfg.Secret.AccrualWebhookKey = key
+	cfg.Service.AccrualWebhookWindow = time.Minute
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := mocks.NewMockStore(ctrl)
+	gomock.InOrder(
+		mockStore.EXPECT().UpdateOrder(gomock.Any(), gomock.Any()).Return(errors.New("unexpected error")),
+		mockStore.EXPECT().UpdateOrder(gomock.Any(), gomock.Any()).Return(nil),
+	)
+
+	router := NewRouter(&service.Service{Config: cfg, Log: log, Storage: mockStore})
+	now := time.Now().Unix()
+
+	wantStatusCodes := []int{
+		http.StatusInternalServerError,
+		// failed delivery is allowed to be retried with the same signature
+		http.StatusOK,
+		http.StatusConflict,
+	}
+	for _, want := range wantStatusCodes {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, newSignedCallback(t, route, body, key, now))
+		assert.Equal(t, want, w.Code)
+	}
+}
+
+func TestAccrualCallbackDisabled(t *testing.T) {
+	log := &logger.Log{}
+	log.Initialize("DEBUG")
+	cfg, err := config.LoadConfig()
+	assert.NoError(t, err)
+	cfg.Secret.AccrualWebhookKey = ""
+
+	router := NewRouter(&service.Service{Config: cfg, Log: log})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, newSignedCallback(t, "/internal/accrual/callback", "{}", "", time.Now().Unix()))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func newSignedCallback(t *testing.T, route, body, key string, timestamp int64) *http.Request {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, route, bytes.NewBufferString(body))
+	assert.NoError(t, err)
+	req.Header.Set(myMW.AccrualTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(myMW.AccrualSignatureHeader, myMW.SignAccrualCallback([]byte(key), timestamp, []byte(body)))
+
+	return req
+}
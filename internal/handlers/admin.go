@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/RIBorisov/gophermart/internal/models/admin"
+	"github.com/RIBorisov/gophermart/internal/service"
+	"github.com/RIBorisov/gophermart/internal/storage"
+)
+
+// SearchUsers looks users up by the login prefix of the login query parameter.
+func SearchUsers(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		login := r.URL.Query().Get("login")
+		if login == "" {
+			http.Error(w, "Please, check if login provided", http.StatusBadRequest)
+			return
+		}
+
+		users, err := svc.SearchUsers(r.Context(), login)
+		if err != nil {
+			svc.Log.Err("failed search users", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+
+		writeAdminJSON(w, svc, users)
+	}
+}
+
+func GetUser(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := svc.GetUserInfo(r.Context(), chi.URLParam(r, "userID"))
+		if err != nil {
+			writeAdminError(w, svc, "failed get user", err)
+			return
+		}
+
+		writeAdminJSON(w, svc, user)
+	}
+}
+
+func GetUserOrders(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		oList, err := svc.UserOrders(r.Context(), chi.URLParam(r, "userID"))
+		if err != nil {
+			writeAdminError(w, svc, "failed get user orders", err)
+			return
+		}
+
+		writeAdminJSON(w, svc, oList)
+	}
+}
+
+func GetUserWithdrawals(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wList, err := svc.UserWithdrawals(r.Context(), chi.URLParam(r, "userID"))
+		if err != nil {
+			writeAdminError(w, svc, "failed get user withdrawals", err)
+			return
+		}
+
+		writeAdminJSON(w, svc, wList)
+	}
+}
+
+func GetUserBalance(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		current, err := svc.UserBalance(r.Context(), chi.URLParam(r, "userID"))
+		if err != nil {
+			writeAdminError(w, svc, "failed get user balance", err)
+			return
+		}
+
+		writeAdminJSON(w, svc, current)
+	}
+}
+
+// UnlockUserLogin lifts the lockout of the user login after failed attempts.
+func UnlockUserLogin(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		operator, ok := operatorClaims(w, r, svc)
+		if !ok {
+			return
+		}
+
+		unlocked, err := svc.UnlockUserLogin(r.Context(), operator, chi.URLParam(r, "userID"))
+		if err != nil {
+			writeAdminError(w, svc, "failed unlock user login", err)
+			return
+		}
+
+		writeAdminJSON(w, svc, admin.UnlockResponse{Unlocked: unlocked})
+	}
+}
+
+func BlockUser(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		operator, ok := operatorClaims(w, r, svc)
+		if !ok {
+			return
+		}
+
+		if err := svc.BlockUser(r.Context(), operator, chi.URLParam(r, "userID")); err != nil {
+			writeAdminError(w, svc, "failed block user", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func UnblockUser(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		operator, ok := operatorClaims(w, r, svc)
+		if !ok {
+			return
+		}
+
+		if err := svc.UnblockUser(r.Context(), operator, chi.URLParam(r, "userID")); err != nil {
+			writeAdminError(w, svc, "failed unblock user", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// SetUserRole grants the role, the user has to log in again to get it.
+func SetUserRole(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		operator, ok := operatorClaims(w, r, svc)
+		if !ok {
+			return
+		}
+
+		var req admin.RoleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			http.Error(w, "Please, check if role is one of user, support and admin", http.StatusBadRequest)
+			return
+		}
+
+		if err := svc.SetUserRole(r.Context(), operator, chi.URLParam(r, "userID"), req.Role); err != nil {
+			writeAdminError(w, svc, "failed set user role", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// GetUserAdjustments responds with the audit trail of balance adjustments of the user.
+func GetUserAdjustments(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		aList, err := svc.UserAdjustments(r.Context(), chi.URLParam(r, "userID"))
+		if err != nil {
+			writeAdminError(w, svc, "failed get user adjustments", err)
+			return
+		}
+
+		writeAdminJSON(w, svc, aList)
+	}
+}
+
+// AdjustUserBalance credits (positive amount) or debits (negative amount) the balance of the user.
+func AdjustUserBalance(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		operator, ok := operatorClaims(w, r, svc)
+		if !ok {
+			return
+		}
+
+		var req admin.AdjustmentRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			http.Error(w, "Please, check if nonzero amount, known reason and reference provided", http.StatusBadRequest)
+			return
+		}
+
+		adj, err := svc.AdjustBalance(r.Context(), operator, chi.URLParam(r, "userID"), &req)
+		if err != nil {
+			switch {
+			case errors.Is(err, storage.ErrInsufficientFunds):
+				http.Error(w, "Insufficient funds", http.StatusPaymentRequired)
+			case errors.Is(err, storage.ErrAdjustmentExists):
+				http.Error(w, "Adjustment with this reference already exists", http.StatusConflict)
+			default:
+				writeAdminError(w, svc, "failed adjust user balance", err)
+			}
+			return
+		}
+
+		writeAdminJSON(w, svc, adj)
+	}
+}
+
+func operatorClaims(w http.ResponseWriter, r *http.Request, svc *service.Service) (*service.Claims, bool) {
+	claims, ok := service.ClaimsFromContext(r.Context())
+	if !ok {
+		svc.Log.Err("failed get operator", "no token claims in request context")
+		http.Error(w, "", http.StatusInternalServerError)
+	}
+
+	return claims, ok
+}
+
+func writeAdminError(w http.ResponseWriter, svc *service.Service, msg string, err error) {
+	switch {
+	case errors.Is(err, storage.ErrUserNotExists):
+		http.Error(w, "User not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrOperatorSelf):
+		http.Error(w, "Operators can't block themselves or change their own role or balance", http.StatusConflict)
+	default:
+		svc.Log.Err(msg, err)
+		http.Error(w, "", http.StatusInternalServerError)
+	}
+}
+
+func writeAdminJSON(w http.ResponseWriter, svc *service.Service, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		svc.Log.Err("failed encode response", err)
+		http.Error(w, "", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RIBorisov/gophermart/internal/config"
+	"github.com/RIBorisov/gophermart/internal/logger"
+	"github.com/RIBorisov/gophermart/internal/models/admin"
+	"github.com/RIBorisov/gophermart/internal/models/money"
+	"github.com/RIBorisov/gophermart/internal/models/register"
+	"github.com/RIBorisov/gophermart/internal/service"
+	"github.com/RIBorisov/gophermart/internal/storage"
+)
+
+func TestAdminAPI(t *testing.T) {
+	log := &logger.Log{}
+	log.Initialize("DEBUG")
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err)
+
+	store := storage.NewMemory()
+	svc := &service.Service{
+		Config:      cfg,
+		Log:         log,
+		Storage:     store,
+		Keys:        testKeys(t),
+		Revocations: service.NewRevocationCache(time.Minute),
+	}
+	router := NewRouter(svc)
+
+	do := func(method, route, accessToken, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, route, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	// signUp registers the user with the role and returns the user id and the access token
+	signUp := func(login string, role admin.Role) (string, string) {
+		_, err := svc.RegisterUser(context.Background(), &register.Request{Login: login, Password: "pwd"})
+		require.NoError(t, err)
+		user, err := store.GetUser(context.Background(), login)
+		require.NoError(t, err)
+		require.NoError(t, store.SetUserRole(context.Background(), user.ID, role))
+		tokens, err := svc.LoginUser(context.Background(), &register.Request{Login: login, Password: "pwd"}, "")
+		require.NoError(t, err)
+		return user.ID, tokens.AccessToken
+	}
+
+	customerID, customer := signUp("customer", admin.RoleUser)
+	_, support := signUp("support", admin.RoleSupport)
+	adminID, root := signUp("root", admin.RoleAdmin)
+	userRoute := "/api/admin/users/" + customerID
+
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/api/admin/users?login=cust", customer, "").Code)
+
+	w := do(http.MethodGet, "/api/admin/users?login=cust", support, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var found []admin.User
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&found))
+	require.Len(t, found, 1)
+	assert.Equal(t, admin.User{ID: customerID, Login: "customer", Role: admin.RoleUser}, found[0])
+
+	for _, route := range []string{userRoute, userRoute + "/orders", userRoute + "/withdrawals", userRoute + "/balance"} {
+		assert.Equal(t, http.StatusOK, do(http.MethodGet, route, support, "").Code, route)
+	}
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/api/admin/users/unknown/orders", support, "").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, userRoute+"/unlock", support, "").Code)
+
+	// blocking is up to admins
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, userRoute+"/block", support, "").Code)
+	assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/api/admin/users/"+adminID+"/block", root, "").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, userRoute+"/block", root, "").Code)
+
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/user/balance", customer, "").Code)
+	_, err = svc.LoginUser(context.Background(), &register.Request{Login: "customer", Password: "pwd"}, "")
+	assert.ErrorIs(t, err, service.ErrUserBlocked)
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, userRoute+"/unblock", root, "").Code)
+	unblocked, err := svc.LoginUser(context.Background(), &register.Request{Login: "customer", Password: "pwd"}, "")
+	require.NoError(t, err)
+
+	// admin credits and debits the balance with the audit record, not below zero and not twice, support only reads it
+	adjustRoute := userRoute + "/adjustments"
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, adjustRoute, unblocked.AccessToken,
+		`{"amount": 100, "reason": "GOODWILL", "reference": "TICKET-1"}`).Code)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, adjustRoute, support,
+		`{"amount": 100, "reason": "GOODWILL", "reference": "TICKET-1"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, adjustRoute, root,
+		`{"amount": 100, "reason": "GOODWILL"}`).Code)
+	assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/api/admin/users/"+adminID+"/adjustments", root,
+		`{"amount": 100, "reason": "GOODWILL", "reference": "TICKET-1"}`).Code)
+
+	w = do(http.MethodPost, adjustRoute, root, `{"amount": 100.5, "reason": "COMPENSATION", "reference": "TICKET-1"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var adj admin.Adjustment
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&adj))
+	assert.Equal(t, adminID, adj.OperatorID)
+	assert.Equal(t, money.FromFloat(100.5), adj.BalanceAfter)
+
+	assert.Equal(t, http.StatusConflict, do(http.MethodPost, adjustRoute, root,
+		`{"amount": 100.5, "reason": "COMPENSATION", "reference": "TICKET-1"}`).Code)
+	assert.Equal(t, http.StatusPaymentRequired, do(http.MethodPost, adjustRoute, root,
+		`{"amount": -200, "reason": "FRAUD", "reference": "TICKET-2"}`).Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, adjustRoute, root,
+		`{"amount": -0.5, "reason": "CORRECTION", "reference": "TICKET-3"}`).Code)
+
+	w = do(http.MethodGet, adjustRoute, support, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var trail []admin.Adjustment
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&trail))
+	require.Len(t, trail, 2)
+	assert.Equal(t, "TICKET-3", trail[0].Reference)
+	assert.Equal(t, money.FromFloat(100), trail[0].BalanceAfter)
+
+	// the new role is granted with the next login
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, userRoute+"/role", root, `{"role": "owner"}`).Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodPut, userRoute+"/role", root, `{"role": "support"}`).Code)
+	promoted, err := svc.LoginUser(context.Background(), &register.Request{Login: "customer", Password: "pwd"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/admin/users?login=root", promoted.AccessToken, "").Code)
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RIBorisov/gophermart/internal/config"
+	"github.com/RIBorisov/gophermart/internal/logger"
+	"github.com/RIBorisov/gophermart/internal/models"
+	"github.com/RIBorisov/gophermart/internal/models/admin"
+	"github.com/RIBorisov/gophermart/internal/models/register"
+	"github.com/RIBorisov/gophermart/internal/service"
+	"github.com/RIBorisov/gophermart/internal/storage"
+)
+
+func TestCheckAuthHeader(t *testing.T) {
+	log := &logger.Log{}
+	log.Initialize("DEBUG")
+	cfg, err := config.LoadConfig()
+	assert.NoError(t, err)
+
+	mem := storage.NewMemory()
+	svc := &service.Service{Config: cfg, Log: log, Storage: mem, Keys: testKeys(t)}
+	router := NewRouter(svc)
+
+	userID, err := mem.SaveUser(context.Background(), &register.Request{Login: "Vasiliy", Password: "pwd"})
+	require.NoError(t, err)
+	tokens, err := svc.IssueTokens(context.Background(), userID, admin.RoleUser)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		header         string
+		wantStatusCode int
+	}{
+		{name: "Positive #1", header: "Bearer " + tokens.AccessToken, wantStatusCode: http.StatusOK},
+		{name: "Positive #2 (case insensitive scheme)", header: "bearer " + tokens.AccessToken, wantStatusCode: http.StatusOK},
+		{name: "Negative #1 (no header)", header: "", wantStatusCode: http.StatusUnauthorized},
+		{name: "Negative #2 (short header)", header: "Bear", wantStatusCode: http.StatusUnauthorized},
+		{name: "Negative #3 (no token)", header: "Bearer ", wantStatusCode: http.StatusUnauthorized},
+		{name: "Negative #4 (another scheme)", header: "Basic " + tokens.AccessToken, wantStatusCode: http.StatusUnauthorized},
+		{name: "Negative #5 (no scheme)", header: tokens.AccessToken, wantStatusCode: http.StatusUnauthorized},
+		{name: "Negative #6 (extra parts)", header: "Bearer " + tokens.AccessToken + " x", wantStatusCode: http.StatusUnauthorized},
+		{name: "Negative #7 (garbage)", header: "Bearer garbage", wantStatusCode: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/api/user/balance", http.NoBody)
+			require.NoError(t, err)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+		})
+	}
+}
+
+func TestCheckAuthCookie(t *testing.T) {
+	log := &logger.Log{}
+	log.Initialize("DEBUG")
+	cfg, err := config.LoadConfig()
+	assert.NoError(t, err)
+
+	svc := &service.Service{Config: cfg, Log: log, Storage: storage.NewMemory(), Keys: testKeys(t)}
+	router := NewRouter(svc)
+
+	req, err := http.NewRequest(http.MethodPost, "/api/user/register",
+		strings.NewReader(`{"login": "Vasiliy", "password": "pwd"}`))
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	cookies := map[string]*http.Cookie{}
+	for _, c := range w.Result().Cookies() {
+		cookies[c.Name] = c
+	}
+	access, csrf := cookies[models.AccessTokenCookie], cookies[models.CSRFCookie]
+	require.NotNil(t, access)
+	require.NotNil(t, csrf)
+	assert.True(t, access.HttpOnly)
+	assert.True(t, access.Secure)
+	assert.False(t, csrf.HttpOnly)
+	assert.Equal(t, http.SameSiteLaxMode, access.SameSite)
+
+	do := func(method, route, csrfHeader, body string, withCookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, route, strings.NewReader(body))
+		require.NoError(t, err)
+		for _, c := range withCookies {
+			req.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+		}
+		if csrfHeader != "" {
+			req.Header.Set(models.CSRFHeader, csrfHeader)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// safe requests need no CSRF token
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/user/balance", "", "", access).Code)
+
+	// mutating requests need the CSRF header matching the cookie
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/api/user/orders", "", "7177570715", access).Code)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/api/user/orders", csrf.Value, "7177570715", access).Code)
+	assert.Equal(t, http.StatusForbidden,
+		do(http.MethodPost, "/api/user/orders", "forged", "7177570715", access, csrf).Code)
+	assert.Equal(t, http.StatusAccepted,
+		do(http.MethodPost, "/api/user/orders", csrf.Value, "7177570715", access, csrf).Code)
+
+	// logout expires the cookies
+	w = do(http.MethodPost, "/api/user/logout", csrf.Value, "", access, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	for _, c := range w.Result().Cookies() {
+		assert.Equal(t, -1, c.MaxAge, c.Name)
+	}
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/user/balance", "", "", access).Code)
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"net/http"
 
+	"github.com/RIBorisov/gophermart/internal/models"
 	"github.com/RIBorisov/gophermart/internal/models/balance"
 	"github.com/RIBorisov/gophermart/internal/service"
 	"github.com/RIBorisov/gophermart/internal/storage"
@@ -51,13 +52,36 @@ func BalanceWithdraw(svc *service.Service) http.HandlerFunc {
 			http.Error(w, "Invalid order number", http.StatusUnprocessableEntity)
 			return
 		}
+		if req.Sum <= 0 {
+			http.Error(w, "Sum must be positive", http.StatusUnprocessableEntity)
+			return
+		}
 
-		err = svc.BalanceWithdraw(ctx, req)
+		err = svc.BalanceWithdraw(ctx, req, r.Header.Get(models.TwoFactorCodeHeader))
 		if err != nil {
+			if writeThrottled(w, err) {
+				return
+			}
+			if errors.Is(err, service.ErrTwoFactorRequired) {
+				http.Error(w, "Second factor code required", http.StatusForbidden)
+				return
+			}
+			if errors.Is(err, service.ErrInvalidTwoFactorCode) {
+				http.Error(w, "Invalid second factor code", http.StatusForbidden)
+				return
+			}
+			if errors.Is(err, service.ErrInvalidWithdrawSum) {
+				http.Error(w, "Sum must be positive", http.StatusUnprocessableEntity)
+				return
+			}
 			if errors.Is(err, storage.ErrInsufficientFunds) {
 				http.Error(w, "You have insufficient funds", http.StatusPaymentRequired)
 				return
 			}
+			if errors.Is(err, storage.ErrWithdrawalExists) {
+				http.Error(w, "Withdrawal for this order already exists", http.StatusConflict)
+				return
+			}
 			svc.Log.Err("failed make balance withdraw", err)
 			http.Error(w, "", http.StatusInternalServerError)
 			return
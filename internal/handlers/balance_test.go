@@ -14,6 +14,7 @@ import (
 	"github.com/RIBorisov/gophermart/internal/config"
 	"github.com/RIBorisov/gophermart/internal/logger"
 	"github.com/RIBorisov/gophermart/internal/models/balance"
+	"github.com/RIBorisov/gophermart/internal/models/money"
 	"github.com/RIBorisov/gophermart/internal/service"
 	"github.com/RIBorisov/gophermart/internal/storage"
 	"github.com/RIBorisov/gophermart/internal/storage/mocks"
@@ -41,8 +42,8 @@ func TestCurrentBalance(t *testing.T) {
 			callTimes:      1,
 			wantStatusCode: http.StatusOK,
 			wantResponse: &storage.BalanceEntity{
-				Current:   100.15,
-				Withdrawn: 100.85,
+				Current:   money.FromFloat(100.15),
+				Withdrawn: money.FromFloat(100.85),
 			},
 			wantError: nil,
 		},
@@ -106,24 +107,36 @@ func TestBalanceWithdraw(t *testing.T) {
 		{
 			name:           "Positive #1",
 			callTimes:      1,
-			body:           balance.WithdrawRequest{Order: "3682151158", Sum: 15.19},
+			body:           balance.WithdrawRequest{Order: "3682151158", Sum: money.FromFloat(15.19)},
 			wantStatusCode: http.StatusOK,
 			wantError:      nil,
 		},
 		{
 			name:           "Negative #1",
 			callTimes:      1,
-			body:           balance.WithdrawRequest{Order: "3682151158", Sum: 9999.115},
+			body:           balance.WithdrawRequest{Order: "3682151158", Sum: money.FromFloat(9999.11)},
 			wantStatusCode: http.StatusPaymentRequired,
 			wantError:      storage.ErrInsufficientFunds,
 		},
 		{
 			name:           "Negative #2",
 			callTimes:      1,
-			body:           balance.WithdrawRequest{Order: "3682151158", Sum: 9999.115},
+			body:           balance.WithdrawRequest{Order: "3682151158", Sum: money.FromFloat(9999.11)},
 			wantStatusCode: http.StatusInternalServerError,
 			wantError:      storage.ErrGetUserFromContext,
 		},
+		{
+			name:           "Negative #3",
+			callTimes:      0,
+			body:           balance.WithdrawRequest{Order: "3682151158", Sum: money.FromFloat(-15.19)},
+			wantStatusCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Negative #4",
+			callTimes:      0,
+			body:           balance.WithdrawRequest{Order: "3682151158"},
+			wantStatusCode: http.StatusUnprocessableEntity,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/RIBorisov/gophermart/internal/models"
+	"github.com/RIBorisov/gophermart/internal/models/token"
+	"github.com/RIBorisov/gophermart/internal/service"
+)
+
+// setAuthCookies lets browser clients authenticate with the access token cookie, along with it
+// the CSRF cookie is set, which value has to be sent back in the CSRF header.
+func setAuthCookies(w http.ResponseWriter, svc *service.Service, tokens token.Response) error {
+	csrf, err := service.NewCSRFToken()
+	if err != nil {
+		return err
+	}
+	maxAge := int(tokens.ExpiresIn)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     models.AccessTokenCookie,
+		Value:    tokens.AccessToken,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   svc.Config.Auth.CookieSecure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     models.CSRFCookie,
+		Value:    csrf,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   svc.Config.Auth.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return nil
+}
+
+func clearAuthCookies(w http.ResponseWriter, svc *service.Service) {
+	for _, name := range []string{models.AccessTokenCookie, models.CSRFCookie} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Path:     "/",
+			MaxAge:   -1,
+			Secure:   svc.Config.Auth.CookieSecure,
+			HttpOnly: name == models.AccessTokenCookie,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+}
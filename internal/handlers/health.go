@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/RIBorisov/gophermart/internal/service"
+)
+
+func Health(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		if err := json.NewEncoder(w).Encode(svc.Health()); err != nil {
+			svc.Log.Err("failed encode health response", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// Metrics exposes the accrual pipeline state in Prometheus text format.
+func Metrics(svc *service.Service) http.HandlerFunc {
+	// breakerStates are values of gophermart_accrual_breaker_state gauge
+	breakerStates := map[string]int{"closed": 0, "half-open": 1, "open": 2}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		acc := svc.Health().Accrual
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.WriteHeader(http.StatusOK)
+
+		metrics := []struct {
+			name  string
+			help  string
+			kind  string
+			value int64
+		}{
+			{
+				name:  "gophermart_accrual_breaker_state",
+				help:  "Accrual circuit breaker state: 0 closed, 1 half-open, 2 open.",
+				kind:  "gauge",
+				value: int64(breakerStates[acc.Breaker]),
+			},
+			{
+				name:  "gophermart_accrual_orders_processed_total",
+				help:  "Orders processed by accrual workers.",
+				kind:  "counter",
+				value: acc.Processed,
+			},
+			{
+				name:  "gophermart_accrual_orders_failed_total",
+				help:  "Orders failed processing and requeued.",
+				kind:  "counter",
+				value: acc.Failed,
+			},
+			{
+				name:  "gophermart_accrual_orders_dead_lettered_total",
+				help:  "Orders moved to the dead-letter state.",
+				kind:  "counter",
+				value: acc.DeadLettered,
+			},
+			{
+				name:  "gophermart_accrual_worker_restarts_total",
+				help:  "Accrual workers restarted after panic.",
+				kind:  "counter",
+				value: acc.Restarts,
+			},
+			{
+				name:  "gophermart_ledger_mismatched_users",
+				help:  "Users whose balance didn't reconcile with the ledger at the last reconciliation.",
+				kind:  "gauge",
+				value: svc.LedgerMismatches(),
+			},
+		}
+		for _, m := range metrics {
+			if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n",
+				m.name, m.help, m.name, m.kind, m.name, m.value); err != nil {
+				svc.Log.Err("failed write metrics", err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RIBorisov/gophermart/internal/config"
+	"github.com/RIBorisov/gophermart/internal/logger"
+	"github.com/RIBorisov/gophermart/internal/models/health"
+	"github.com/RIBorisov/gophermart/internal/service"
+)
+
+type staticMonitor service.AccrualStats
+
+func (m staticMonitor) Stats() service.AccrualStats {
+	return service.AccrualStats(m)
+}
+
+func TestHealth(t *testing.T) {
+	log := &logger.Log{}
+	log.Initialize("DEBUG")
+	cfg, err := config.LoadConfig()
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		monitor    service.AccrualMonitor
+		wantHealth health.Response
+	}{
+		{
+			name:       "Positive #1 (no accrual pipeline)",
+			monitor:    nil,
+			wantHealth: health.Response{Status: health.StatusOK},
+		},
+		{
+			name:    "Positive #2",
+			monitor: staticMonitor{BreakerState: "closed", Processed: 10, Failed: 1},
+			wantHealth: health.Response{
+				Status:  health.StatusOK,
+				Accrual: health.Accrual{Breaker: "closed", Processed: 10, Failed: 1},
+			},
+		},
+		{
+			name:    "Positive #3 (accrual system is down)",
+			monitor: staticMonitor{BreakerState: "open", Processed: 10, Failed: 5},
+			wantHealth: health.Response{
+				Status:  health.StatusDegraded,
+				Accrual: health.Accrual{Breaker: "open", Processed: 10, Failed: 5},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &service.Service{Config: cfg, Log: log, Monitor: tt.monitor}
+
+			w := httptest.NewRecorder()
+			Health(svc)(w, httptest.NewRequest(http.MethodGet, "/health", http.NoBody))
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var got health.Response
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+			assert.Equal(t, tt.wantHealth, got)
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	log := &logger.Log{}
+	log.Initialize("DEBUG")
+	cfg, err := config.LoadConfig()
+	assert.NoError(t, err)
+
+	svc := &service.Service{Config: cfg, Log: log, Monitor: staticMonitor{
+		BreakerState: "open",
+		Processed:    10,
+		DeadLettered: 2,
+	}}
+
+	w := httptest.NewRecorder()
+	Metrics(svc)(w, httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	body, err := io.ReadAll(w.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "# TYPE gophermart_accrual_breaker_state gauge\ngophermart_accrual_breaker_state 2\n")
+	assert.Contains(t, string(body), "\ngophermart_accrual_orders_processed_total 10\n")
+	assert.Contains(t, string(body), "\ngophermart_accrual_orders_dead_lettered_total 2\n")
+	assert.Contains(t, string(body), "\ngophermart_ledger_mismatched_users 0\n")
+}
+
+func TestMetricsScrapeToken(t *testing.T) {
+	log := &logger.Log{}
+	log.Initialize("DEBUG")
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err)
+
+	get := func(svc *service.Service, authorization string) int {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		NewRouter(svc).ServeHTTP(w, req)
+		return w.Code
+	}
+
+	svc := &service.Service{Config: cfg, Log: log, Keys: testKeys(t)}
+	assert.Equal(t, http.StatusNotFound, get(svc, "Bearer "), "metrics are disabled without METRICS_TOKEN")
+
+	scrapeCfg := *cfg
+	scrapeCfg.Secret.MetricsToken = "scrape-token"
+	svc = &service.Service{Config: &scrapeCfg, Log: log, Keys: testKeys(t)}
+	assert.Equal(t, http.StatusUnauthorized, get(svc, ""))
+	assert.Equal(t, http.StatusUnauthorized, get(svc, "Bearer wrong-token"))
+	assert.Equal(t, http.StatusUnauthorized, get(svc, "scrape-token"))
+	assert.Equal(t, http.StatusOK, get(svc, "Bearer scrape-token"))
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/RIBorisov/gophermart/internal/service"
+)
+
+// JWKS publishes public keys access tokens are verified with.
+func JWKS(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.WriteHeader(http.StatusOK)
+
+		if err := json.NewEncoder(w).Encode(svc.Keys.JWKS()); err != nil {
+			svc.Log.Err("failed encode jwks response", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RIBorisov/gophermart/internal/config"
+	"github.com/RIBorisov/gophermart/internal/logger"
+	"github.com/RIBorisov/gophermart/internal/models/jwks"
+	"github.com/RIBorisov/gophermart/internal/service"
+	"github.com/RIBorisov/gophermart/internal/storage"
+)
+
+func testKeys(t *testing.T) *service.KeySet {
+	t.Helper()
+
+	keys, err := service.NewEphemeralKeySet()
+	require.NoError(t, err)
+
+	return keys
+}
+
+func TestJWKS(t *testing.T) {
+	log := &logger.Log{}
+	log.Initialize("DEBUG")
+	cfg, err := config.LoadConfig()
+	assert.NoError(t, err)
+
+	svc := &service.Service{Config: cfg, Log: log, Keys: testKeys(t)}
+
+	req, err := http.NewRequest(http.MethodGet, "/.well-known/jwks.json", http.NoBody)
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	NewRouter(svc).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var set jwks.Set
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&set))
+	require.Len(t, set.Keys, 1)
+	assert.Equal(t, "OKP", set.Keys[0].Kty)
+	assert.Equal(t, "Ed25519", set.Keys[0].Crv)
+	assert.Equal(t, "EdDSA", set.Keys[0].Alg)
+	assert.Equal(t, "sig", set.Keys[0].Use)
+	assert.NotEmpty(t, set.Keys[0].X)
+}
+
+func TestCheckAuthSymmetricToken(t *testing.T) {
+	log := &logger.Log{}
+	log.Initialize("DEBUG")
+	cfg, err := config.LoadConfig()
+	assert.NoError(t, err)
+
+	svc := &service.Service{Config: cfg, Log: log, Storage: storage.NewMemory(), Keys: testKeys(t)}
+
+	// HS256 token signed with SECRET_KEY as it has been issued before asymmetric keys
+	hs256, err := jwt.NewWithClaims(jwt.SigningMethodHS256, service.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "legacy",
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		UserID: "123",
+	}).SignedString([]byte("legacy-secret"))
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodGet, "/api/user/balance", http.NoBody)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+hs256)
+	w := httptest.NewRecorder()
+	NewRouter(svc).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/RIBorisov/gophermart/internal/service"
+)
+
+func Ledger(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp, err := svc.GetLedger(r.Context())
+		if err != nil {
+			svc.Log.Err("failed get ledger", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+
+		if len(resp.Entries) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		if err = json.NewEncoder(w).Encode(resp); err != nil {
+			svc.Log.Err("failed encode ledger response", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+	}
+}
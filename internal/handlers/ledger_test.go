@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/RIBorisov/gophermart/internal/config"
+	"github.com/RIBorisov/gophermart/internal/logger"
+	"github.com/RIBorisov/gophermart/internal/models/ledger"
+	"github.com/RIBorisov/gophermart/internal/models/money"
+	"github.com/RIBorisov/gophermart/internal/service"
+	"github.com/RIBorisov/gophermart/internal/storage"
+	"github.com/RIBorisov/gophermart/internal/storage/mocks"
+)
+
+func TestLedger(t *testing.T) {
+	const (
+		route = "/api/user/ledger"
+		GET   = http.MethodGet
+	)
+	log := &logger.Log{}
+	log.Initialize("DEBUG")
+	cfg, err := config.LoadConfig()
+	assert.NoError(t, err)
+	now := time.Now()
+	tests := []struct {
+		name             string
+		callBalanceTimes int
+		wantStatusCode   int
+		wantResponse     []storage.LedgerEntity
+		wantBalance      money.Amount
+		drift            money.Amount
+		wantError        error
+	}{
+		{
+			name:             "Positive #1",
+			callBalanceTimes: 1,
+			wantStatusCode:   http.StatusOK,
+			wantResponse: []storage.LedgerEntity{
+				{ID: 1, Kind: ledger.Accrual, OrderID: "5116141762", Amount: money.FromFloat(729.98), CreatedAt: now},
+				{ID: 3, Kind: ledger.Withdrawal, OrderID: "5830317037", Amount: money.FromFloat(-15.75), CreatedAt: now},
+			},
+			wantBalance: money.FromFloat(714.23),
+			wantError:   nil,
+		},
+		{
+			name:             "Positive #3",
+			callBalanceTimes: 1,
+			wantStatusCode:   http.StatusOK,
+			wantResponse: []storage.LedgerEntity{
+				{ID: 3, Kind: ledger.Accrual, OrderID: "5116141762", Amount: money.FromFloat(100), CreatedAt: now},
+			},
+			wantBalance: money.FromFloat(100),
+			drift:       money.FromFloat(0.01),
+		},
+		{
+			name:             "Positive #2",
+			callBalanceTimes: 1,
+			wantStatusCode:   http.StatusNoContent,
+			wantResponse:     nil,
+			wantError:        nil,
+		},
+		{
+			name:             "Negative #1",
+			callBalanceTimes: 0,
+			wantStatusCode:   http.StatusInternalServerError,
+			wantResponse:     nil,
+			wantError:        errors.New("unexpected error"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockStore := mocks.NewMockStore(ctrl)
+			mockStore.EXPECT().GetLedger(gomock.Any()).Times(1).Return(tt.wantResponse, tt.wantError)
+			mockStore.EXPECT().GetBalance(gomock.Any()).
+				Times(tt.callBalanceTimes).
+				Return(&storage.BalanceEntity{Current: tt.wantBalance + tt.drift}, nil)
+
+			svc := &service.Service{Config: cfg, Log: log, Storage: mockStore}
+			handler := Ledger(svc)
+
+			req, err := http.NewRequest(GET, route, http.NoBody)
+			assert.NoError(t, err)
+
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+			resp := w.Result()
+			defer func() {
+				assert.NoError(t, resp.Body.Close())
+			}()
+			assert.Equal(t, tt.wantStatusCode, resp.StatusCode)
+
+			if tt.wantStatusCode == http.StatusOK {
+				var got ledger.Response
+				assert.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+				assert.Equal(t, tt.wantBalance, got.Balance)
+				assert.Len(t, got.Entries, len(tt.wantResponse))
+				assert.Equal(t, int64(3), got.Entries[0].ID)
+			}
+		})
+	}
+}
+
+func TestReconcileLedger(t *testing.T) {
+	log := &logger.Log{}
+	log.Initialize("DEBUG")
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := mocks.NewMockStore(ctrl)
+	gomock.InOrder(
+		mockStore.EXPECT().ReconcileLedger(gomock.Any()).Return([]storage.LedgerMismatch{
+			{UserID: "1", Balance: money.FromFloat(100.01), Ledger: money.FromFloat(100)},
+			{UserID: "2", Balance: money.FromFloat(5), Ledger: 0},
+		}, nil),
+		mockStore.EXPECT().ReconcileLedger(gomock.Any()).Return(nil, errors.New("unexpected error")),
+		mockStore.EXPECT().ReconcileLedger(gomock.Any()).Return(nil, nil),
+	)
+	svc := &service.Service{Log: log, Storage: mockStore}
+
+	assert.NoError(t, svc.ReconcileLedger(context.Background()))
+	assert.Equal(t, int64(2), svc.LedgerMismatches())
+	// the last result is kept when the reconciliation fails
+	assert.Error(t, svc.ReconcileLedger(context.Background()))
+	assert.Equal(t, int64(2), svc.LedgerMismatches())
+	assert.NoError(t, svc.ReconcileLedger(context.Background()))
+	assert.Equal(t, int64(0), svc.LedgerMismatches())
+}
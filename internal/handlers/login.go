@@ -3,7 +3,10 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 
 	"github.com/RIBorisov/gophermart/internal/models/login"
 	"github.com/RIBorisov/gophermart/internal/models/register"
@@ -39,8 +42,15 @@ func Login(svc *service.Service) http.HandlerFunc {
 
 		w.Header().Set("Content-Type", "application/json")
 
-		authToken, err := svc.LoginUser(ctx, user)
+		tokens, err := svc.LoginUser(ctx, user, clientIP(r))
 		if err != nil {
+			if writeThrottled(w, err) {
+				return
+			}
+			if errors.Is(err, service.ErrUserBlocked) {
+				http.Error(w, "Account is blocked", http.StatusForbidden)
+				return
+			}
 			if errors.Is(err, storage.ErrUserNotExists) || errors.Is(err, service.ErrIncorrectPassword) {
 				http.Error(w, "Invalid login and (or) password", http.StatusUnauthorized)
 				return
@@ -51,7 +61,23 @@ func Login(svc *service.Service) http.HandlerFunc {
 			}
 		}
 
-		w.Header().Set("Authorization", "Bearer "+authToken)
+		if tokens.TwoFactorToken != "" {
+			// no session yet, the client completes the login at /api/user/login/2fa
+			w.WriteHeader(http.StatusAccepted)
+			response = login.Response{Details: "Second factor required", TwoFactorToken: tokens.TwoFactorToken}
+			if err = json.NewEncoder(w).Encode(response); err != nil {
+				svc.Log.Err("failed encode response", err)
+			}
+			return
+		}
+
+		if err = setAuthCookies(w, svc, tokens); err != nil {
+			svc.Log.Err("failed set auth cookies", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		response.RefreshToken = tokens.RefreshToken
+		w.Header().Set("Authorization", "Bearer "+tokens.AccessToken)
 		w.WriteHeader(http.StatusOK)
 
 		if err = json.NewEncoder(w).Encode(response); err != nil {
@@ -61,3 +87,24 @@ func Login(svc *service.Service) http.HandlerFunc {
 		}
 	}
 }
+
+// writeThrottled responds with 429 and Retry-After when the attempt is made too early.
+func writeThrottled(w http.ResponseWriter, err error) bool {
+	var throttled *service.LoginThrottledError
+	if !errors.As(err, &throttled) {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+	http.Error(w, "Too many failed attempts", http.StatusTooManyRequests)
+
+	return true
+}
+
+// clientIP is the address of the connection, proxy headers aren't trusted.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
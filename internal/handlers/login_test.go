@@ -8,8 +8,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 
 	"github.com/RIBorisov/gophermart/internal/config"
@@ -28,6 +30,8 @@ func TestLoginHandler(t *testing.T) {
 	if err != nil {
 		log.Err("failed load config", err)
 	}
+	// the legacy hash below is made with this key
+	cfg.Secret.SecretKey = "Qpm9^vmz13@ja"
 
 	tests := []struct {
 		name           string
@@ -35,18 +39,23 @@ func TestLoginHandler(t *testing.T) {
 		callGetTimes   int
 		callSaveTimes  int
 		body           *register.Request
-		wantStatusCode int
-		wantError      error
-		wantResponse   interface{}
+		callTokenTimes int
+		// the legacy hash is upgraded on successful login
+		callRehashTimes int
+		wantStatusCode  int
+		wantError       error
+		wantResponse    interface{}
 	}{
 		{
-			name:           "Positive #1",
-			method:         http.MethodPost,
-			callGetTimes:   1,
-			callSaveTimes:  1,
-			body:           &register.Request{Login: "Vasiliy", Password: "pwd"},
-			wantStatusCode: http.StatusOK,
-			wantError:      nil,
+			name:            "Positive #1",
+			method:          http.MethodPost,
+			callGetTimes:    1,
+			callSaveTimes:   1,
+			body:            &register.Request{Login: "Vasiliy", Password: "pwd"},
+			callTokenTimes:  1,
+			callRehashTimes: 1,
+			wantStatusCode:  http.StatusOK,
+			wantError:       nil,
 			wantResponse: &storage.UserRow{
 				ID:       "123",
 				Login:    "Vasiliy",
@@ -94,7 +103,13 @@ func TestLoginHandler(t *testing.T) {
 
 			mockStore.EXPECT().SaveUser(gomock.Any(), gomock.Any()).Times(tt.callSaveTimes).Return("123", nil)
 
-			svc := &service.Service{Config: cfg, Log: log, Storage: mockStore}
+			mockStore.EXPECT().SaveRefreshToken(gomock.Any(), gomock.Any()).Times(tt.callTokenTimes).Return(nil)
+
+			mockStore.EXPECT().UpdatePassword(gomock.Any(), "123", gomock.Any()).Times(tt.callRehashTimes).Return(nil)
+
+			mockStore.EXPECT().GetTwoFactor(gomock.Any(), "123").Times(tt.callTokenTimes).Return(&storage.TwoFactor{}, nil)
+
+			svc := &service.Service{Config: cfg, Log: log, Storage: mockStore, Keys: testKeys(t)}
 
 			if tt.callSaveTimes > 0 {
 				_, err = mockStore.SaveUser(context.Background(), tt.body)
@@ -118,3 +133,46 @@ func TestLoginHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestLoginThrottling(t *testing.T) {
+	log := &logger.Log{}
+	log.Initialize("DEBUG")
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err)
+	cfg.Auth.LoginMaxFailures = 2
+	cfg.Auth.LoginDelayBase = time.Minute
+
+	store := storage.NewMemory()
+	svc := &service.Service{
+		Config:     cfg,
+		Log:        log,
+		Storage:    store,
+		Keys:       testKeys(t),
+		LoginGuard: service.NewLoginGuard(store, cfg.Auth),
+	}
+	_, err = svc.RegisterUser(context.Background(), &register.Request{Login: "Vasiliy", Password: "pwd"})
+	require.NoError(t, err)
+
+	login := func(pwd string) *http.Response {
+		body, err := json.Marshal(register.Request{Login: "Vasiliy", Password: pwd})
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/api/user/login", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		Login(svc)(w, req)
+		resp := w.Result()
+		require.NoError(t, resp.Body.Close())
+		return resp
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, login("wrong").StatusCode)
+
+	// the right password doesn't help while the delay lasts
+	resp := login("pwd")
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "60", resp.Header.Get("Retry-After"))
+
+	unlocked, err := svc.UnlockLogin(context.Background(), "vasiliy")
+	require.NoError(t, err)
+	assert.True(t, unlocked)
+	assert.Equal(t, http.StatusOK, login("pwd").StatusCode)
+}
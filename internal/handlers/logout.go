@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/RIBorisov/gophermart/internal/service"
+)
+
+// Logout revokes the access token of the request and the refresh tokens of its session.
+func Logout(svc *service.Service) http.HandlerFunc {
+	return logout(svc, svc.Logout)
+}
+
+// LogoutAll revokes every token of the user.
+func LogoutAll(svc *service.Service) http.HandlerFunc {
+	return logout(svc, svc.LogoutAll)
+}
+
+func logout(svc *service.Service, revoke func(context.Context, *service.Claims) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		claims, ok := service.ClaimsFromContext(ctx)
+		if !ok {
+			svc.Log.Err("failed logout", "no token claims in request context")
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+
+		if err := revoke(ctx, claims); err != nil {
+			svc.Log.Err("failed logout", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+
+		clearAuthCookies(w, svc)
+		w.WriteHeader(http.StatusOK)
+	}
+}
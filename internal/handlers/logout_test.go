@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RIBorisov/gophermart/internal/config"
+	"github.com/RIBorisov/gophermart/internal/logger"
+	"github.com/RIBorisov/gophermart/internal/models/admin"
+	"github.com/RIBorisov/gophermart/internal/models/register"
+	"github.com/RIBorisov/gophermart/internal/models/token"
+	"github.com/RIBorisov/gophermart/internal/service"
+	"github.com/RIBorisov/gophermart/internal/storage"
+)
+
+func TestLogout(t *testing.T) {
+	log := &logger.Log{}
+	log.Initialize("DEBUG")
+	cfg, err := config.LoadConfig()
+	assert.NoError(t, err)
+
+	mem := storage.NewMemory()
+	svc := &service.Service{
+		Config:      cfg,
+		Log:         log,
+		Storage:     mem,
+		Revocations: service.NewRevocationCache(time.Minute),
+		Keys:        testKeys(t),
+	}
+	router := NewRouter(svc)
+
+	userID, err := mem.SaveUser(context.Background(), &register.Request{Login: "Vasiliy", Password: "pwd"})
+	require.NoError(t, err)
+	login := func() token.Response {
+		tokens, err := svc.IssueTokens(context.Background(), userID, admin.RoleUser)
+		require.NoError(t, err)
+		return tokens
+	}
+	do := func(method, route, accessToken, body string) int {
+		req, err := http.NewRequest(method, route, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		if accessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	refreshBody := func(tokens token.Response) string {
+		return `{"refresh_token": "` + tokens.RefreshToken + `"}`
+	}
+
+	first, second := login(), login()
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/user/balance", first.AccessToken, ""))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/user/balance", second.AccessToken, ""))
+
+	// logout revokes the session only
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/user/logout", first.AccessToken, ""))
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/user/balance", first.AccessToken, ""))
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/api/user/token/refresh", "", refreshBody(first)))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/user/balance", second.AccessToken, ""))
+
+	// logout of all sessions revokes the tokens cached as valid as well
+	third := login()
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/user/balance", third.AccessToken, ""))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/user/logout/all", second.AccessToken, ""))
+	for _, tokens := range []token.Response{second, third} {
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/user/balance", tokens.AccessToken, ""))
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/api/user/token/refresh", "", refreshBody(tokens)))
+	}
+
+	// a new session works right after
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/user/balance", login().AccessToken, ""))
+}
+
+func TestCheckAuthLegacyToken(t *testing.T) {
+	log := &logger.Log{}
+	log.Initialize("DEBUG")
+	cfg, err := config.LoadConfig()
+	assert.NoError(t, err)
+
+	svc := &service.Service{Config: cfg, Log: log, Storage: storage.NewMemory(), Keys: testKeys(t)}
+	legacy, err := jwtWithoutID(svc.Keys)
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodGet, "/api/user/balance", http.NoBody)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+legacy)
+	w := httptest.NewRecorder()
+	NewRouter(svc).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+// jwtWithoutID builds the token the way it has been issued before revocation support.
+func jwtWithoutID(keys *service.KeySet) (string, error) {
+	return keys.Sign(service.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+		UserID:           "123",
+	})
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/RIBorisov/gophermart/internal/config"
 	"github.com/RIBorisov/gophermart/internal/logger"
+	"github.com/RIBorisov/gophermart/internal/models/money"
 	"github.com/RIBorisov/gophermart/internal/service"
 	"github.com/RIBorisov/gophermart/internal/storage"
 	"github.com/RIBorisov/gophermart/internal/storage/mocks"
@@ -111,9 +112,9 @@ func TestGetOrders(t *testing.T) {
 			callTimes:      1,
 			wantStatusCode: http.StatusOK,
 			wantResponse: []storage.OrderEntity{
-				{Status: "PROCESSED", OrderID: "1761025707", UserID: "123", Bonus: 150},
-				{Status: "PROCESSED", OrderID: "4657676856", UserID: "123", Bonus: 250},
-				{Status: "PROCESSED", OrderID: "2075656310", UserID: "123", Bonus: 115.55}},
+				{Status: "PROCESSED", OrderID: "1761025707", UserID: "123", Bonus: money.FromFloat(150)},
+				{Status: "PROCESSED", OrderID: "4657676856", UserID: "123", Bonus: money.FromFloat(250)},
+				{Status: "PROCESSED", OrderID: "2075656310", UserID: "123", Bonus: money.FromFloat(115.55)}},
 			wantError: nil,
 		},
 		{
@@ -128,7 +129,7 @@ func TestGetOrders(t *testing.T) {
 			callTimes:      1,
 			wantStatusCode: http.StatusInternalServerError,
 			wantResponse: []storage.OrderEntity{
-				{Status: "PROCESSED", OrderID: "1761025707", UserID: "123", Bonus: 150},
+				{Status: "PROCESSED", OrderID: "1761025707", UserID: "123", Bonus: money.FromFloat(150)},
 			},
 			wantError: errors.New("unexpected error"),
 		},
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/RIBorisov/gophermart/internal/models/password"
+	"github.com/RIBorisov/gophermart/internal/service"
+	"github.com/RIBorisov/gophermart/internal/storage"
+)
+
+// ChangePassword replaces the password and responds with tokens of a new session,
+// every other session of the user is revoked.
+func ChangePassword(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		claims, ok := service.ClaimsFromContext(ctx)
+		if !ok {
+			svc.Log.Err("failed change password", "no token claims in request context")
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+
+		var req password.ChangeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			http.Error(w, "Please, check if current and new passwords provided", http.StatusBadRequest)
+			return
+		}
+
+		tokens, err := svc.ChangePassword(ctx, claims, &req)
+		if err != nil {
+			if writeThrottled(w, err) || writePolicyError(w, svc, err) {
+				return
+			}
+			if errors.Is(err, service.ErrIncorrectPassword) {
+				http.Error(w, "Invalid current password", http.StatusForbidden)
+				return
+			}
+			svc.Log.Err("failed change password", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+
+		if err = setAuthCookies(w, svc, tokens); err != nil {
+			svc.Log.Err("failed set auth cookies", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Authorization", "Bearer "+tokens.AccessToken)
+		w.WriteHeader(http.StatusOK)
+
+		if err = json.NewEncoder(w).Encode(tokens); err != nil {
+			svc.Log.Err("failed encode tokens response", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// RequestPasswordReset responds with 202 whether the login exists or not, too frequent requests get 429.
+func RequestPasswordReset(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req password.ResetRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			http.Error(w, "Please, check if login provided", http.StatusBadRequest)
+			return
+		}
+
+		if err := svc.RequestPasswordReset(r.Context(), req.Login, clientIP(r)); err != nil {
+			if writeThrottled(w, err) {
+				return
+			}
+			svc.Log.Err("failed request password reset", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func ResetPassword(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req password.ResetConfirmRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			http.Error(w, "Please, check if reset token and new password provided", http.StatusBadRequest)
+			return
+		}
+
+		if err := svc.ResetPassword(r.Context(), &req); err != nil {
+			if writePolicyError(w, svc, err) {
+				return
+			}
+			if errors.Is(err, storage.ErrResetTokenInvalid) {
+				http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+				return
+			}
+			svc.Log.Err("failed reset password", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RIBorisov/gophermart/internal/config"
+	"github.com/RIBorisov/gophermart/internal/logger"
+	"github.com/RIBorisov/gophermart/internal/models/register"
+	"github.com/RIBorisov/gophermart/internal/models/token"
+	"github.com/RIBorisov/gophermart/internal/service"
+	"github.com/RIBorisov/gophermart/internal/storage"
+)
+
+// recordingNotifier keeps the last reset token instead of delivering it.
+type recordingNotifier struct {
+	login string
+	token string
+	calls int
+}
+
+func (n *recordingNotifier) NotifyPasswordReset(_ context.Context, login, resetToken string, _ time.Time) error {
+	n.login, n.token = login, resetToken
+	n.calls++
+	return nil
+}
+
+func TestPasswordFlows(t *testing.T) {
+	log := &logger.Log{}
+	log.Initialize("DEBUG")
+	cfg, err := config.LoadConfig()
+	assert.NoError(t, err)
+
+	notifier := &recordingNotifier{}
+	svc := &service.Service{
+		Config:      cfg,
+		Log:         log,
+		Storage:     storage.NewMemory(),
+		Keys:        testKeys(t),
+		Notifier:    notifier,
+		Revocations: service.NewRevocationCache(time.Minute),
+	}
+	router := NewRouter(svc)
+
+	do := func(method, route, accessToken, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, route, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		if accessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	login := func(pwd string) (token.Response, error) {
+		return svc.LoginUser(context.Background(), &register.Request{Login: "Vasiliy", Password: pwd}, "")
+	}
+
+	first, err := svc.RegisterUser(context.Background(), &register.Request{Login: "Vasiliy", Password: "old"})
+	require.NoError(t, err)
+	second, err := login("old")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/user/balance", second.AccessToken, "").Code)
+
+	// change
+	w := do(http.MethodPost, "/api/user/password", first.AccessToken,
+		`{"current_password": "wrong", "new_password": "changed"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = do(http.MethodPost, "/api/user/password", first.AccessToken, `{"new_password": "changed"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = do(http.MethodPost, "/api/user/password", first.AccessToken,
+		`{"current_password": "old", "new_password": "changed"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var changed token.Response
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&changed))
+
+	for _, tokens := range []token.Response{first, second} {
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/user/balance", tokens.AccessToken, "").Code)
+	}
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/user/balance", changed.AccessToken, "").Code)
+	_, err = login("old")
+	assert.ErrorIs(t, err, service.ErrIncorrectPassword)
+	_, err = login("changed")
+	assert.NoError(t, err)
+
+	// reset of unknown login isn't distinguishable
+	assert.Equal(t, http.StatusAccepted, do(http.MethodPost, "/api/user/password/reset", "", `{"login": "Petr"}`).Code)
+	assert.Equal(t, 0, notifier.calls)
+
+	assert.Equal(t, http.StatusAccepted, do(http.MethodPost, "/api/user/password/reset", "", `{"login": "Vasiliy"}`).Code)
+	require.Equal(t, 1, notifier.calls)
+	assert.Equal(t, "Vasiliy", notifier.login)
+
+	confirm := func(resetToken string) int {
+		return do(http.MethodPost, "/api/user/password/reset/confirm", "",
+			`{"token": "`+resetToken+`", "new_password": "reset"}`).Code
+	}
+	assert.Equal(t, http.StatusBadRequest, confirm("forged"))
+	assert.Equal(t, http.StatusOK, confirm(notifier.token))
+	assert.Equal(t, http.StatusBadRequest, confirm(notifier.token))
+
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/user/balance", changed.AccessToken, "").Code)
+	_, err = login("changed")
+	assert.ErrorIs(t, err, service.ErrIncorrectPassword)
+	_, err = login("reset")
+	assert.NoError(t, err)
+}
+
+func TestPasswordThrottling(t *testing.T) {
+	log := &logger.Log{}
+	log.Initialize("DEBUG")
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err)
+
+	notifier := &recordingNotifier{}
+	store := storage.NewMemory()
+	svc := &service.Service{
+		Config:     cfg,
+		Log:        log,
+		Storage:    store,
+		Keys:       testKeys(t),
+		Notifier:   notifier,
+		LoginGuard: service.NewLoginGuard(store, cfg.Auth),
+	}
+	router := NewRouter(svc)
+
+	do := func(route, accessToken, body string) int {
+		req := httptest.NewRequest(http.MethodPost, route, bytes.NewBufferString(body))
+		if accessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	registered, err := svc.RegisterUser(context.Background(), &register.Request{Login: "Vasiliy", Password: "old"})
+	require.NoError(t, err)
+
+	// the current password is guessed no faster than a login
+	assert.Equal(t, http.StatusForbidden, do("/api/user/password", registered.AccessToken,
+		`{"current_password": "wrong", "new_password": "changed"}`))
+	assert.Equal(t, http.StatusTooManyRequests, do("/api/user/password", registered.AccessToken,
+		`{"current_password": "old", "new_password": "changed"}`))
+
+	// repeated reset requests are throttled whether the login exists or not, the sent token stays valid
+	assert.Equal(t, http.StatusAccepted, do("/api/user/password/reset", "", `{"login": "Vasiliy"}`))
+	require.Equal(t, 1, notifier.calls)
+	assert.Equal(t, http.StatusTooManyRequests, do("/api/user/password/reset", "", `{"login": "Vasiliy"}`))
+	assert.Equal(t, http.StatusAccepted, do("/api/user/password/reset", "", `{"login": "Petr"}`))
+	assert.Equal(t, http.StatusTooManyRequests, do("/api/user/password/reset", "", `{"login": "Petr"}`))
+	assert.Equal(t, 1, notifier.calls)
+
+	assert.Equal(t, http.StatusOK, do("/api/user/password/reset/confirm", "",
+		`{"token": "`+notifier.token+`", "new_password": "reset"}`))
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/RIBorisov/gophermart/internal/models/policy"
+	"github.com/RIBorisov/gophermart/internal/service"
+)
+
+// writePolicyError responds with 400 listing the violated rules when err is *service.PolicyError.
+func writePolicyError(w http.ResponseWriter, svc *service.Service, err error) bool {
+	var policyErr *service.PolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	if err = json.NewEncoder(w).Encode(policy.Response{Errors: policyErr.Violations}); err != nil {
+		svc.Log.Err("failed encode policy violations", err)
+	}
+
+	return true
+}
@@ -27,31 +27,42 @@ func Register(svc *service.Service) http.HandlerFunc {
 			return
 		}
 
-		if err := user.Validate(); err != nil {
+		// the policy checks the login and the password on top of this, it doesn't replace the check
+		if user == nil || user.Validate() != nil {
 			http.Error(w, "Please, check if login and password provided", http.StatusBadRequest)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 
-		authToken, err := svc.RegisterUser(ctx, user)
+		tokens, err := svc.RegisterUser(ctx, user)
 
 		if err != nil {
+			if writePolicyError(w, svc, err) {
+				return
+			}
 			if errors.Is(err, storage.ErrUserExists) {
 				http.Error(w, "User already exists", http.StatusConflict)
 				return
 			} else {
 				svc.Log.Err("failed register user", err)
 				http.Error(w, "", http.StatusInternalServerError)
+				return
 			}
 		}
 
-		w.Header().Set("Authorization", "Bearer "+authToken)
+		if err = setAuthCookies(w, svc, tokens); err != nil {
+			svc.Log.Err("failed set auth cookies", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Authorization", "Bearer "+tokens.AccessToken)
 		w.WriteHeader(http.StatusOK)
 
 		response := register.Response{
-			Success: true,
-			Details: fmt.Sprintf("Successfully registered user with name '%s'", user.Login),
+			Success:      true,
+			Details:      fmt.Sprintf("Successfully registered user with name '%s'", user.Login),
+			RefreshToken: tokens.RefreshToken,
 		}
 
 		if err = json.NewEncoder(w).Encode(response); err != nil {
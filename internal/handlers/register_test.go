@@ -2,17 +2,22 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 
 	"github.com/RIBorisov/gophermart/internal/config"
 	"github.com/RIBorisov/gophermart/internal/logger"
+	"github.com/RIBorisov/gophermart/internal/models/policy"
+	"github.com/RIBorisov/gophermart/internal/models/register"
 	"github.com/RIBorisov/gophermart/internal/service"
 	"github.com/RIBorisov/gophermart/internal/storage"
 	"github.com/RIBorisov/gophermart/internal/storage/mocks"
@@ -32,6 +37,7 @@ func TestRegisterHandler(t *testing.T) {
 		method         string
 		callTimes      int
 		body           map[string]string
+		callTokenTimes int
 		wantStatusCode int
 		wantError      error
 	}{
@@ -43,6 +49,7 @@ func TestRegisterHandler(t *testing.T) {
 				"login":    "Oleg",
 				"password": "1kOp0x,^",
 			},
+			callTokenTimes: 1,
 			wantStatusCode: http.StatusOK,
 			wantError:      nil,
 		},
@@ -87,7 +94,9 @@ func TestRegisterHandler(t *testing.T) {
 			defer ctrl.Finish()
 
 			mockStore := mocks.NewMockStore(ctrl)
-			svc := &service.Service{Config: cfg, Log: log, Storage: mockStore}
+			mockStore.EXPECT().SaveRefreshToken(gomock.Any(), gomock.Any()).Times(tt.callTokenTimes).Return(nil)
+
+			svc := &service.Service{Config: cfg, Log: log, Storage: mockStore, Keys: testKeys(t)}
 
 			mockStore.EXPECT().
 				SaveUser(gomock.Any(), gomock.Any()).
@@ -111,3 +120,79 @@ func TestRegisterHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestRegisterPolicy(t *testing.T) {
+	const route = "/api/user/register"
+	log := &logger.Log{}
+	log.Initialize("DEBUG")
+	cfg, err := config.LoadConfig()
+	assert.NoError(t, err)
+
+	pol, err := service.NewPolicy(cfg.Policy)
+	require.NoError(t, err)
+	mem := storage.NewMemory()
+	svc := &service.Service{Config: cfg, Log: log, Storage: mem, Keys: testKeys(t), Policy: pol}
+
+	// registered before the policy, so the login isn't normalized
+	legacy := &service.Service{Config: cfg, Log: log, Storage: mem, Keys: testKeys(t)}
+	_, err = legacy.RegisterUser(context.Background(), &register.Request{Login: "Legacy", Password: "pwd"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		body           string
+		wantStatusCode int
+		wantViolations []policy.Violation
+	}{
+		{
+			name:           "Positive #1",
+			body:           `{"login": " Vasiliy ", "password": "1kOp0x,^"}`,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "Negative #1 (normalized login exists)",
+			body:           `{"login": "VASILIY", "password": "1kOp0x,^"}`,
+			wantStatusCode: http.StatusConflict,
+		},
+		{
+			name:           "Negative #2 (every violation listed)",
+			body:           `{"login": "va", "password": "111"}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantViolations: []policy.Violation{
+				{Field: policy.FieldLogin, Rule: policy.RuleMinLength, Message: "login must be at least 3 characters long"},
+				{Field: policy.FieldPassword, Rule: policy.RuleMinLength, Message: "password must be at least 8 characters long"},
+			},
+		},
+		{
+			name:           "Negative #3 (missing fields)",
+			body:           `{}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "Negative #4 (null body)",
+			body:           `null`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, route, strings.NewReader(tt.body))
+			require.NoError(t, err)
+			w := httptest.NewRecorder()
+			Register(svc)(w, req)
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			if tt.wantViolations != nil {
+				var resp policy.Response
+				require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+				assert.Equal(t, tt.wantViolations, resp.Errors)
+			}
+		})
+	}
+
+	// login is normalized on sign in as well, while legacy logins are still found as is
+	_, err = svc.LoginUser(context.Background(), &register.Request{Login: "vasiliy", Password: "1kOp0x,^"}, "")
+	assert.NoError(t, err)
+	_, err = svc.LoginUser(context.Background(), &register.Request{Login: "Legacy", Password: "pwd"}, "")
+	assert.NoError(t, err)
+}
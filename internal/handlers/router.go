@@ -5,6 +5,7 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 
 	myMW "github.com/RIBorisov/gophermart/internal/middleware"
+	"github.com/RIBorisov/gophermart/internal/models/admin"
 	"github.com/RIBorisov/gophermart/internal/service"
 )
 
@@ -13,8 +14,14 @@ func NewRouter(svc *service.Service) *chi.Mux {
 	router.Use(middleware.Logger)
 	router.Use(middleware.Recoverer)
 
+	router.Get("/health", Health(svc))
+	router.Get("/.well-known/jwks.json", JWKS(svc))
 	router.Post("/api/user/register", Register(svc))
 	router.Post("/api/user/login", Login(svc))
+	router.Post("/api/user/login/2fa", LoginTwoFactor(svc))
+	router.Post("/api/user/token/refresh", RefreshToken(svc))
+	router.Post("/api/user/password/reset", RequestPasswordReset(svc))
+	router.Post("/api/user/password/reset/confirm", ResetPassword(svc))
 	router.Route("/api/user", func(r chi.Router) {
 		r.Use(myMW.CheckAuth(svc).Middleware)
 		r.Post("/orders", CreateOrder(svc))
@@ -22,7 +29,41 @@ func NewRouter(svc *service.Service) *chi.Mux {
 		r.Get("/balance", CurrentBalance(svc))
 		r.Post("/balance/withdraw", BalanceWithdraw(svc))
 		r.With(myMW.Compression(svc.Log).Middleware).Get("/withdrawals", Withdrawals(svc))
+		r.With(myMW.Compression(svc.Log).Middleware).Get("/ledger", Ledger(svc))
+		r.Post("/logout", Logout(svc))
+		r.Post("/logout/all", LogoutAll(svc))
+		r.Post("/password", ChangePassword(svc))
+		r.Post("/2fa/enroll", EnrollTwoFactor(svc))
+		r.Post("/2fa/confirm", ConfirmTwoFactor(svc))
+		r.Post("/2fa/disable", DisableTwoFactor(svc))
 	})
+	router.Route("/api/admin", func(r chi.Router) {
+		r.Use(myMW.CheckAuth(svc).Middleware)
+		r.Use(myMW.RequireRole(svc, admin.RoleSupport).Middleware)
+		r.Get("/users", SearchUsers(svc))
+		r.Get("/users/{userID}", GetUser(svc))
+		r.Get("/users/{userID}/orders", GetUserOrders(svc))
+		r.Get("/users/{userID}/withdrawals", GetUserWithdrawals(svc))
+		r.Get("/users/{userID}/balance", GetUserBalance(svc))
+		r.Post("/users/{userID}/unlock", UnlockUserLogin(svc))
+		r.Get("/users/{userID}/adjustments", GetUserAdjustments(svc))
+		r.Group(func(r chi.Router) {
+			r.Use(myMW.RequireRole(svc, admin.RoleAdmin).Middleware)
+			r.Post("/users/{userID}/block", BlockUser(svc))
+			r.Post("/users/{userID}/unblock", UnblockUser(svc))
+			r.Put("/users/{userID}/role", SetUserRole(svc))
+			r.Post("/users/{userID}/adjustments", AdjustUserBalance(svc))
+		})
+	})
+
+	// metrics expose the order pipeline state, so they are scraped with the static token, not a user session
+	if svc.Config.Secret.MetricsToken != "" {
+		router.With(myMW.RequireScrapeToken(svc).Middleware).Get("/metrics", Metrics(svc))
+	}
+	if svc.Config.Secret.AccrualWebhookKey != "" {
+		router.With(myMW.VerifyAccrualSignature(svc).Middleware).
+			Post("/internal/accrual/callback", AccrualCallback(svc))
+	}
 
 	return router
 }
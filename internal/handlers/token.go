@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/RIBorisov/gophermart/internal/models/token"
+	"github.com/RIBorisov/gophermart/internal/service"
+	"github.com/RIBorisov/gophermart/internal/storage"
+)
+
+func RefreshToken(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req token.RefreshRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			http.Error(w, "Please, check if refresh token provided", http.StatusBadRequest)
+			return
+		}
+
+		tokens, err := svc.RefreshTokens(r.Context(), req.RefreshToken)
+		if err != nil {
+			switch {
+			case errors.Is(err, storage.ErrRefreshTokenReused):
+				svc.Log.Warn("refresh token reuse detected, token family is revoked")
+				http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			case errors.Is(err, service.ErrUserBlocked):
+				http.Error(w, "Account is blocked", http.StatusForbidden)
+			case errors.Is(err, storage.ErrRefreshTokenInvalid):
+				http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			default:
+				svc.Log.Err("failed refresh tokens", err)
+				http.Error(w, "", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if err = setAuthCookies(w, svc, tokens); err != nil {
+			svc.Log.Err("failed set auth cookies", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Authorization", "Bearer "+tokens.AccessToken)
+		w.WriteHeader(http.StatusOK)
+
+		if err = json.NewEncoder(w).Encode(tokens); err != nil {
+			svc.Log.Err("failed encode tokens response", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+	}
+}
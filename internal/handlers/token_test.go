@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RIBorisov/gophermart/internal/config"
+	"github.com/RIBorisov/gophermart/internal/logger"
+	"github.com/RIBorisov/gophermart/internal/models/admin"
+	"github.com/RIBorisov/gophermart/internal/models/register"
+	"github.com/RIBorisov/gophermart/internal/models/token"
+	"github.com/RIBorisov/gophermart/internal/service"
+	"github.com/RIBorisov/gophermart/internal/storage"
+)
+
+func TestRefreshToken(t *testing.T) {
+	const route = "/api/user/token/refresh"
+	log := &logger.Log{}
+	log.Initialize("DEBUG")
+	cfg, err := config.LoadConfig()
+	assert.NoError(t, err)
+
+	mem := storage.NewMemory()
+	svc := &service.Service{Config: cfg, Log: log, Storage: mem, Keys: testKeys(t)}
+	handler := RefreshToken(svc)
+
+	userID, err := mem.SaveUser(context.Background(), &register.Request{Login: "Vasiliy", Password: "pwd"})
+	require.NoError(t, err)
+	issued, err := svc.IssueTokens(context.Background(), userID, admin.RoleUser)
+	require.NoError(t, err)
+
+	refresh := func(body string) (*httptest.ResponseRecorder, token.Response) {
+		req, err := http.NewRequest(http.MethodPost, route, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		handler(w, req)
+
+		var got token.Response
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+		}
+		return w, got
+	}
+	body := func(refreshToken string) string {
+		return `{"refresh_token": "` + refreshToken + `"}`
+	}
+
+	w, rotated := refresh(body(issued.RefreshToken))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Bearer "+rotated.AccessToken, w.Header().Get("Authorization"))
+	assert.NotEqual(t, issued.RefreshToken, rotated.RefreshToken)
+	assert.Equal(t, int64(cfg.Auth.AccessTokenTTL.Seconds()), rotated.ExpiresIn)
+
+	w, next := refresh(body(rotated.RefreshToken))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// reuse of the rotated token revokes the whole family including the latest token
+	w, _ = refresh(body(rotated.RefreshToken))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w, _ = refresh(body(next.RefreshToken))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// another session of the user is not affected
+	another, err := svc.IssueTokens(context.Background(), userID, admin.RoleUser)
+	require.NoError(t, err)
+	w, _ = refresh(body(another.RefreshToken))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w, _ = refresh(body("unknown"))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w, _ = refresh(`{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w, _ = refresh(`not json`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
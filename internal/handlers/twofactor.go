@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/RIBorisov/gophermart/internal/models/login"
+	"github.com/RIBorisov/gophermart/internal/models/twofactor"
+	"github.com/RIBorisov/gophermart/internal/service"
+	"github.com/RIBorisov/gophermart/internal/storage"
+)
+
+// EnrollTwoFactor responds with the TOTP secret by the current password, the second factor isn't required
+// until it is confirmed.
+func EnrollTwoFactor(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		claims, ok := service.ClaimsFromContext(ctx)
+		if !ok {
+			svc.Log.Err("failed enroll two-factor", "no token claims in request context")
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+
+		var req twofactor.EnrollRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			http.Error(w, "Please, check if password provided", http.StatusBadRequest)
+			return
+		}
+
+		enrollment, err := svc.EnrollTwoFactor(ctx, claims, req.Password)
+		if err != nil {
+			if writeThrottled(w, err) {
+				return
+			}
+			switch {
+			case errors.Is(err, storage.ErrTwoFactorEnabled):
+				http.Error(w, "Two-factor authentication is enabled already", http.StatusConflict)
+				return
+			case errors.Is(err, service.ErrIncorrectPassword):
+				http.Error(w, "Invalid password", http.StatusForbidden)
+				return
+			}
+			svc.Log.Err("failed enroll two-factor", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		if err = json.NewEncoder(w).Encode(enrollment); err != nil {
+			svc.Log.Err("failed encode enrollment response", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// ConfirmTwoFactor enables the second factor by the first code and responds with recovery codes.
+func ConfirmTwoFactor(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		claims, ok := service.ClaimsFromContext(ctx)
+		if !ok {
+			svc.Log.Err("failed confirm two-factor", "no token claims in request context")
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+
+		var req twofactor.CodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			http.Error(w, "Please, check if code provided", http.StatusBadRequest)
+			return
+		}
+
+		codes, err := svc.ConfirmTwoFactor(ctx, claims, req.Code)
+		if err != nil {
+			switch {
+			case errors.Is(err, storage.ErrTwoFactorEnabled):
+				http.Error(w, "Two-factor authentication is enabled already", http.StatusConflict)
+			case errors.Is(err, service.ErrTwoFactorNotEnrolled):
+				http.Error(w, "Two-factor authentication is not enrolled", http.StatusConflict)
+			case errors.Is(err, service.ErrInvalidTwoFactorCode):
+				http.Error(w, "Invalid code", http.StatusForbidden)
+			default:
+				svc.Log.Err("failed confirm two-factor", err)
+				http.Error(w, "", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		if err = json.NewEncoder(w).Encode(twofactor.ConfirmResponse{RecoveryCodes: codes}); err != nil {
+			svc.Log.Err("failed encode recovery codes response", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// DisableTwoFactor turns the second factor off by a TOTP or recovery code.
+func DisableTwoFactor(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		claims, ok := service.ClaimsFromContext(ctx)
+		if !ok {
+			svc.Log.Err("failed disable two-factor", "no token claims in request context")
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+
+		var req twofactor.CodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			http.Error(w, "Please, check if code provided", http.StatusBadRequest)
+			return
+		}
+
+		if err := svc.DisableTwoFactor(ctx, claims, req.Code); err != nil {
+			if writeThrottled(w, err) {
+				return
+			}
+			switch {
+			case errors.Is(err, service.ErrTwoFactorDisabled):
+				http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+			case errors.Is(err, service.ErrInvalidTwoFactorCode):
+				http.Error(w, "Invalid code", http.StatusForbidden)
+			default:
+				svc.Log.Err("failed disable two-factor", err)
+				http.Error(w, "", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// LoginTwoFactor completes the login started with the password, it responds the same way as Login.
+func LoginTwoFactor(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req twofactor.LoginRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			http.Error(w, "Please, check if two-factor token and code provided", http.StatusBadRequest)
+			return
+		}
+
+		tokens, err := svc.CompleteLogin(r.Context(), &req, clientIP(r))
+		if err != nil {
+			if writeThrottled(w, err) {
+				return
+			}
+			if errors.Is(err, service.ErrUserBlocked) {
+				http.Error(w, "Account is blocked", http.StatusForbidden)
+				return
+			}
+			if errors.Is(err, service.ErrInvalidTwoFactorToken) || errors.Is(err, service.ErrInvalidTwoFactorCode) {
+				http.Error(w, "Invalid two-factor token and (or) code", http.StatusUnauthorized)
+				return
+			}
+			svc.Log.Err("failed complete login", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+
+		if err = setAuthCookies(w, svc, tokens); err != nil {
+			svc.Log.Err("failed set auth cookies", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Authorization", "Bearer "+tokens.AccessToken)
+		w.WriteHeader(http.StatusOK)
+
+		response := login.Response{
+			Success:      true,
+			Details:      "Successfully logged in",
+			RefreshToken: tokens.RefreshToken,
+		}
+		if err = json.NewEncoder(w).Encode(response); err != nil {
+			svc.Log.Err("failed encode response", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+	}
+}
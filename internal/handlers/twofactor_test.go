@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RIBorisov/gophermart/internal/config"
+	"github.com/RIBorisov/gophermart/internal/logger"
+	"github.com/RIBorisov/gophermart/internal/models"
+	"github.com/RIBorisov/gophermart/internal/models/login"
+	"github.com/RIBorisov/gophermart/internal/models/money"
+	"github.com/RIBorisov/gophermart/internal/models/register"
+	"github.com/RIBorisov/gophermart/internal/models/twofactor"
+	"github.com/RIBorisov/gophermart/internal/service"
+	"github.com/RIBorisov/gophermart/internal/storage"
+)
+
+func TestTwoFactorLogin(t *testing.T) {
+	log := &logger.Log{}
+	log.Initialize("DEBUG")
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err)
+	cfg.Auth.WithdrawTwoFactorThreshold = money.FromFloat(100)
+
+	store := storage.NewMemory()
+	svc := &service.Service{
+		Config:      cfg,
+		Log:         log,
+		Storage:     store,
+		Keys:        testKeys(t),
+		Revocations: service.NewRevocationCache(time.Minute),
+	}
+	router := NewRouter(svc)
+
+	do := func(route, accessToken, body string, header ...string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, route, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		if accessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	registered, err := svc.RegisterUser(context.Background(), &register.Request{Login: "Vasiliy", Password: "pwd"})
+	require.NoError(t, err)
+	claims, err := svc.ParseToken(registered.AccessToken)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusBadRequest, do("/api/user/2fa/enroll", registered.AccessToken, `{}`).Code)
+	assert.Equal(t, http.StatusForbidden,
+		do("/api/user/2fa/enroll", registered.AccessToken, `{"password": "wrong"}`).Code)
+	w := do("/api/user/2fa/enroll", registered.AccessToken, `{"password": "pwd"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var enrollment twofactor.EnrollResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&enrollment))
+	assert.NotEmpty(t, enrollment.Secret)
+	assert.Contains(t, enrollment.URI, "otpauth://totp/Gophermart:Vasiliy?")
+	assert.Equal(t, http.StatusForbidden, do("/api/user/2fa/confirm", registered.AccessToken, `{"code": "ABCD"}`).Code)
+
+	// confirm the enrollment with the known recovery code instead of the TOTP one
+	recoveryHash := sha256.Sum256([]byte("AAAABBBBCCCCDDDD"))
+	require.NoError(t, store.EnableTwoFactor(context.Background(), claims.UserID, 0, [][]byte{recoveryHash[:]}))
+	assert.Equal(t, http.StatusConflict, do("/api/user/2fa/enroll", registered.AccessToken, `{"password": "pwd"}`).Code)
+
+	withdraw := `{"order": "2377225624", "sum": 150}`
+	assert.Equal(t, http.StatusForbidden, do("/api/user/balance/withdraw", registered.AccessToken, withdraw).Code)
+	assert.Equal(t, http.StatusForbidden, do("/api/user/balance/withdraw", registered.AccessToken, withdraw,
+		models.TwoFactorCodeHeader, "123456").Code)
+
+	w = do("/api/user/login", "", `{"login": "Vasiliy", "password": "pwd"}`)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	assert.Empty(t, w.Header().Get("Authorization"))
+	var challenge login.Response
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&challenge))
+	require.NotEmpty(t, challenge.TwoFactorToken)
+
+	// the challenge token isn't an access token
+	assert.Equal(t, http.StatusUnauthorized, do("/api/user/logout", challenge.TwoFactorToken, "").Code)
+
+	complete := func(code string) *httptest.ResponseRecorder {
+		return do("/api/user/login/2fa", "", `{"two_factor_token": "`+challenge.TwoFactorToken+`", "code": "`+code+`"}`)
+	}
+	assert.Equal(t, http.StatusUnauthorized, complete("000000").Code)
+	w = complete("aaaa-bbbb-cccc-dddd")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Authorization"))
+	assert.Equal(t, http.StatusUnauthorized, complete("aaaa-bbbb-cccc-dddd").Code)
+}
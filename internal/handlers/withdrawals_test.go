@@ -12,6 +12,7 @@ import (
 
 	"github.com/RIBorisov/gophermart/internal/config"
 	"github.com/RIBorisov/gophermart/internal/logger"
+	"github.com/RIBorisov/gophermart/internal/models/money"
 	"github.com/RIBorisov/gophermart/internal/service"
 	"github.com/RIBorisov/gophermart/internal/storage"
 	"github.com/RIBorisov/gophermart/internal/storage/mocks"
@@ -43,13 +44,13 @@ func TestWithdrawals(t *testing.T) {
 					ProcessedAt: now,
 					UserID:      "123",
 					OrderID:     "5116141762",
-					Amount:      150.99,
+					Amount:      money.FromFloat(150.99),
 				},
 				{
 					ProcessedAt: now,
 					UserID:      "123",
 					OrderID:     "5830317037",
-					Amount:      15.75,
+					Amount:      money.FromFloat(15.75),
 				},
 			},
 			wantError: nil,
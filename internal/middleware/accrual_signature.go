@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RIBorisov/gophermart/internal/logger"
+	"github.com/RIBorisov/gophermart/internal/service"
+)
+
+const (
+	AccrualTimestampHeader = "X-Accrual-Timestamp"
+	AccrualSignatureHeader = "X-Accrual-Signature"
+	// maxAccrualCallbackBody limits the body read before the signature is verified.
+	maxAccrualCallbackBody = 64 << 10
+)
+
+// AccrualSignature authenticates accrual system callbacks. The callback carries unix timestamp and
+// hex encoded HMAC-SHA256 of "<timestamp>.<body>" made with the shared key. Callbacks outside of the
+// replay window are rejected, as well as repeated signatures inside it unless the previous delivery failed.
+type AccrualSignature struct {
+	seen map[string]time.Time
+	// now is replaced in tests
+	now    func() time.Time
+	log    *logger.Log
+	key    []byte
+	window time.Duration
+	mu     sync.Mutex
+}
+
+func VerifyAccrualSignature(svc *service.Service) *AccrualSignature {
+	return &AccrualSignature{
+		seen:   make(map[string]time.Time),
+		now:    time.Now,
+		log:    svc.Log,
+		key:    []byte(svc.Config.Secret.AccrualWebhookKey),
+		window: svc.Config.Service.AccrualWebhookWindow,
+	}
+}
+
+// SignAccrualCallback returns the signature of the callback body sent at timestamp.
+func SignAccrualCallback(key []byte, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (a *AccrualSignature) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		const accessDenied = "Access Denied"
+
+		signature := r.Header.Get(AccrualSignatureHeader)
+		timestamp, err := strconv.ParseInt(r.Header.Get(AccrualTimestampHeader), 10, 64)
+		if err != nil || signature == "" {
+			a.log.Err(accessDenied, "accrual callback is not signed")
+			http.Error(w, accessDenied, http.StatusUnauthorized)
+			return
+		}
+		sentAt := time.Unix(timestamp, 0)
+		if age := a.now().Sub(sentAt); age > a.window || age < -a.window {
+			a.log.Err(accessDenied, "accrual callback timestamp is out of replay window")
+			http.Error(w, accessDenied, http.StatusUnauthorized)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAccrualCallbackBody))
+		if err != nil {
+			var errTooLarge *http.MaxBytesError
+			if errors.As(err, &errTooLarge) {
+				a.log.Warn("rejected too large accrual callback", "limit", errTooLarge.Limit)
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			a.log.Err("failed read request body", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		if !hmac.Equal([]byte(signature), []byte(SignAccrualCallback(a.key, timestamp, body))) {
+			a.log.Err(accessDenied, "accrual callback signature mismatch")
+			http.Error(w, accessDenied, http.StatusUnauthorized)
+			return
+		}
+		if !a.remember(signature, sentAt) {
+			a.log.Warn("rejected replayed accrual callback", "timestamp", timestamp)
+			http.Error(w, "Replayed callback", http.StatusConflict)
+			return
+		}
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(sw, r)
+
+		if sw.status >= http.StatusInternalServerError {
+			// the delivery failed, so the accrual system is allowed to retry it as is
+			a.forget(signature)
+		}
+	})
+}
+
+// remember returns false when the signature has been seen already. Signatures older than the replay
+// window are dropped, because such callbacks are rejected by timestamp anyway.
+func (a *AccrualSignature) remember(signature string, sentAt time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for s, t := range a.seen {
+		if a.now().Sub(t) > a.window {
+			delete(a.seen, s)
+		}
+	}
+	if _, ok := a.seen[signature]; ok {
+		return false
+	}
+	a.seen[signature] = sentAt
+
+	return true
+}
+
+func (a *AccrualSignature) forget(signature string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.seen, signature)
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(statusCode int) {
+	w.status = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
@@ -2,12 +2,11 @@ package middleware
 
 import (
 	"context"
-	"fmt"
+	"crypto/subtle"
+	"errors"
 	"net/http"
+	"strings"
 
-	"github.com/golang-jwt/jwt/v4"
-
-	"github.com/RIBorisov/gophermart/internal/logger"
 	"github.com/RIBorisov/gophermart/internal/models"
 	"github.com/RIBorisov/gophermart/internal/service"
 )
@@ -25,42 +24,106 @@ func (a *Auth) Middleware(next http.Handler) http.Handler {
 		const accessDenied = "Access Denied"
 		rCtx := r.Context()
 
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			a.Service.Log.Err(accessDenied, "Authorization header has not provided")
+		tokenString, fromCookie, err := tokenFromRequest(r)
+		if err != nil {
+			a.Service.Log.Err(accessDenied, err)
 			http.Error(w, accessDenied, http.StatusUnauthorized)
 			return
 		}
+		if fromCookie && !safeMethod(r.Method) && !validCSRF(r) {
+			a.Service.Log.Err(accessDenied, "CSRF token is missing or doesn't match")
+			http.Error(w, accessDenied, http.StatusForbidden)
+			return
+		}
 
-		userID := getUserID(authHeader[7:], a.Service.Config.Secret.SecretKey, a.Service.Log)
-		if userID == "" {
-			a.Service.Log.Err(accessDenied, "Authorization header contains no userID")
+		claims := getClaims(a.Service, tokenString)
+		if claims == nil || claims.UserID == "" {
+			a.Service.Log.Err(accessDenied, "Access token contains no userID")
+			http.Error(w, accessDenied, http.StatusUnauthorized)
+			return
+		}
+		if claims.Scope != "" {
+			// e.g. the token waiting for the second factor isn't an access token
+			a.Service.Log.Err(accessDenied, "Token is limited to scope "+claims.Scope)
+			http.Error(w, accessDenied, http.StatusUnauthorized)
+			return
+		}
+		if err = a.Service.CheckToken(rCtx, claims); err != nil {
+			if !errors.Is(err, service.ErrTokenRevoked) {
+				a.Service.Log.Err("failed check token", err)
+				http.Error(w, "", http.StatusInternalServerError)
+				return
+			}
+			a.Service.Log.Err(accessDenied, err)
 			http.Error(w, accessDenied, http.StatusUnauthorized)
 			return
 		}
 
-		newCtx := context.WithValue(rCtx, models.CtxUserIDKey, userID)
+		newCtx := context.WithValue(rCtx, models.CtxUserIDKey, claims.UserID)
+		newCtx = context.WithValue(newCtx, models.CtxClaimsKey, claims)
 		rWithCtx := r.WithContext(newCtx)
 		next.ServeHTTP(w, rWithCtx)
 	})
 }
 
-func getUserID(tokenString, secretKey string, log *logger.Log) string {
-	claims := &service.Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
-		}
-		return []byte(secretKey), nil
-	})
-	if err != nil {
-		log.Err("failed parse with claims tokenString: ", err)
-		return ""
+// tokenFromRequest takes the token from the Authorization header or, when there is no header, from the cookie.
+// Malformed header is rejected rather than falling back to the cookie.
+func tokenFromRequest(r *http.Request) (token string, fromCookie bool, err error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		token, err = parseBearer(header)
+		return token, false, err
+	}
+
+	cookie, err := r.Cookie(models.AccessTokenCookie)
+	if err != nil || cookie.Value == "" {
+		return "", false, errNoToken
+	}
+
+	return cookie.Value, true, nil
+}
+
+func parseBearer(header string) (string, error) {
+	const scheme = "Bearer"
+
+	prefix, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(prefix, scheme) {
+		return "", errMalformedHeader
+	}
+	token = strings.TrimSpace(token)
+	if token == "" || strings.ContainsAny(token, " \t") {
+		return "", errMalformedHeader
+	}
+
+	return token, nil
+}
+
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// validCSRF implements double-submit check: another site can make the browser send the cookies,
+// but can't read the CSRF cookie to put its value into the header.
+func validCSRF(r *http.Request) bool {
+	cookie, err := r.Cookie(models.CSRFCookie)
+	if err != nil || cookie.Value == "" {
+		return false
 	}
-	if !token.Valid {
-		log.Err("Token is not valid: ", token)
-		return ""
+	header := r.Header.Get(models.CSRFHeader)
+
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) == 1
+}
+
+func getClaims(svc *service.Service, tokenString string) *service.Claims {
+	claims, err := svc.ParseToken(tokenString)
+	if err != nil {
+		svc.Log.Err("failed parse with claims tokenString: ", err)
+		return nil
 	}
 
-	return claims.UserID
+	return claims
 }
+
+var (
+	errNoToken         = errors.New("neither Authorization header nor access token cookie provided")
+	errMalformedHeader = errors.New("malformed Authorization header, expected 'Bearer <token>'")
+)
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/RIBorisov/gophermart/internal/models/admin"
+	"github.com/RIBorisov/gophermart/internal/service"
+)
+
+// Roles lets through requests authenticated by CheckAuth with a token of the required role or a higher one.
+type Roles struct {
+	Service  *service.Service
+	Required admin.Role
+}
+
+func RequireRole(svc *service.Service, required admin.Role) *Roles {
+	return &Roles{Service: svc, Required: required}
+}
+
+func (ro *Roles) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		const forbidden = "Forbidden"
+
+		claims, ok := service.ClaimsFromContext(r.Context())
+		if !ok {
+			ro.Service.Log.Err("failed check role", "no token claims in request context")
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		if !claims.Role.Includes(ro.Required) {
+			ro.Service.Log.Warn("role is insufficient", "user_id", claims.UserID, "role", claims.Role,
+				"required", ro.Required, "path", r.URL.Path)
+			http.Error(w, forbidden, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/RIBorisov/gophermart/internal/logger"
+	"github.com/RIBorisov/gophermart/internal/service"
+)
+
+// ScrapeToken lets through requests carrying the static METRICS_TOKEN as the bearer token, so metrics are
+// scraped without user sessions, which expire and need refresh token rotation.
+type ScrapeToken struct {
+	log   *logger.Log
+	token []byte
+}
+
+func RequireScrapeToken(svc *service.Service) *ScrapeToken {
+	return &ScrapeToken{log: svc.Log, token: []byte(svc.Config.Secret.MetricsToken)}
+}
+
+func (s *ScrapeToken) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), s.token) != 1 {
+			s.log.Warn("invalid scrape token", "path", r.URL.Path)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -3,6 +3,7 @@ package accrual
 import (
 	"errors"
 
+	"github.com/RIBorisov/gophermart/internal/models/money"
 	"github.com/RIBorisov/gophermart/internal/models/orders"
 )
 
@@ -16,9 +17,9 @@ const (
 )
 
 type OrderInfoResponse struct {
-	Order   string  `json:"order"`
-	Status  Status  `json:"status"`
-	Accrual float32 `json:"accrual"`
+	Order   string       `json:"order"`
+	Status  Status       `json:"status"`
+	Accrual money.Amount `json:"accrual"`
 }
 
 // ConvertToOrderStatus converts Accrual order status into order status.
@@ -0,0 +1,139 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator"
+
+	"github.com/RIBorisov/gophermart/internal/models/money"
+)
+
+// Role grants access to operator endpoints, every next role includes the previous ones.
+type Role string
+
+const (
+	RoleUser    Role = "user"
+	RoleSupport Role = "support"
+	RoleAdmin   Role = "admin"
+)
+
+var roleRanks = map[Role]int{RoleUser: 1, RoleSupport: 2, RoleAdmin: 3}
+
+// Includes reports whether the role grants everything the required one does. Empty role is the user role
+// of tokens and users created before roles.
+func (r Role) Includes(required Role) bool {
+	if r == "" {
+		r = RoleUser
+	}
+	return roleRanks[r] >= roleRanks[required]
+}
+
+// Valid reports whether the role is one of the known ones.
+func (r Role) Valid() bool {
+	_, ok := roleRanks[r]
+	return ok
+}
+
+// User is what operators see of the account, password hash is never shown.
+type User struct {
+	BlockedAt *time.Time `json:"blocked_at,omitempty"`
+	ID        string     `json:"id"`
+	Login     string     `json:"login"`
+	Role      Role       `json:"role"`
+	Blocked   bool       `json:"blocked"`
+}
+
+// Reason is why the operator adjusts the balance.
+type Reason string
+
+const (
+	// ReasonCompensation credits points lost because of the service fault, e.g. a missed accrual.
+	ReasonCompensation Reason = "COMPENSATION"
+	// ReasonGoodwill credits points as a gesture to the customer.
+	ReasonGoodwill Reason = "GOODWILL"
+	// ReasonCorrection fixes a wrong accrual or withdrawal either way.
+	ReasonCorrection Reason = "CORRECTION"
+	// ReasonChargeback debits points of a refunded or cancelled purchase.
+	ReasonChargeback Reason = "CHARGEBACK"
+	// ReasonFraud debits points gained by abuse.
+	ReasonFraud Reason = "FRAUD"
+)
+
+// Valid reports whether the reason is one of the known codes.
+func (r Reason) Valid() bool {
+	switch r {
+	case ReasonCompensation, ReasonGoodwill, ReasonCorrection, ReasonChargeback, ReasonFraud:
+		return true
+	default:
+		return false
+	}
+}
+
+// AdjustmentRequest credits the balance with positive Amount and debits it with negative one.
+// Reference identifies the ticket or the document, it is unique for the user, so a retried request
+// isn't applied twice.
+type AdjustmentRequest struct {
+	Reason    Reason       `json:"reason" validate:"required"`
+	Reference string       `json:"reference" validate:"required,max=200"`
+	Comment   string       `json:"comment,omitempty" validate:"max=1000"`
+	Amount    money.Amount `json:"amount"`
+}
+
+// Adjustment is the audit record of the balance adjustment.
+type Adjustment struct {
+	CreatedAt    time.Time    `json:"created_at"`
+	UserID       string       `json:"user_id"`
+	OperatorID   string       `json:"operator_id"`
+	Reason       Reason       `json:"reason"`
+	Reference    string       `json:"reference"`
+	Comment      string       `json:"comment,omitempty"`
+	ID           int64        `json:"id"`
+	Amount       money.Amount `json:"amount"`
+	BalanceAfter money.Amount `json:"balance_after"`
+}
+
+type RoleRequest struct {
+	Role Role `json:"role" validate:"required"`
+}
+
+// UnlockResponse tells whether the login had been throttled after failed attempts.
+type UnlockResponse struct {
+	Unlocked bool `json:"unlocked"`
+}
+
+func (r *RoleRequest) Validate() error {
+	if err := validate(r); err != nil {
+		return err
+	}
+	if !r.Role.Valid() {
+		return fmt.Errorf("unknown role '%s'", r.Role)
+	}
+	return nil
+}
+
+func (r *AdjustmentRequest) Validate() error {
+	if err := validate(r); err != nil {
+		return err
+	}
+	if !r.Reason.Valid() {
+		return fmt.Errorf("unknown reason '%s'", r.Reason)
+	}
+	if strings.TrimSpace(r.Reference) == "" {
+		return errors.New("reference must not be blank")
+	}
+	if r.Amount == 0 {
+		return errors.New("amount must not be zero")
+	}
+	return nil
+}
+
+func validate(r any) error {
+	newValidator := validator.New()
+	if err := newValidator.Struct(r); err != nil {
+		return fmt.Errorf("error validating: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package admin
+
+import "testing"
+
+func TestRoleIncludes(t *testing.T) {
+	tests := []struct {
+		role     Role
+		required Role
+		want     bool
+	}{
+		{role: RoleAdmin, required: RoleSupport, want: true},
+		{role: RoleSupport, required: RoleSupport, want: true},
+		{role: RoleSupport, required: RoleAdmin, want: false},
+		{role: RoleUser, required: RoleSupport, want: false},
+		{role: "", required: RoleUser, want: true},
+		{role: "", required: RoleSupport, want: false},
+		{role: "owner", required: RoleUser, want: false},
+	}
+	for _, tt := range tests {
+		if got := tt.role.Includes(tt.required); got != tt.want {
+			t.Errorf("%q.Includes(%q) = %v, want %v", tt.role, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestAdjustmentRequestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     AdjustmentRequest
+		wantErr bool
+	}{
+		{name: "credit", req: AdjustmentRequest{Reason: ReasonGoodwill, Reference: "T-1", Amount: 100}},
+		{name: "debit", req: AdjustmentRequest{Reason: ReasonChargeback, Reference: "T-1", Amount: -100}},
+		{name: "zero amount", req: AdjustmentRequest{Reason: ReasonGoodwill, Reference: "T-1"}, wantErr: true},
+		{name: "no reason", req: AdjustmentRequest{Reference: "T-1", Amount: 100}, wantErr: true},
+		{name: "unknown reason", req: AdjustmentRequest{Reason: "GIFT", Reference: "T-1", Amount: 100}, wantErr: true},
+		{name: "blank reference", req: AdjustmentRequest{Reason: ReasonGoodwill, Reference: " ", Amount: 100}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := tt.req.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
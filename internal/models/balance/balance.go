@@ -1,19 +1,23 @@
 package balance
 
-import "time"
+import (
+	"time"
+
+	"github.com/RIBorisov/gophermart/internal/models/money"
+)
 
 type Response struct {
-	Current   float32 `json:"current"`
-	Withdrawn float32 `json:"withdrawn"`
+	Current   money.Amount `json:"current"`
+	Withdrawn money.Amount `json:"withdrawn"`
 }
 
 type WithdrawRequest struct {
-	Order string  `json:"order"`
-	Sum   float32 `json:"sum"`
+	Order string       `json:"order"`
+	Sum   money.Amount `json:"sum"`
 }
 
 type Withdrawal struct {
-	ProcessedAt time.Time `json:"processed_at"`
-	Order       string    `json:"order"`
-	Sum         float32   `json:"sum"`
+	ProcessedAt time.Time    `json:"processed_at"`
+	Order       string       `json:"order"`
+	Sum         money.Amount `json:"sum"`
 }
@@ -2,4 +2,18 @@ package models
 
 type key int
 
-const CtxUserIDKey key = iota
+const (
+	CtxUserIDKey key = iota
+	CtxClaimsKey
+)
+
+const (
+	// AccessTokenCookie carries the access token for browser clients, it isn't readable by scripts.
+	AccessTokenCookie = "gophermart_access"
+	// CSRFCookie is readable by scripts of the site, its value must be echoed in CSRFHeader
+	// by mutating requests authenticated with AccessTokenCookie.
+	CSRFCookie = "gophermart_csrf"
+	CSRFHeader = "X-CSRF-Token"
+	// TwoFactorCodeHeader carries the second factor code of withdrawals above the threshold.
+	TwoFactorCodeHeader = "X-OTP-Code"
+)
@@ -0,0 +1,20 @@
+package health
+
+const (
+	StatusOK = "ok"
+	// StatusDegraded means the service is up, but the accrual system is considered down.
+	StatusDegraded = "degraded"
+)
+
+type Response struct {
+	Status  string  `json:"status"`
+	Accrual Accrual `json:"accrual"`
+}
+
+type Accrual struct {
+	Breaker      string `json:"breaker"`
+	Processed    int64  `json:"processed"`
+	Failed       int64  `json:"failed"`
+	DeadLettered int64  `json:"dead_lettered"`
+	Restarts     int64  `json:"restarts"`
+}
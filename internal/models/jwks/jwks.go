@@ -0,0 +1,17 @@
+package jwks
+
+// Key is a public JSON Web Key (RFC 7517), RSA keys have N and E set, Ed25519 ones have Crv and X.
+type Key struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type Set struct {
+	Keys []Key `json:"keys"`
+}
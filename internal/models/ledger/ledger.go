@@ -0,0 +1,54 @@
+package ledger
+
+import (
+	"time"
+
+	"github.com/RIBorisov/gophermart/internal/models/money"
+)
+
+// Kind is a type of loyalty points movement.
+type Kind string
+
+const (
+	Accrual    Kind = "ACCRUAL"
+	Withdrawal Kind = "WITHDRAWAL"
+	Adjustment Kind = "ADJUSTMENT"
+)
+
+// UserAccount is an account holding points of a single user, the user is identified by user_id column.
+const UserAccount = "user"
+
+// CounterAccount returns system account which takes the opposite side of movement of given kind,
+// so that every ledger transaction sums up to zero.
+func (k Kind) CounterAccount() string {
+	switch k {
+	case Accrual:
+		return "system:accrual"
+	case Withdrawal:
+		return "system:withdrawals"
+	default:
+		return "system:adjustments"
+	}
+}
+
+// Posting describes a movement of points on user account. Positive Amount credits the account,
+// negative debits it.
+type Posting struct {
+	Kind    Kind
+	UserID  string
+	OrderID string
+	Amount  money.Amount
+}
+
+type Entry struct {
+	CreatedAt time.Time    `json:"created_at"`
+	Kind      Kind         `json:"kind"`
+	Order     string       `json:"order,omitempty"`
+	ID        int64        `json:"id"`
+	Amount    money.Amount `json:"amount"`
+}
+
+type Response struct {
+	Entries []Entry      `json:"entries"`
+	Balance money.Amount `json:"balance"`
+}
@@ -1,6 +1,9 @@
 package login
 
 type Response struct {
-	Details string `json:"details"`
-	Success bool   `json:"success"`
+	Details      string `json:"details"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	// TwoFactorToken is exchanged for the tokens at /api/user/login/2fa together with the second factor code.
+	TwoFactorToken string `json:"two_factor_token,omitempty"`
+	Success        bool   `json:"success"`
 }
@@ -0,0 +1,161 @@
+package money
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Amount is a fixed-point amount of loyalty points stored in hundredths (kopecks),
+// which matches DECIMAL(10, 2) columns in the database.
+type Amount int64
+
+const (
+	scale    = 2
+	centsIn1 = 100
+	// maxParseLen bounds the input of Parse, int64 of cents has at most 19 digits
+	maxParseLen = 24
+)
+
+var decimalRe = regexp.MustCompile(`^-?\d+(\.\d{1,2})?$`)
+
+// FromFloat converts float into Amount rounding it to the nearest hundredth.
+// It is intended for literals and tests, prefer Parse for external input.
+func FromFloat(f float64) Amount {
+	return Amount(math.Round(f * centsIn1))
+}
+
+// Parse parses decimal number with at most two fractional digits into Amount, e.g. 729.98, -0.5 or 500.
+// Fractions, exponent notation and extra precision are rejected, so the amount is never rounded silently.
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if len(s) > maxParseLen || !decimalRe.MatchString(s) {
+		return 0, fmt.Errorf("%w: '%.*s'", ErrInvalidAmount, maxParseLen, s)
+	}
+	intPart, frac, _ := strings.Cut(s, ".")
+	cents, err := strconv.ParseInt(intPart+frac+strings.Repeat("0", scale-len(frac)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: '%s' is out of range", ErrInvalidAmount, s)
+	}
+
+	return Amount(cents), nil
+}
+
+func fromRat(r *big.Rat) (Amount, error) {
+	num := new(big.Int).Abs(r.Num())
+	quo, rem := new(big.Int).QuoRem(num, r.Denom(), new(big.Int))
+	// round half away from zero
+	if rem.Lsh(rem, 1).Cmp(r.Denom()) >= 0 {
+		quo.Add(quo, big.NewInt(1))
+	}
+	if r.Sign() < 0 {
+		quo.Neg(quo)
+	}
+	if !quo.IsInt64() {
+		return 0, fmt.Errorf("%w: value is out of range", ErrInvalidAmount)
+	}
+
+	return Amount(quo.Int64()), nil
+}
+
+// String returns decimal representation without trailing zeros, e.g. 729.98, 100.5 or 500.
+func (a Amount) String() string {
+	sign := ""
+	v := int64(a)
+	u := uint64(v)
+	if v < 0 {
+		sign = "-"
+		u = uint64(-v)
+	}
+	intPart, frac := u/centsIn1, u%centsIn1
+
+	if frac == 0 {
+		return sign + strconv.FormatUint(intPart, 10)
+	}
+	fracStr := strings.TrimRight(fmt.Sprintf("%02d", frac), "0")
+
+	return sign + strconv.FormatUint(intPart, 10) + "." + fracStr
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText parses Amount from configuration values.
+func (a *Amount) UnmarshalText(text []byte) error {
+	parsed, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+	*a = parsed
+
+	return nil
+}
+
+// UnmarshalJSON accepts both JSON number and string containing a number.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	s := string(data)
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+
+	return nil
+}
+
+// ScanNumeric implements pgtype.NumericScanner, so Amount can be scanned from DECIMAL columns.
+func (a *Amount) ScanNumeric(v pgtype.Numeric) error {
+	if !v.Valid {
+		*a = 0
+		return nil
+	}
+	if v.NaN || v.InfinityModifier != pgtype.Finite {
+		return fmt.Errorf("%w: cannot scan NaN or Infinity", ErrInvalidAmount)
+	}
+
+	r := new(big.Rat).SetInt(v.Int)
+	exp := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(v.Exp))), nil)
+	if v.Exp >= 0 {
+		r.Mul(r, new(big.Rat).SetInt(exp))
+	} else {
+		r.Quo(r, new(big.Rat).SetInt(exp))
+	}
+	r.Mul(r, big.NewRat(centsIn1, 1))
+
+	parsed, err := fromRat(r)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+
+	return nil
+}
+
+// NumericValue implements pgtype.NumericValuer, so Amount can be used as DECIMAL query argument.
+func (a Amount) NumericValue() (pgtype.Numeric, error) {
+	return pgtype.Numeric{Int: big.NewInt(int64(a)), Exp: -scale, Valid: true}, nil
+}
+
+func abs(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+var ErrInvalidAmount = errors.New("invalid amount")
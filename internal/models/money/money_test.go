@@ -0,0 +1,80 @@
+package money
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    Amount
+		wantErr bool
+	}{
+		{name: "Positive #1", in: "729.98", want: 72998},
+		{name: "Positive #2 (integer)", in: "500", want: 50000},
+		{name: "Positive #3 (one fractional digit)", in: "-0.5", want: -50},
+		{name: "Positive #4 (spaces)", in: " 6.17 ", want: 617},
+		{name: "Negative #1", in: "abc", wantErr: true},
+		{name: "Negative #2 (overflow)", in: "100000000000000000000", wantErr: true},
+		{name: "Negative #3 (exponent)", in: "1e100000", wantErr: true},
+		{name: "Negative #4 (fraction)", in: "1/3", wantErr: true},
+		{name: "Negative #5 (extra precision)", in: "6.1725", wantErr: true},
+		{name: "Negative #6 (too long)", in: "0000000000000000000000001", wantErr: true},
+		{name: "Negative #7 (no integer part)", in: ".5", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidAmount)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAmountJSON(t *testing.T) {
+	type payload struct {
+		Sum Amount `json:"sum"`
+	}
+
+	var p payload
+	require.NoError(t, json.Unmarshal([]byte(`{"sum": 729.98}`), &p))
+	assert.Equal(t, Amount(72998), p.Sum)
+
+	require.NoError(t, json.Unmarshal([]byte(`{"sum": "100.5"}`), &p))
+	assert.Equal(t, Amount(10050), p.Sum)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"sum": true}`), &p))
+
+	for in, want := range map[Amount]string{72998: "729.98", 10050: "100.5", 50000: "500", -5: "-0.05", 0: "0"} {
+		out, err := json.Marshal(payload{Sum: in})
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"sum": `+want+`}`, string(out))
+	}
+}
+
+func TestAmountNumeric(t *testing.T) {
+	var a Amount
+	require.NoError(t, a.ScanNumeric(pgtype.Numeric{Int: big.NewInt(72998), Exp: -2, Valid: true}))
+	assert.Equal(t, Amount(72998), a)
+
+	require.NoError(t, a.ScanNumeric(pgtype.Numeric{Int: big.NewInt(5), Exp: 2, Valid: true}))
+	assert.Equal(t, Amount(50000), a)
+
+	assert.Error(t, a.ScanNumeric(pgtype.Numeric{NaN: true, Valid: true}))
+
+	n, err := Amount(72998).NumericValue()
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(72998), n.Int)
+	assert.Equal(t, int32(-2), n.Exp)
+}
@@ -1,6 +1,10 @@
 package orders
 
-import "time"
+import (
+	"time"
+
+	"github.com/RIBorisov/gophermart/internal/models/money"
+)
 
 type Status string
 
@@ -11,15 +15,70 @@ const (
 	Processed  Status = "PROCESSED"
 )
 
+// IsFinal reports whether status is terminal, orders in terminal status are immutable.
+func (s Status) IsFinal() bool {
+	return s == Processed || s == Invalid
+}
+
+// CanTransitionTo reports whether order may be moved from status s into status next:
+// NEW -> PROCESSING -> PROCESSED/INVALID, where intermediate steps may be skipped and
+// non-terminal status may be confirmed again.
+func (s Status) CanTransitionTo(next Status) bool {
+	switch s {
+	case New:
+		return next == New || next == Processing || next.IsFinal()
+	case Processing:
+		return next == Processing || next.IsFinal()
+	default:
+		return false
+	}
+}
+
 type Order struct {
-	Status     Status    `json:"status"`
-	UploadedAt time.Time `json:"uploaded_at"` // 2020-12-09T16:09:53+03:00
-	Number     string    `json:"number"`
-	Accrual    float32   `json:"accrual,omitempty"`
+	Status     Status       `json:"status"`
+	UploadedAt time.Time    `json:"uploaded_at"` // 2020-12-09T16:09:53+03:00
+	Number     string       `json:"number"`
+	Accrual    money.Amount `json:"accrual,omitempty"`
+}
+
+// Pending is an order claimed for accrual polling.
+type Pending struct {
+	UploadedAt time.Time
+	Status     Status
+	Number     string
+	Attempts   int
+	// Failures is the number of consecutive processing failures.
+	Failures int
 }
 
 type UpdateOrder struct {
-	Status  Status
-	Number  string
-	Accrual float32
+	// NextCheckAt is when the order should be polled again, zero value keeps current schedule.
+	NextCheckAt time.Time
+	Status      Status
+	Number      string
+	Accrual     money.Amount
+	// Owner is the instance which has claimed the order, the update is rejected when the lease
+	// has passed to another instance. Empty Owner updates the order regardless of its lease.
+	Owner string
+	// Stuck flags the order which stays unprocessed for too long.
+	Stuck bool
+}
+
+// Lease describes a claim of orders for accrual polling: claimed orders are owned by Owner
+// until Duration passes, so other instances skip them.
+type Lease struct {
+	Owner     string
+	Duration  time.Duration
+	BatchSize int
+}
+
+// Failure describes failed processing of the order, the order is requeued for NextCheckAt
+// or moved to the dead-letter state when it keeps failing.
+type Failure struct {
+	NextCheckAt time.Time
+	Number      string
+	Error       string
+	// Owner is the instance which has claimed the order, see UpdateOrder.Owner.
+	Owner      string
+	DeadLetter bool
 }
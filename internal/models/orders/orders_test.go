@@ -0,0 +1,31 @@
+package orders
+
+import "testing"
+
+func TestStatusCanTransitionTo(t *testing.T) {
+	tests := []struct {
+		from Status
+		to   Status
+		want bool
+	}{
+		{from: New, to: New, want: true},
+		{from: New, to: Processing, want: true},
+		{from: New, to: Processed, want: true},
+		{from: New, to: Invalid, want: true},
+		{from: Processing, to: Processing, want: true},
+		{from: Processing, to: Processed, want: true},
+		{from: Processing, to: Invalid, want: true},
+		{from: Processing, to: New, want: false},
+		{from: Processed, to: Processed, want: false},
+		{from: Processed, to: Invalid, want: false},
+		{from: Invalid, to: Processed, want: false},
+		{from: Invalid, to: New, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.from)+"->"+string(tt.to), func(t *testing.T) {
+			if got := tt.from.CanTransitionTo(tt.to); got != tt.want {
+				t.Errorf("CanTransitionTo() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package password
+
+import (
+	"fmt"
+
+	"github.com/go-playground/validator"
+)
+
+type ChangeRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
+}
+
+type ResetRequest struct {
+	Login string `json:"login" validate:"required"`
+}
+
+type ResetConfirmRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required"`
+}
+
+func (r *ChangeRequest) Validate() error {
+	return validate(r)
+}
+
+func (r *ResetRequest) Validate() error {
+	return validate(r)
+}
+
+func (r *ResetConfirmRequest) Validate() error {
+	return validate(r)
+}
+
+func validate(r any) error {
+	newValidator := validator.New()
+	if err := newValidator.Struct(r); err != nil {
+		return fmt.Errorf("error validating: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package policy
+
+// Violation is a single broken rule of the login or password policy.
+type Violation struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Response lists every rule the request violates.
+type Response struct {
+	Errors []Violation `json:"errors"`
+}
+
+const (
+	FieldLogin    = "login"
+	FieldPassword = "password"
+
+	RuleRequired   = "required"
+	RuleMinLength  = "min_length"
+	RuleMaxLength  = "max_length"
+	RuleCharset    = "charset"
+	RuleDenyList   = "deny_list"
+	RuleSameAsUser = "same_as_login"
+)
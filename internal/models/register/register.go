@@ -12,8 +12,9 @@ type Request struct {
 }
 
 type Response struct {
-	Details string `json:"details"`
-	Success bool   `json:"success"`
+	Details      string `json:"details"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Success      bool   `json:"success"`
 }
 
 func (r *Request) Validate() error {
@@ -0,0 +1,31 @@
+package token
+
+import (
+	"fmt"
+
+	"github.com/go-playground/validator"
+)
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+func (r *RefreshRequest) Validate() error {
+	newValidator := validator.New()
+	if err := newValidator.Struct(r); err != nil {
+		return fmt.Errorf("error validating: %w", err)
+	}
+	return nil
+}
+
+// Response is a pair of short-lived access token and the refresh token to get the next pair with.
+type Response struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	// ExpiresIn is the access token lifetime in seconds.
+	ExpiresIn int64 `json:"expires_in"`
+	// TwoFactorToken is issued instead of the pair when the password is right but the second factor
+	// is still required.
+	TwoFactorToken string `json:"two_factor_token,omitempty"`
+}
@@ -0,0 +1,56 @@
+package twofactor
+
+import (
+	"fmt"
+
+	"github.com/go-playground/validator"
+)
+
+// EnrollRequest confirms the enrollment with the current password, so a stolen session can't
+// add its own authenticator.
+type EnrollRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// EnrollResponse is the TOTP secret to add to an authenticator app, either typed in or scanned
+// from the QR code of URI.
+type EnrollResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// CodeRequest carries the TOTP code, disabling also accepts a recovery code.
+type CodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// ConfirmResponse lists single use recovery codes, they are shown only once.
+type ConfirmResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// LoginRequest completes the login with the TOTP or a recovery code.
+type LoginRequest struct {
+	TwoFactorToken string `json:"two_factor_token" validate:"required"`
+	Code           string `json:"code" validate:"required"`
+}
+
+func (r *EnrollRequest) Validate() error {
+	return validate(r)
+}
+
+func (r *CodeRequest) Validate() error {
+	return validate(r)
+}
+
+func (r *LoginRequest) Validate() error {
+	return validate(r)
+}
+
+func validate(r any) error {
+	newValidator := validator.New()
+	if err := newValidator.Struct(r); err != nil {
+		return fmt.Errorf("error validating: %w", err)
+	}
+	return nil
+}
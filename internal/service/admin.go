@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/RIBorisov/gophermart/internal/models"
+	"github.com/RIBorisov/gophermart/internal/models/admin"
+	"github.com/RIBorisov/gophermart/internal/models/balance"
+	"github.com/RIBorisov/gophermart/internal/models/orders"
+	"github.com/RIBorisov/gophermart/internal/storage"
+)
+
+const userSearchLimit = 50
+
+// SearchUsers finds at most 50 users with logins starting with the prefix, logins are compared as is.
+func (s *Service) SearchUsers(ctx context.Context, loginPrefix string) ([]admin.User, error) {
+	rows, err := s.Storage.SearchUsers(ctx, strings.TrimSpace(loginPrefix), userSearchLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed search users: %w", err)
+	}
+
+	users := make([]admin.User, 0, len(rows))
+	for i := range rows {
+		users = append(users, adminUser(&rows[i]))
+	}
+
+	return users, nil
+}
+
+func (s *Service) GetUserInfo(ctx context.Context, userID string) (admin.User, error) {
+	user, err := s.Storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return admin.User{}, fmt.Errorf("failed get user: %w", err)
+	}
+
+	return adminUser(user), nil
+}
+
+// UserOrders returns orders of the user the same way the user sees them.
+func (s *Service) UserOrders(ctx context.Context, userID string) ([]orders.Order, error) {
+	userCtx, err := s.userContext(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetUserOrders(userCtx)
+}
+
+func (s *Service) UserBalance(ctx context.Context, userID string) (balance.Response, error) {
+	userCtx, err := s.userContext(ctx, userID)
+	if err != nil {
+		return balance.Response{}, err
+	}
+
+	return s.GetBalance(userCtx)
+}
+
+// UserWithdrawals returns withdrawals of the user, the list is empty when there are none.
+func (s *Service) UserWithdrawals(ctx context.Context, userID string) ([]balance.Withdrawal, error) {
+	userCtx, err := s.userContext(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	wList, err := s.GetWithdrawals(userCtx)
+	if errors.Is(err, ErrNoWithdrawals) {
+		return []balance.Withdrawal{}, nil
+	}
+
+	return wList, err
+}
+
+// BlockUser prevents the user from logging in and revokes every session of the user.
+func (s *Service) BlockUser(ctx context.Context, operator *Claims, userID string) error {
+	if operator.UserID == userID {
+		return ErrOperatorSelf
+	}
+	if err := s.Storage.SetUserBlocked(ctx, userID, true); err != nil {
+		return fmt.Errorf("failed block user: %w", err)
+	}
+	if err := s.revokeUserSessions(ctx, userID); err != nil {
+		return err
+	}
+	s.Log.Info("user blocked", "user_id", userID, "operator", operator.UserID)
+
+	return nil
+}
+
+func (s *Service) UnblockUser(ctx context.Context, operator *Claims, userID string) error {
+	if err := s.Storage.SetUserBlocked(ctx, userID, false); err != nil {
+		return fmt.Errorf("failed unblock user: %w", err)
+	}
+	s.Log.Info("user unblocked", "user_id", userID, "operator", operator.UserID)
+
+	return nil
+}
+
+// SetUserRole grants the role and revokes sessions of the user, so tokens with the former role
+// stop working. Operators can't change their own role not to leave the service without an admin.
+func (s *Service) SetUserRole(ctx context.Context, operator *Claims, userID string, role admin.Role) error {
+	if operator.UserID == userID {
+		return ErrOperatorSelf
+	}
+	if err := s.Storage.SetUserRole(ctx, userID, role); err != nil {
+		return fmt.Errorf("failed set user role: %w", err)
+	}
+	if err := s.revokeUserSessions(ctx, userID); err != nil {
+		return err
+	}
+	s.Log.Info("user role changed", "user_id", userID, "role", role, "operator", operator.UserID)
+
+	return nil
+}
+
+// UnlockUserLogin lifts the lockout of the user login made by failed attempts.
+func (s *Service) UnlockUserLogin(ctx context.Context, operator *Claims, userID string) (bool, error) {
+	user, err := s.Storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed get user: %w", err)
+	}
+	unlocked, err := s.UnlockLogin(ctx, user.Login)
+	if err != nil {
+		return false, err
+	}
+	s.Log.Info("login unlock requested", "user_id", userID, "operator", operator.UserID)
+
+	return unlocked, nil
+}
+
+// AdjustBalance credits or debits the balance of the user on behalf of the operator, the ledger transaction
+// and the audit record of it are written atomically. Operators can't adjust their own balance.
+func (s *Service) AdjustBalance(
+	ctx context.Context,
+	operator *Claims,
+	userID string,
+	req *admin.AdjustmentRequest,
+) (admin.Adjustment, error) {
+	if operator.UserID == userID {
+		return admin.Adjustment{}, ErrOperatorSelf
+	}
+	if _, err := s.Storage.GetUserByID(ctx, userID); err != nil {
+		return admin.Adjustment{}, fmt.Errorf("failed get user: %w", err)
+	}
+
+	adj := admin.Adjustment{
+		UserID:     userID,
+		OperatorID: operator.UserID,
+		Reason:     req.Reason,
+		Reference:  strings.TrimSpace(req.Reference),
+		Comment:    req.Comment,
+		Amount:     req.Amount,
+	}
+	if err := s.Storage.AdjustBalance(ctx, &adj); err != nil {
+		return admin.Adjustment{}, fmt.Errorf("failed adjust balance: %w", err)
+	}
+	s.Log.Info("balance adjusted", "user_id", userID, "amount", adj.Amount, "reason", adj.Reason,
+		"reference", adj.Reference, "operator", operator.UserID)
+
+	return adj, nil
+}
+
+// UserAdjustments returns balance adjustments of the user, the latest first.
+func (s *Service) UserAdjustments(ctx context.Context, userID string) ([]admin.Adjustment, error) {
+	if _, err := s.Storage.GetUserByID(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed get user: %w", err)
+	}
+	aList, err := s.Storage.GetAdjustments(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed get balance adjustments: %w", err)
+	}
+
+	return aList, nil
+}
+
+// userContext makes the context user-scoped storage methods read the user id from.
+func (s *Service) userContext(ctx context.Context, userID string) (context.Context, error) {
+	if _, err := s.Storage.GetUserByID(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed get user: %w", err)
+	}
+
+	return context.WithValue(ctx, models.CtxUserIDKey, userID), nil
+}
+
+func adminUser(row *storage.UserRow) admin.User {
+	role := row.Role
+	if role == "" {
+		role = admin.RoleUser
+	}
+
+	return admin.User{
+		BlockedAt: row.BlockedAt,
+		ID:        row.ID,
+		Login:     row.Login,
+		Role:      role,
+		Blocked:   row.BlockedAt != nil,
+	}
+}
+
+var (
+	ErrUserBlocked  = errors.New("user is blocked")
+	ErrOperatorSelf = errors.New("operators can't block themselves or change their own role or balance")
+)
@@ -0,0 +1,23 @@
+package service
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// nextCheckDelay returns exponential delay before the next accrual poll of the order made attempt times already.
+// Equal jitter is applied: half of the delay is fixed and the other half is random, so orders uploaded
+// together don't hit the accrual system at the same moment.
+func nextCheckDelay(base, maxDelay time.Duration, attempt int) time.Duration {
+	const maxShift = 32
+
+	delay := maxDelay
+	if attempt < maxShift {
+		if exp := base << attempt; exp > 0 && exp < maxDelay {
+			delay = exp
+		}
+	}
+	half := delay / 2
+
+	return half + rand.N(delay-half+1) //nolint:gosec // jitter doesn't need crypto random
+}
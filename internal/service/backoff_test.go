@@ -0,0 +1,34 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextCheckDelay(t *testing.T) {
+	const (
+		base     = 10 * time.Second
+		maxDelay = 10 * time.Minute
+	)
+	tests := []struct {
+		name    string
+		attempt int
+		wantMin time.Duration
+		wantMax time.Duration
+	}{
+		{name: "First attempt", attempt: 0, wantMin: 5 * time.Second, wantMax: 10 * time.Second},
+		{name: "Third attempt", attempt: 2, wantMin: 20 * time.Second, wantMax: 40 * time.Second},
+		{name: "Capped", attempt: 10, wantMin: 5 * time.Minute, wantMax: maxDelay},
+		{name: "Overflow", attempt: 100, wantMin: 5 * time.Minute, wantMax: maxDelay},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 100 {
+				got := nextCheckDelay(base, maxDelay, tt.attempt)
+				if got < tt.wantMin || got > tt.wantMax {
+					t.Fatalf("nextCheckDelay() = %v, want between %v and %v", got, tt.wantMin, tt.wantMax)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/RIBorisov/gophermart/internal/models/jwks"
+)
+
+// KeySet holds the keys access tokens are signed and verified with. Every key is identified by kid
+// put into the token header. Tokens are signed with the single signing key, while all the keys are used
+// for verification, so rotation doesn't invalidate tokens signed with the previous key.
+type KeySet struct {
+	keys    map[string]*signingKey
+	signing *signingKey
+	mu      sync.RWMutex
+}
+
+type signingKey struct {
+	private crypto.Signer
+	method  jwt.SigningMethod
+	kid     string
+}
+
+// NewEphemeralKeySet generates Ed25519 key living until the process exits.
+func NewEphemeralKeySet() (*KeySet, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed generate ed25519 key: %w", err)
+	}
+	kid, err := randomString(jtiLen)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{private: private, method: jwt.SigningMethodEdDSA, kid: "ephemeral-" + kid}
+
+	return &KeySet{keys: map[string]*signingKey{key.kid: key}, signing: key}, nil
+}
+
+// LoadKeySet reads PEM encoded RSA (RS256) and Ed25519 (EdDSA) private keys from *.pem files of the dir,
+// the file name without extension is kid. Tokens are signed with signingKID key or, when it is empty,
+// with the key having the greatest kid, e.g. the latest one of date named keys.
+func LoadKeySet(dir, signingKID string) (*KeySet, error) {
+	k := &KeySet{}
+	if err := k.Load(dir, signingKID); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// Load replaces the keys with ones read from the dir, see LoadKeySet.
+func (k *KeySet) Load(dir, signingKID string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return fmt.Errorf("failed list keys: %w", err)
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("%w: no *.pem files in %s", ErrNoSigningKey, dir)
+	}
+	sort.Strings(paths)
+
+	keys := make(map[string]*signingKey, len(paths))
+	for _, path := range paths {
+		key, err := readSigningKey(path)
+		if err != nil {
+			return err
+		}
+		keys[key.kid] = key
+	}
+
+	if signingKID == "" {
+		signingKID = strings.TrimSuffix(filepath.Base(paths[len(paths)-1]), ".pem")
+	}
+	signing, ok := keys[signingKID]
+	if !ok {
+		return fmt.Errorf("%w: kid %s", ErrNoSigningKey, signingKID)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys, k.signing = keys, signing
+
+	return nil
+}
+
+func readSigningKey(path string) (*signingKey, error) {
+	const minRSABits = 2048
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed read key: %w", err)
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("failed decode PEM key %s", path)
+	}
+
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		err = fmt.Errorf("unexpected PEM block %s", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed parse key %s: %w", path, err)
+	}
+
+	key := &signingKey{kid: strings.TrimSuffix(filepath.Base(path), ".pem")}
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		if private.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA key %s is shorter than %d bits", path, minRSABits)
+		}
+		key.private, key.method = private, jwt.SigningMethodRS256
+	case ed25519.PrivateKey:
+		key.private, key.method = private, jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T in %s, expected RSA or Ed25519", parsed, path)
+	}
+
+	return key, nil
+}
+
+// Sign signs the claims with the signing key.
+func (k *KeySet) Sign(claims jwt.Claims) (string, error) {
+	k.mu.RLock()
+	key := k.signing
+	k.mu.RUnlock()
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+
+	tokenString, err := token.SignedString(key.private)
+	if err != nil {
+		return "", fmt.Errorf("failed to create token string: %w", err)
+	}
+
+	return tokenString, nil
+}
+
+// Parse verifies the token with the key its kid refers to and returns the claims.
+func (k *KeySet) Parse(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, k.keyFunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}))
+	if err != nil {
+		return nil, fmt.Errorf("failed parse token: %w", err)
+	}
+
+	return claims, nil
+}
+
+func (k *KeySet) keyFunc(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+
+	k.mu.RLock()
+	key, ok := k.keys[kid]
+	k.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+	// the algorithm is bound to the key, so a token can't pick another one
+	if t.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %v for kid %q", t.Header["alg"], kid)
+	}
+
+	return key.private.Public(), nil
+}
+
+// JWKS returns public keys for the token verification by other services.
+func (k *KeySet) JWKS() jwks.Set {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	set := jwks.Set{Keys: make([]jwks.Key, 0, len(k.keys))}
+	for _, key := range k.keys {
+		jwk := jwks.Key{Kid: key.kid, Alg: key.method.Alg(), Use: "sig"}
+		switch public := key.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].Kid < set.Keys[j].Kid
+	})
+
+	return set
+}
+
+var (
+	ErrNoSigningKey = errors.New("signing key not found")
+	ErrUnknownKey   = errors.New("token is signed with unknown key")
+)
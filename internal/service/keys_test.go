@@ -0,0 +1,216 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func writeRSAKey(t *testing.T, dir, kid string, bits int) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	if err = os.WriteFile(filepath.Join(dir, kid+".pem"), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeEd25519Key(t *testing.T, dir, kid string) {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	if err = os.WriteFile(filepath.Join(dir, kid+".pem"), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testClaims() Claims {
+	return Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "jti",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		UserID: "123",
+	}
+}
+
+func tokenKID(t *testing.T, tokenString string) string {
+	t.Helper()
+
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, &Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := token.Header["kid"].(string)
+
+	return kid
+}
+
+func TestKeySetRotation(t *testing.T) {
+	dir := t.TempDir()
+	writeRSAKey(t, dir, "2024-01", 2048)
+
+	keys, err := LoadKeySet(dir, "")
+	if err != nil {
+		t.Fatalf("LoadKeySet() error = %v", err)
+	}
+	old, err := keys.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := tokenKID(t, old); kid != "2024-01" {
+		t.Fatalf("kid = %q, want 2024-01", kid)
+	}
+
+	// the newest key signs after reload while tokens of the previous one are still accepted
+	writeEd25519Key(t, dir, "2024-02")
+	if err = keys.Load(dir, ""); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	fresh, err := keys.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := tokenKID(t, fresh); kid != "2024-02" {
+		t.Fatalf("kid = %q, want 2024-02", kid)
+	}
+	for _, tokenString := range []string{old, fresh} {
+		claims, err := keys.Parse(tokenString)
+		if err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+		if claims.UserID != "123" {
+			t.Fatalf("UserID = %q, want 123", claims.UserID)
+		}
+	}
+
+	// explicitly chosen signing key
+	if err = keys.Load(dir, "2024-01"); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	pinned, err := keys.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := tokenKID(t, pinned); kid != "2024-01" {
+		t.Fatalf("kid = %q, want 2024-01", kid)
+	}
+
+	set := keys.JWKS()
+	if len(set.Keys) != 2 || set.Keys[0].Kty != "RSA" || set.Keys[0].Alg != "RS256" || set.Keys[1].Kty != "OKP" {
+		t.Fatalf("JWKS() = %+v", set)
+	}
+
+	// tokens of the removed key are rejected
+	if err = os.Remove(filepath.Join(dir, "2024-01.pem")); err != nil {
+		t.Fatal(err)
+	}
+	if err = keys.Load(dir, ""); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if _, err = keys.Parse(old); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Parse() error = %v, want %v", err, ErrUnknownKey)
+	}
+}
+
+func TestLoadKeySetErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, dir string)
+		kid     string
+		wantErr error
+	}{
+		{
+			name:    "Empty dir",
+			prepare: func(t *testing.T, dir string) {},
+			wantErr: ErrNoSigningKey,
+		},
+		{
+			name:    "Unknown signing kid",
+			prepare: func(t *testing.T, dir string) { writeEd25519Key(t, dir, "a") },
+			kid:     "b",
+			wantErr: ErrNoSigningKey,
+		},
+		{
+			name:    "Short RSA key",
+			prepare: func(t *testing.T, dir string) { writeRSAKey(t, dir, "a", 1024) },
+		},
+		{
+			name: "Not a PEM",
+			prepare: func(t *testing.T, dir string) {
+				if err := os.WriteFile(filepath.Join(dir, "a.pem"), []byte("secret"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tt.prepare(t, dir)
+
+			_, err := LoadKeySet(dir, tt.kid)
+			if err == nil {
+				t.Fatal("LoadKeySet() error = nil")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("LoadKeySet() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeySetRejectsForeignAlgorithm(t *testing.T) {
+	keys, err := NewEphemeralKeySet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid := keys.JWKS().Keys[0].Kid
+
+	// HS256 token pretending to be signed with the known kid
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	token.Header["kid"] = kid
+	tokenString, err := token.SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = keys.Parse(tokenString); err == nil {
+		t.Fatal("Parse() error = nil, want rejected HS256 token")
+	}
+
+	// RS256 token with Ed25519 kid
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token = jwt.NewWithClaims(jwt.SigningMethodRS256, testClaims())
+	token.Header["kid"] = kid
+	tokenString, err = token.SignedString(rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = keys.Parse(tokenString); err == nil {
+		t.Fatal("Parse() error = nil, want rejected RS256 token")
+	}
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/RIBorisov/gophermart/internal/config"
+	"github.com/RIBorisov/gophermart/internal/storage"
+)
+
+// LoginGuard tracks failed logins per login and per client address. Every failure of the login postpones
+// its next attempt twice as long as the previous one and too many failures lock it for a while. Failures
+// of an address are only counted up to the lockout, so users behind one NAT aren't slowed down by others.
+// The failures are kept in the storage shared by the instances, so the limits and unlocks apply to all of them.
+type LoginGuard struct {
+	store     LoginGuardStore
+	lastPrune time.Time
+	now       func() time.Time
+	cfg       config.Auth
+	mu        sync.Mutex
+}
+
+// LoginGuardStore keeps failures by key, see storage.LoginFailures.
+type LoginGuardStore interface {
+	GetLoginFailures(ctx context.Context, keys []string) (map[string]storage.LoginFailures, error)
+	AddLoginFailure(ctx context.Context, key string, now time.Time, limit storage.LoginFailureLimit) (bool, error)
+	DeleteLoginFailures(ctx context.Context, key string) (bool, error)
+	PruneLoginFailures(ctx context.Context, now, before time.Time) error
+}
+
+const (
+	guardLoginPrefix = "login:"
+	guardIPPrefix    = "ip:"
+)
+
+func NewLoginGuard(store LoginGuardStore, cfg config.Auth) *LoginGuard {
+	return &LoginGuard{store: store, lastPrune: time.Now(), now: time.Now, cfg: cfg}
+}
+
+// Allow returns the time left until the next attempt is allowed for the login from the address.
+func (g *LoginGuard) Allow(ctx context.Context, login, ip string) (time.Duration, bool, error) {
+	loginKey, ipKey := guardLoginPrefix+NormalizeLogin(login), guardIPPrefix+ip
+	failures, err := g.store.GetLoginFailures(ctx, []string{loginKey, ipKey})
+	if err != nil {
+		return 0, false, fmt.Errorf("failed get login failures: %w", err)
+	}
+
+	now := g.now()
+	wait := g.wait(failures[loginKey], now, g.cfg.LoginDelayBase)
+	if ipWait := g.wait(failures[ipKey], now, 0); ip != "" && ipWait > wait {
+		wait = ipWait
+	}
+
+	return wait, wait <= 0, nil
+}
+
+// Fail counts the failed attempt and reports whether the login got locked by it.
+func (g *LoginGuard) Fail(ctx context.Context, login, ip string) (bool, error) {
+	now := g.now()
+	if err := g.prune(ctx, now); err != nil {
+		return false, err
+	}
+
+	locked, err := g.store.AddLoginFailure(ctx, guardLoginPrefix+NormalizeLogin(login), now, storage.LoginFailureLimit{
+		Window:      g.cfg.LoginFailureWindow,
+		Lockout:     g.cfg.LoginLockout,
+		MaxFailures: g.cfg.LoginMaxFailures,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed count login failure: %w", err)
+	}
+	if ip != "" {
+		_, err = g.store.AddLoginFailure(ctx, guardIPPrefix+ip, now, storage.LoginFailureLimit{
+			Window:      g.cfg.LoginFailureWindow,
+			Lockout:     g.cfg.LoginLockout,
+			MaxFailures: g.cfg.LoginIPMaxFailures,
+		})
+		if err != nil {
+			return false, fmt.Errorf("failed count address failure: %w", err)
+		}
+	}
+
+	return locked, nil
+}
+
+// Succeed forgets failures of the login, failures of the address are kept.
+func (g *LoginGuard) Succeed(ctx context.Context, login string) error {
+	if _, err := g.store.DeleteLoginFailures(ctx, guardLoginPrefix+NormalizeLogin(login)); err != nil {
+		return fmt.Errorf("failed forget login failures: %w", err)
+	}
+
+	return nil
+}
+
+// Unlock forgets failures and lockout of the login and reports whether there were any.
+func (g *LoginGuard) Unlock(ctx context.Context, login string) (bool, error) {
+	ok, err := g.store.DeleteLoginFailures(ctx, guardLoginPrefix+NormalizeLogin(login))
+	if err != nil {
+		return false, fmt.Errorf("failed forget login failures: %w", err)
+	}
+
+	return ok, nil
+}
+
+func (g *LoginGuard) wait(f storage.LoginFailures, now time.Time, delayBase time.Duration) time.Duration {
+	if now.Before(f.LockedUntil) {
+		return f.LockedUntil.Sub(now)
+	}
+	if f.Failures == 0 || delayBase <= 0 || now.Sub(f.LastFailure) > g.cfg.LoginFailureWindow {
+		return 0
+	}
+
+	return f.LastFailure.Add(loginDelay(delayBase, g.cfg.LoginLockout, f.Failures)).Sub(now)
+}
+
+// prune forgets keys with neither lockout nor remembered failures, each instance runs it once a window.
+func (g *LoginGuard) prune(ctx context.Context, now time.Time) error {
+	g.mu.Lock()
+	if now.Sub(g.lastPrune) < g.cfg.LoginFailureWindow {
+		g.mu.Unlock()
+		return nil
+	}
+	g.lastPrune = now
+	g.mu.Unlock()
+
+	if err := g.store.PruneLoginFailures(ctx, now, now.Add(-g.cfg.LoginFailureWindow)); err != nil {
+		return fmt.Errorf("failed prune login failures: %w", err)
+	}
+
+	return nil
+}
+
+// loginDelay doubles the base delay with every failure, it is capped by the lockout.
+func loginDelay(base, maxDelay time.Duration, failures int) time.Duration {
+	delay := base
+	for i := 1; i < failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		return maxDelay
+	}
+
+	return delay
+}
+
+// UnlockLogin lifts the lockout of the login on every instance, e.g. after support has confirmed
+// the user identity.
+func (s *Service) UnlockLogin(ctx context.Context, login string) (bool, error) {
+	if s.LoginGuard == nil {
+		return false, nil
+	}
+	unlocked, err := s.LoginGuard.Unlock(ctx, login)
+	if err != nil {
+		return false, err
+	}
+	s.Log.Info("login unlocked", "login", login, "was_locked", unlocked)
+
+	return unlocked, nil
+}
+
+// checkLoginAllowed returns *LoginThrottledError while the login or the address has to wait after failed attempts.
+func (s *Service) checkLoginAllowed(ctx context.Context, login, clientIP string) error {
+	if s.LoginGuard == nil {
+		return nil
+	}
+	retryAfter, ok, err := s.LoginGuard.Allow(ctx, login, clientIP)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &LoginThrottledError{RetryAfter: retryAfter}
+	}
+
+	return nil
+}
+
+// loginSucceeded forgets failures of the login, the login is let in even if they can't be forgotten.
+func (s *Service) loginSucceeded(ctx context.Context, login string) {
+	if s.LoginGuard == nil {
+		return
+	}
+	if err := s.LoginGuard.Succeed(ctx, login); err != nil {
+		s.Log.Warn("failed forget login failures", "login", login, "error", err)
+	}
+}
+
+// LoginThrottledError is returned instead of checking the password while the login or the address
+// has to wait after failed attempts.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("too many failed logins, retry after: %v", e.RetryAfter)
+}
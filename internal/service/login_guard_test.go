@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RIBorisov/gophermart/internal/config"
+	"github.com/RIBorisov/gophermart/internal/storage"
+)
+
+var testGuardConfig = config.Auth{
+	LoginMaxFailures:   4,
+	LoginDelayBase:     time.Second,
+	LoginLockout:       time.Hour,
+	LoginFailureWindow: 15 * time.Minute,
+	LoginIPMaxFailures: 6,
+}
+
+func newTestGuard(store LoginGuardStore, now *time.Time) *LoginGuard {
+	g := NewLoginGuard(store, testGuardConfig)
+	g.now = func() time.Time { return *now }
+
+	return g
+}
+
+func testNow() *time.Time {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	return &now
+}
+
+func fail(t *testing.T, g *LoginGuard, login, ip string) bool {
+	t.Helper()
+
+	locked, err := g.Fail(context.Background(), login, ip)
+	if err != nil {
+		t.Fatalf("Fail() error = %v", err)
+	}
+
+	return locked
+}
+
+func allow(t *testing.T, g *LoginGuard, login, ip string) (time.Duration, bool) {
+	t.Helper()
+
+	wait, ok, err := g.Allow(context.Background(), login, ip)
+	if err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+
+	return wait, ok
+}
+
+func TestLoginGuardProgressiveDelay(t *testing.T) {
+	now := testNow()
+	g := newTestGuard(storage.NewMemory(), now)
+
+	for i, wantWait := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		if locked := fail(t, g, "Vasiliy", "10.0.0.1"); locked {
+			t.Fatalf("failure #%d locked the login", i+1)
+		}
+		// the login is normalized, so case doesn't help to bypass the delay
+		wait, ok := allow(t, g, "VASILIY", "10.0.0.2")
+		if ok || wait != wantWait {
+			t.Fatalf("after failure #%d Allow() = %v, %v, want %v, false", i+1, wait, ok, wantWait)
+		}
+		*now = now.Add(wantWait)
+		if _, ok = allow(t, g, "vasiliy", "10.0.0.2"); !ok {
+			t.Fatalf("after failure #%d the login isn't allowed once the delay is over", i+1)
+		}
+	}
+
+	if locked := fail(t, g, "vasiliy", "10.0.0.1"); !locked {
+		t.Fatal("the last allowed failure didn't lock the login")
+	}
+	if wait, ok := allow(t, g, "vasiliy", "10.0.0.2"); ok || wait != time.Hour {
+		t.Fatalf("locked Allow() = %v, %v, want %v, false", wait, ok, time.Hour)
+	}
+
+	if unlocked, err := g.Unlock(context.Background(), "Vasiliy"); err != nil || !unlocked {
+		t.Fatalf("Unlock() = %v, %v, want true, nil for the locked login", unlocked, err)
+	}
+	if _, ok := allow(t, g, "vasiliy", "10.0.0.2"); !ok {
+		t.Fatal("unlocked login isn't allowed")
+	}
+}
+
+func TestLoginGuardForgetsFailures(t *testing.T) {
+	now := testNow()
+	g := newTestGuard(storage.NewMemory(), now)
+
+	fail(t, g, "vasiliy", "10.0.0.1")
+	fail(t, g, "vasiliy", "10.0.0.1")
+	if err := g.Succeed(context.Background(), "vasiliy"); err != nil {
+		t.Fatalf("Succeed() error = %v", err)
+	}
+	if _, ok := allow(t, g, "vasiliy", "10.0.0.3"); !ok {
+		t.Fatal("failures are kept after successful login")
+	}
+
+	fail(t, g, "petr", "10.0.0.1")
+	*now = now.Add(16 * time.Minute)
+	fail(t, g, "petr", "10.0.0.1")
+	if wait, _ := allow(t, g, "petr", "10.0.0.3"); wait != time.Second {
+		t.Fatalf("Allow() wait = %v, want the first delay after the window", wait)
+	}
+}
+
+func TestLoginGuardAddress(t *testing.T) {
+	now := testNow()
+	g := newTestGuard(storage.NewMemory(), now)
+
+	// one failure per login from the same address
+	for _, login := range []string{"a", "b", "c", "d", "e"} {
+		fail(t, g, login, "10.0.0.1")
+	}
+	if _, ok := allow(t, g, "f", "10.0.0.1"); !ok {
+		t.Fatal("address is delayed before the lockout")
+	}
+	fail(t, g, "f", "10.0.0.1")
+	if wait, ok := allow(t, g, "g", "10.0.0.1"); ok || wait != time.Hour {
+		t.Fatalf("Allow() = %v, %v, want locked address", wait, ok)
+	}
+	if _, ok := allow(t, g, "g", "10.0.0.2"); !ok {
+		t.Fatal("another address is locked")
+	}
+}
+
+func TestLoginGuardSharedStore(t *testing.T) {
+	now := testNow()
+	store := storage.NewMemory()
+	first, second := newTestGuard(store, now), newTestGuard(store, now)
+
+	// failures spread over the instances add up to the same lockout
+	for i := 0; i < testGuardConfig.LoginMaxFailures; i++ {
+		g := first
+		if i%2 == 1 {
+			g = second
+		}
+		*now = now.Add(time.Minute)
+		fail(t, g, "vasiliy", "10.0.0.1")
+	}
+	if wait, ok := allow(t, first, "vasiliy", "10.0.0.2"); ok || wait != time.Hour {
+		t.Fatalf("Allow() = %v, %v, want the login locked by failures on both instances", wait, ok)
+	}
+
+	if unlocked, err := second.Unlock(context.Background(), "vasiliy"); err != nil || !unlocked {
+		t.Fatalf("Unlock() = %v, %v, want true, nil", unlocked, err)
+	}
+	if _, ok := allow(t, first, "vasiliy", "10.0.0.2"); !ok {
+		t.Fatal("the login unlocked on one instance is still locked on another")
+	}
+}
+
+func TestLoginDelay(t *testing.T) {
+	if got := loginDelay(time.Second, time.Minute, 1); got != time.Second {
+		t.Fatalf("loginDelay() = %v, want 1s", got)
+	}
+	if got := loginDelay(time.Second, time.Minute, 100); got != time.Minute {
+		t.Fatalf("loginDelay() = %v, want capped 1m", got)
+	}
+}
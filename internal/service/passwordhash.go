@@ -0,0 +1,209 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/RIBorisov/gophermart/internal/config"
+)
+
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+
+	// bcryptPrefix marks bcrypt hashes of the pre-hashed password, plain bcrypt hashes are legacy ones
+	// made of the password with SECRET_KEY appended.
+	bcryptPrefix  = "$bcrypt-sha256$"
+	argon2Prefix  = "$argon2id$"
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+// PasswordHasher makes self-describing password hashes:
+//
+//	$argon2id$v=19$m=19456,t=2,p=1[,k=<pepper kid>]$<salt>$<hash>
+//	$bcrypt-sha256$v=1[,k=<pepper kid>]$<bcrypt hash>
+//
+// The password is mixed with the pepper by HMAC-SHA256 when the pepper is configured. bcrypt gets
+// SHA-256 of the password, so long passwords aren't truncated to 72 bytes.
+type PasswordHasher struct {
+	peppers   map[string]string
+	legacyKey string
+	cfg       config.PasswordHash
+}
+
+func NewPasswordHasher(cfg config.PasswordHash, secret config.Secret) (*PasswordHasher, error) {
+	if cfg.Algorithm != AlgorithmArgon2id && cfg.Algorithm != AlgorithmBcrypt {
+		return nil, fmt.Errorf("unsupported password hash algorithm %q", cfg.Algorithm)
+	}
+	if _, ok := secret.PasswordPeppers[cfg.PepperKID]; cfg.PepperKID != "" && !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPepper, cfg.PepperKID)
+	}
+
+	return &PasswordHasher{peppers: secret.PasswordPeppers, legacyKey: secret.SecretKey, cfg: cfg}, nil
+}
+
+// Hash makes the hash with the configured algorithm and pepper.
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	input, err := h.pepper(h.cfg.PepperKID, password)
+	if err != nil {
+		return "", err
+	}
+	params := ""
+	if h.cfg.PepperKID != "" {
+		params = ",k=" + h.cfg.PepperKID
+	}
+
+	if h.cfg.Algorithm == AlgorithmBcrypt {
+		hashed, err := bcrypt.GenerateFromPassword(prehash(input), h.cfg.BcryptCost)
+		if err != nil {
+			return "", fmt.Errorf("failed hash password: %w", err)
+		}
+		return bcryptPrefix + "v=1" + params + string(hashed), nil
+	}
+
+	salt := make([]byte, argon2SaltLen)
+	if _, err = rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed read random bytes: %w", err)
+	}
+	key := argon2.IDKey(input, salt, h.cfg.Argon2Time, h.cfg.Argon2Memory, h.cfg.Argon2Threads, argon2KeyLen)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d%s$%s$%s", argon2Prefix, argon2.Version,
+		h.cfg.Argon2Memory, h.cfg.Argon2Time, h.cfg.Argon2Threads, params,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify returns ErrIncorrectPassword when the password doesn't match, otherwise it reports whether
+// the hash has to be remade: it is legacy one or made by another algorithm, parameters or pepper than configured.
+func (h *PasswordHasher) Verify(encoded, password string) (bool, error) {
+	switch {
+	case strings.HasPrefix(encoded, argon2Prefix):
+		return h.verifyArgon2(encoded, password)
+	case strings.HasPrefix(encoded, bcryptPrefix):
+		return h.verifyBcrypt(encoded, password)
+	default:
+		if h.legacyKey == "" {
+			return false, ErrNoLegacyKey
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password+h.legacyKey)); err != nil {
+			return false, ErrIncorrectPassword
+		}
+		return true, nil
+	}
+}
+
+func (h *PasswordHasher) verifyArgon2(encoded, password string) (bool, error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..[,k=..]", salt, hash
+	const partsCount = 6
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != partsCount || parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return false, ErrMalformedHash
+	}
+	params, err := parseHashParams(parts[3])
+	if err != nil {
+		return false, err
+	}
+	memory, errM := strconv.ParseUint(params["m"], 10, 32)
+	iterations, errT := strconv.ParseUint(params["t"], 10, 32)
+	threads, errP := strconv.ParseUint(params["p"], 10, 8)
+	salt, errS := base64.RawStdEncoding.DecodeString(parts[4])
+	key, errK := base64.RawStdEncoding.DecodeString(parts[5])
+	if err = errors.Join(errM, errT, errP, errS, errK); err != nil {
+		return false, fmt.Errorf("%w: %w", ErrMalformedHash, err)
+	}
+	if len(key) == 0 {
+		return false, ErrMalformedHash
+	}
+
+	input, err := h.pepper(params["k"], password)
+	if err != nil {
+		return false, err
+	}
+	//nolint:gosec // parsed with the bit size of the types
+	got := argon2.IDKey(input, salt, uint32(iterations), uint32(memory), uint8(threads), uint32(len(key)))
+	if subtle.ConstantTimeCompare(got, key) != 1 {
+		return false, ErrIncorrectPassword
+	}
+
+	return h.cfg.Algorithm != AlgorithmArgon2id || params["k"] != h.cfg.PepperKID ||
+		uint32(memory) != h.cfg.Argon2Memory || uint32(iterations) != h.cfg.Argon2Time ||
+		uint8(threads) != h.cfg.Argon2Threads || len(key) != argon2KeyLen, nil
+}
+
+func (h *PasswordHasher) verifyBcrypt(encoded, password string) (bool, error) {
+	rest := strings.TrimPrefix(encoded, bcryptPrefix)
+	paramsEnd := strings.IndexByte(rest, '$')
+	if paramsEnd < 0 {
+		return false, ErrMalformedHash
+	}
+	params, err := parseHashParams(rest[:paramsEnd])
+	if err != nil {
+		return false, err
+	}
+	hashed := []byte(rest[paramsEnd:])
+
+	input, err := h.pepper(params["k"], password)
+	if err != nil {
+		return false, err
+	}
+	if err = bcrypt.CompareHashAndPassword(hashed, prehash(input)); err != nil {
+		return false, ErrIncorrectPassword
+	}
+	cost, err := bcrypt.Cost(hashed)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrMalformedHash, err)
+	}
+
+	return h.cfg.Algorithm != AlgorithmBcrypt || params["k"] != h.cfg.PepperKID || cost != h.cfg.BcryptCost, nil
+}
+
+// pepper mixes the pepper of the key id into the password, the password is used as is without key id.
+func (h *PasswordHasher) pepper(kid, password string) ([]byte, error) {
+	if kid == "" {
+		return []byte(password), nil
+	}
+	pepper, ok := h.peppers[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPepper, kid)
+	}
+	mac := hmac.New(sha256.New, []byte(pepper))
+	mac.Write([]byte(password))
+
+	return mac.Sum(nil), nil
+}
+
+// prehash keeps bcrypt input within its 72 bytes limit.
+func prehash(input []byte) []byte {
+	sum := sha256.Sum256(input)
+	return []byte(base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+func parseHashParams(s string) (map[string]string, error) {
+	params := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, ErrMalformedHash
+		}
+		params[k] = v
+	}
+
+	return params, nil
+}
+
+var (
+	ErrMalformedHash = errors.New("malformed password hash")
+	ErrUnknownPepper = errors.New("unknown password pepper key id")
+	ErrNoLegacyKey   = errors.New("SECRET_KEY is required to verify legacy password hashes")
+)
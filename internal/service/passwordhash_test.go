@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/RIBorisov/gophermart/internal/config"
+	"github.com/RIBorisov/gophermart/internal/models/register"
+	"github.com/RIBorisov/gophermart/internal/storage"
+)
+
+var testHashConfig = config.PasswordHash{
+	Algorithm:     AlgorithmArgon2id,
+	Argon2Memory:  64,
+	Argon2Time:    1,
+	Argon2Threads: 1,
+	BcryptCost:    bcrypt.MinCost,
+}
+
+func newTestHasher(t *testing.T, cfg config.PasswordHash, peppers map[string]string) *PasswordHasher {
+	t.Helper()
+
+	h, err := NewPasswordHasher(cfg, config.Secret{SecretKey: "legacy-secret", PasswordPeppers: peppers})
+	if err != nil {
+		t.Fatalf("NewPasswordHasher() error = %v", err)
+	}
+
+	return h
+}
+
+func TestPasswordHasher(t *testing.T) {
+	bcryptCfg := testHashConfig
+	bcryptCfg.Algorithm = AlgorithmBcrypt
+	peppered := testHashConfig
+	peppered.PepperKID = "a"
+
+	tests := []struct {
+		name       string
+		cfg        config.PasswordHash
+		wantPrefix string
+	}{
+		{name: "argon2id", cfg: testHashConfig, wantPrefix: "$argon2id$v=19$m=64,t=1,p=1$"},
+		{name: "bcrypt", cfg: bcryptCfg, wantPrefix: "$bcrypt-sha256$v=1$2a$04$"},
+		{name: "argon2id with pepper", cfg: peppered, wantPrefix: "$argon2id$v=19$m=64,t=1,p=1,k=a$"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHasher(t, tt.cfg, map[string]string{"a": "pepper"})
+
+			// differs from the right password after bcrypt 72 bytes limit only
+			long := strings.Repeat("x", 80)
+			encoded, err := h.Hash(long + "1")
+			if err != nil {
+				t.Fatalf("Hash() error = %v", err)
+			}
+			if !strings.HasPrefix(encoded, tt.wantPrefix) {
+				t.Fatalf("Hash() = %q, want prefix %q", encoded, tt.wantPrefix)
+			}
+
+			rehash, err := h.Verify(encoded, long+"1")
+			if err != nil || rehash {
+				t.Fatalf("Verify() = %v, %v, want false, nil", rehash, err)
+			}
+			if _, err = h.Verify(encoded, long+"2"); !errors.Is(err, ErrIncorrectPassword) {
+				t.Fatalf("Verify() error = %v, want %v", err, ErrIncorrectPassword)
+			}
+		})
+	}
+}
+
+func TestPasswordHasherUpgrade(t *testing.T) {
+	peppers := map[string]string{"a": "pepper-a", "b": "pepper-b"}
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("pwd"+"legacy-secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bcryptCfg := testHashConfig
+	bcryptCfg.Algorithm = AlgorithmBcrypt
+	oldPepper := testHashConfig
+	oldPepper.PepperKID = "a"
+	stronger := testHashConfig
+	stronger.Argon2Time = 2
+
+	current := testHashConfig
+	current.PepperKID = "b"
+	h := newTestHasher(t, current, peppers)
+	upToDate, err := h.Hash("pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashes := map[string]string{
+		"legacy":     string(legacy),
+		"bcrypt":     hashWith(t, bcryptCfg, peppers),
+		"old pepper": hashWith(t, oldPepper, peppers),
+		"no pepper":  hashWith(t, testHashConfig, peppers),
+		"old params": hashWith(t, stronger, peppers),
+	}
+	for name, encoded := range hashes {
+		rehash, err := h.Verify(encoded, "pwd")
+		if err != nil || !rehash {
+			t.Fatalf("%s: Verify() = %v, %v, want true, nil", name, rehash, err)
+		}
+	}
+	if rehash, err := h.Verify(upToDate, "pwd"); err != nil || rehash {
+		t.Fatalf("Verify() = %v, %v, want false, nil", rehash, err)
+	}
+	if _, err = h.Verify(string(legacy), "wrong"); !errors.Is(err, ErrIncorrectPassword) {
+		t.Fatalf("legacy Verify() error = %v, want %v", err, ErrIncorrectPassword)
+	}
+
+	// the pepper removed too early
+	withoutA := newTestHasher(t, current, map[string]string{"b": "pepper-b"})
+	if _, err = withoutA.Verify(hashes["old pepper"], "pwd"); !errors.Is(err, ErrUnknownPepper) {
+		t.Fatalf("Verify() error = %v, want %v", err, ErrUnknownPepper)
+	}
+	if _, err = h.Verify("$argon2id$v=19$m=64$salt", "pwd"); !errors.Is(err, ErrMalformedHash) {
+		t.Fatalf("Verify() error = %v, want %v", err, ErrMalformedHash)
+	}
+}
+
+func TestNewPasswordHasherErrors(t *testing.T) {
+	unknownAlg := testHashConfig
+	unknownAlg.Algorithm = "md5"
+	if _, err := NewPasswordHasher(unknownAlg, config.Secret{}); err == nil {
+		t.Fatal("NewPasswordHasher() error = nil for unknown algorithm")
+	}
+	unknownPepper := testHashConfig
+	unknownPepper.PepperKID = "missing"
+	if _, err := NewPasswordHasher(unknownPepper, config.Secret{}); !errors.Is(err, ErrUnknownPepper) {
+		t.Fatalf("NewPasswordHasher() error = %v, want %v", err, ErrUnknownPepper)
+	}
+}
+
+func hashWith(t *testing.T, cfg config.PasswordHash, peppers map[string]string) string {
+	t.Helper()
+
+	encoded, err := newTestHasher(t, cfg, peppers).Hash("pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return encoded
+}
+
+func TestPasswordHasherNoLegacyKey(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("pwd"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewPasswordHasher(testHashConfig, config.Secret{})
+	if err != nil {
+		t.Fatalf("NewPasswordHasher() error = %v", err)
+	}
+
+	// without SECRET_KEY legacy hashes aren't checked against the password alone
+	if _, err = h.Verify(string(legacy), "pwd"); !errors.Is(err, ErrNoLegacyKey) {
+		t.Fatalf("Verify() error = %v, want %v", err, ErrNoLegacyKey)
+	}
+}
+
+func TestCheckLegacyPasswordHashes(t *testing.T) {
+	ctx := context.Background()
+	legacy, err := bcrypt.GenerateFromPassword([]byte("pwd"+"legacy-secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := hashWith(t, testHashConfig, nil)
+
+	tests := []struct {
+		wantErr   error
+		name      string
+		secretKey string
+		hashes    []string
+	}{
+		{name: "no legacy hashes", hashes: []string{current}},
+		{name: "legacy hashes with SECRET_KEY", secretKey: "legacy-secret", hashes: []string{current, string(legacy)}},
+		{name: "legacy hashes without SECRET_KEY", hashes: []string{current, string(legacy)}, wantErr: ErrNoLegacyKey},
+	}
+	for _, tt := range tests {
+		mem := storage.NewMemory()
+		for i, hash := range tt.hashes {
+			if _, err = mem.SaveUser(ctx, &register.Request{Login: fmt.Sprintf("user%d", i), Password: hash}); err != nil {
+				t.Fatalf("%s: SaveUser() error = %v", tt.name, err)
+			}
+		}
+		svc := &Service{
+			Storage: mem,
+			Config:  &config.Config{PasswordHash: testHashConfig, Secret: config.Secret{SecretKey: tt.secretKey}},
+		}
+		if err = svc.CheckLegacyPasswordHashes(ctx); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: CheckLegacyPasswordHashes() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/RIBorisov/gophermart/internal/logger"
+	"github.com/RIBorisov/gophermart/internal/models/password"
+	"github.com/RIBorisov/gophermart/internal/models/token"
+	"github.com/RIBorisov/gophermart/internal/storage"
+)
+
+const (
+	resetTokenLen = 32
+	// resetGuardPrefix keeps reset requests apart from failed logins in LoginGuard
+	resetGuardPrefix = "reset:"
+)
+
+// Notifier delivers the password reset token to the user, e.g. by email.
+type Notifier interface {
+	NotifyPasswordReset(ctx context.Context, login, resetToken string, expiresAt time.Time) error
+}
+
+// LogNotifier writes reset tokens to the log, so support can pass them to users. It is meant for setups
+// without a delivery channel, anyone with access to the log is able to reset passwords.
+type LogNotifier struct {
+	Log *logger.Log
+}
+
+func (n *LogNotifier) NotifyPasswordReset(_ context.Context, login, resetToken string, expiresAt time.Time) error {
+	n.Log.Info("password reset requested", "login", login, "token", resetToken, "expires_at", expiresAt)
+	return nil
+}
+
+func (s *Service) notifier() Notifier {
+	if s.Notifier == nil {
+		return &LogNotifier{Log: s.Log}
+	}
+	return s.Notifier
+}
+
+// ChangePassword replaces the password of the authenticated user when the current one matches, wrong
+// passwords are throttled together with failed logins. Every session of the user is revoked together with
+// the change, the caller gets tokens of a new session instead.
+func (s *Service) ChangePassword(
+	ctx context.Context,
+	claims *Claims,
+	req *password.ChangeRequest,
+) (token.Response, error) {
+	user, err := s.Storage.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		return token.Response{}, fmt.Errorf("failed get user: %w", err)
+	}
+	if err = s.reauthenticate(ctx, user, req.CurrentPassword); err != nil {
+		return token.Response{}, err
+	}
+	if err = s.checkNewPassword(user.Login, req.NewPassword); err != nil {
+		return token.Response{}, err
+	}
+
+	encrypted, err := s.hashPassword(req.NewPassword)
+	if err != nil {
+		return token.Response{}, fmt.Errorf("failed hashPassword new password: %w", err)
+	}
+	if err = s.Storage.ChangePassword(ctx, user.ID, encrypted, time.Now()); err != nil {
+		return token.Response{}, fmt.Errorf("failed change password: %w", err)
+	}
+	s.forgetUserTokens(user.ID)
+
+	return s.IssueTokens(ctx, user.ID, user.Role)
+}
+
+// RequestPasswordReset sends single use reset token to the user. Unknown login is not reported,
+// so the endpoint can't be used to find out registered logins. Requests are throttled by LoginGuard
+// per login and per client address the same way failed logins are, whether the login exists or not.
+func (s *Service) RequestPasswordReset(ctx context.Context, login, clientIP string) error {
+	if s.LoginGuard != nil {
+		ip := ""
+		if clientIP != "" {
+			ip = resetGuardPrefix + clientIP
+		}
+		if err := s.checkLoginAllowed(ctx, resetGuardPrefix+login, ip); err != nil {
+			return err
+		}
+		if _, err := s.LoginGuard.Fail(ctx, resetGuardPrefix+login, ip); err != nil {
+			return err
+		}
+	}
+
+	user, err := s.findUser(ctx, login)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotExists) {
+			s.Log.Debug("password reset requested for unknown login", "login", login)
+			return nil
+		}
+		return fmt.Errorf("failed get user: %w", err)
+	}
+
+	resetToken, err := randomString(resetTokenLen)
+	if err != nil {
+		return err
+	}
+	reset := &storage.PasswordReset{
+		ExpiresAt: time.Now().Add(s.Config.Auth.PasswordResetTTL),
+		UserID:    user.ID,
+		Hash:      hashToken(resetToken),
+	}
+	if err = s.Storage.SavePasswordReset(ctx, reset); err != nil {
+		return fmt.Errorf("failed save password reset: %w", err)
+	}
+	if err = s.notifier().NotifyPasswordReset(ctx, user.Login, resetToken, reset.ExpiresAt); err != nil {
+		return fmt.Errorf("failed notify password reset: %w", err)
+	}
+
+	return nil
+}
+
+// ResetPassword sets the new password by the reset token and revokes every session of the user.
+func (s *Service) ResetPassword(ctx context.Context, req *password.ResetConfirmRequest) error {
+	// the login is unknown until the token is used, so the password isn't compared with it
+	if err := s.checkNewPassword("", req.NewPassword); err != nil {
+		return err
+	}
+	encrypted, err := s.hashPassword(req.NewPassword)
+	if err != nil {
+		return fmt.Errorf("failed hashPassword new password: %w", err)
+	}
+	userID, err := s.Storage.ResetPassword(ctx, hashToken(req.Token), encrypted, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed reset password: %w", err)
+	}
+	s.forgetUserTokens(userID)
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/RIBorisov/gophermart/internal/config"
+	"github.com/RIBorisov/gophermart/internal/models/policy"
+)
+
+// Policy checks logins and passwords of new users and new passwords of existing ones.
+type Policy struct {
+	loginPattern *regexp.Regexp
+	denyList     map[string]struct{}
+	cfg          config.Policy
+}
+
+// NewPolicy compiles the login pattern and loads the password deny list.
+func NewPolicy(cfg config.Policy) (*Policy, error) {
+	pattern, err := regexp.Compile(cfg.LoginPattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed compile login pattern: %w", err)
+	}
+	p := &Policy{loginPattern: pattern, denyList: make(map[string]struct{}), cfg: cfg}
+
+	if cfg.PasswordDenyListFile == "" {
+		return p, nil
+	}
+	f, err := os.Open(cfg.PasswordDenyListFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed open password deny list: %w", err)
+	}
+	defer f.Close() //nolint:errcheck // nothing to flush on read
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.denyList[strings.ToLower(line)] = struct{}{}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed read password deny list: %w", err)
+	}
+
+	return p, nil
+}
+
+// NormalizeLogin makes logins differing in case or surrounding spaces the same.
+func NormalizeLogin(login string) string {
+	return strings.ToLower(strings.TrimSpace(login))
+}
+
+// CheckLogin expects normalized login.
+func (p *Policy) CheckLogin(login string) []policy.Violation {
+	var violations []policy.Violation
+	add := func(rule, format string, args ...any) {
+		violations = append(violations, policy.Violation{
+			Field: policy.FieldLogin, Rule: rule, Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	length := utf8.RuneCountInString(login)
+	switch {
+	case length == 0:
+		add(policy.RuleRequired, "login is required")
+		return violations
+	case length < p.cfg.LoginMinLength:
+		add(policy.RuleMinLength, "login must be at least %d characters long", p.cfg.LoginMinLength)
+	case p.cfg.LoginMaxLength > 0 && length > p.cfg.LoginMaxLength:
+		add(policy.RuleMaxLength, "login must be at most %d characters long", p.cfg.LoginMaxLength)
+	}
+	if !p.loginPattern.MatchString(login) {
+		add(policy.RuleCharset, "login must match %s", p.loginPattern)
+	}
+
+	return violations
+}
+
+// CheckPassword checks the password of the user with the normalized login.
+func (p *Policy) CheckPassword(login, password string) []policy.Violation {
+	var violations []policy.Violation
+	add := func(rule, format string, args ...any) {
+		violations = append(violations, policy.Violation{
+			Field: policy.FieldPassword, Rule: rule, Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	length := utf8.RuneCountInString(password)
+	switch {
+	case length == 0:
+		add(policy.RuleRequired, "password is required")
+		return violations
+	case length < p.cfg.PasswordMinLength:
+		add(policy.RuleMinLength, "password must be at least %d characters long", p.cfg.PasswordMinLength)
+	case p.cfg.PasswordMaxLength > 0 && length > p.cfg.PasswordMaxLength:
+		add(policy.RuleMaxLength, "password must be at most %d characters long", p.cfg.PasswordMaxLength)
+	}
+	lower := strings.ToLower(password)
+	if _, ok := p.denyList[lower]; ok {
+		add(policy.RuleDenyList, "password is too common")
+	}
+	if login != "" && lower == login {
+		add(policy.RuleSameAsUser, "password must differ from login")
+	}
+
+	return violations
+}
+
+// PolicyError lists every violated rule, handlers respond with them as is.
+type PolicyError struct {
+	Violations []policy.Violation
+}
+
+func (e *PolicyError) Error() string {
+	rules := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		rules = append(rules, v.Field+": "+v.Rule)
+	}
+	return "policy violated: " + strings.Join(rules, ", ")
+}
+
+// checkRegistration returns *PolicyError listing violations of the normalized login and the password.
+// Nothing is checked when the policy is disabled (nil).
+func (s *Service) checkRegistration(login, password string) error {
+	if s.Policy == nil {
+		return nil
+	}
+
+	return policyError(append(s.Policy.CheckLogin(login), s.Policy.CheckPassword(login, password)...))
+}
+
+// checkNewPassword is checkRegistration for the password only, login may be empty when it isn't known.
+func (s *Service) checkNewPassword(login, password string) error {
+	if s.Policy == nil {
+		return nil
+	}
+
+	return policyError(s.Policy.CheckPassword(login, password))
+}
+
+func policyError(violations []policy.Violation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	return &PolicyError{Violations: violations}
+}
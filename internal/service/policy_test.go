@@ -0,0 +1,87 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/RIBorisov/gophermart/internal/config"
+	"github.com/RIBorisov/gophermart/internal/models/policy"
+)
+
+func TestPolicy(t *testing.T) {
+	denyList := filepath.Join(t.TempDir(), "deny.txt")
+	if err := os.WriteFile(denyList, []byte("# common passwords\nPassword1\n\nqwerty123\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewPolicy(config.Policy{
+		LoginPattern:         "^[a-z0-9][a-z0-9._@-]*$",
+		LoginMinLength:       3,
+		LoginMaxLength:       8,
+		PasswordMinLength:    8,
+		PasswordMaxLength:    16,
+		PasswordDenyListFile: denyList,
+	})
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		login     string
+		password  string
+		wantRules []string
+	}{
+		{name: "Positive #1", login: "vasiliy", password: "kOp0x,^1s"},
+		{name: "Positive #2", login: "v.pupkin", password: "12345678"},
+		{name: "Empty", login: "", password: "", wantRules: []string{
+			"login:" + policy.RuleRequired, "password:" + policy.RuleRequired,
+		}},
+		{name: "Short", login: "va", password: "1234567", wantRules: []string{
+			"login:" + policy.RuleMinLength, "password:" + policy.RuleMinLength,
+		}},
+		{name: "Long", login: "vasiliy.pupkin", password: "12345678901234567", wantRules: []string{
+			"login:" + policy.RuleMaxLength, "password:" + policy.RuleMaxLength,
+		}},
+		{name: "Charset", login: "vas iliy", password: "kOp0x,^1s", wantRules: []string{
+			"login:" + policy.RuleCharset,
+		}},
+		{name: "Several login rules", login: "-", password: "kOp0x,^1s", wantRules: []string{
+			"login:" + policy.RuleMinLength, "login:" + policy.RuleCharset,
+		}},
+		{name: "Deny list ignores case", login: "vasiliy", password: "PASSWORD1", wantRules: []string{
+			"password:" + policy.RuleDenyList,
+		}},
+		{name: "Same as login", login: "vasiliy1", password: "Vasiliy1", wantRules: []string{
+			"password:" + policy.RuleSameAsUser,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotRules []string
+			for _, v := range append(p.CheckLogin(tt.login), p.CheckPassword(tt.login, tt.password)...) {
+				gotRules = append(gotRules, v.Field+":"+v.Rule)
+			}
+			if !reflect.DeepEqual(gotRules, tt.wantRules) {
+				t.Fatalf("violated rules = %v, want %v", gotRules, tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestNewPolicyErrors(t *testing.T) {
+	if _, err := NewPolicy(config.Policy{LoginPattern: "["}); err == nil {
+		t.Fatal("NewPolicy() error = nil for invalid pattern")
+	}
+	missing := filepath.Join(t.TempDir(), "missing.txt")
+	if _, err := NewPolicy(config.Policy{LoginPattern: ".*", PasswordDenyListFile: missing}); err == nil {
+		t.Fatal("NewPolicy() error = nil for missing deny list")
+	}
+}
+
+func TestNormalizeLogin(t *testing.T) {
+	if got := NormalizeLogin("  Vasiliy.Pupkin "); got != "vasiliy.pupkin" {
+		t.Fatalf("NormalizeLogin() = %q, want vasiliy.pupkin", got)
+	}
+}
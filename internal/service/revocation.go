@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/RIBorisov/gophermart/internal/models"
+)
+
+// RevocationCache keeps CheckToken results in process. Revoked tokens are remembered until they expire,
+// tokens found valid are checked in storage again after the cache TTL.
+type RevocationCache struct {
+	entries   map[string]revocationEntry
+	lastPrune time.Time
+	ttl       time.Duration
+	mu        sync.Mutex
+}
+
+type revocationEntry struct {
+	until   time.Time
+	userID  string
+	revoked bool
+}
+
+func NewRevocationCache(ttl time.Duration) *RevocationCache {
+	return &RevocationCache{entries: make(map[string]revocationEntry), lastPrune: time.Now(), ttl: ttl}
+}
+
+func (c *RevocationCache) get(jti string) (revoked, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[jti]
+	if !ok || time.Now().After(e.until) {
+		return false, false
+	}
+
+	return e.revoked, true
+}
+
+func (c *RevocationCache) put(claims *Claims, revoked bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	until := now.Add(c.ttl)
+	if revoked && claims.ExpiresAt != nil {
+		until = claims.ExpiresAt.Time
+	}
+	c.entries[claims.ID] = revocationEntry{until: until, userID: claims.UserID, revoked: revoked}
+
+	if now.Sub(c.lastPrune) < c.ttl {
+		return
+	}
+	c.lastPrune = now
+	for jti, e := range c.entries {
+		if now.After(e.until) {
+			delete(c.entries, jti)
+		}
+	}
+}
+
+// forgetUser drops the user tokens found valid, so they are checked in storage again.
+func (c *RevocationCache) forgetUser(userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for jti, e := range c.entries {
+		if e.userID == userID && !e.revoked {
+			delete(c.entries, jti)
+		}
+	}
+}
+
+// ClaimsFromContext returns claims of the authenticated request, see middleware.CheckAuth.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(models.CtxClaimsKey).(*Claims)
+	return claims, ok
+}
+
+// CheckToken returns ErrTokenRevoked when the token or its session has been revoked by Logout,
+// LogoutAll or refresh token reuse, or when it is issued before the user has logged out of all sessions.
+func (s *Service) CheckToken(ctx context.Context, claims *Claims) error {
+	if claims.ID == "" || claims.IssuedAt == nil {
+		// tokens issued before revocation support can't be revoked one by one
+		return ErrTokenRevoked
+	}
+	if s.Revocations != nil {
+		if revoked, ok := s.Revocations.get(claims.ID); ok {
+			if revoked {
+				return ErrTokenRevoked
+			}
+			return nil
+		}
+	}
+
+	state, err := s.Storage.GetTokenState(ctx, claims.ID, claims.UserID, claims.SessionID)
+	if err != nil {
+		return fmt.Errorf("failed get token state: %w", err)
+	}
+	revoked := state.Revoked || issuedBeforeCutoff(claims, state.ValidAfter)
+	if s.Revocations != nil {
+		s.Revocations.put(claims, revoked)
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+
+	return nil
+}
+
+// Logout revokes the access token and the refresh tokens of its session.
+func (s *Service) Logout(ctx context.Context, claims *Claims) error {
+	if err := s.Storage.RevokeSession(ctx, claims.ID, claims.ExpiresAt.Time, claims.SessionID); err != nil {
+		return fmt.Errorf("failed revoke session: %w", err)
+	}
+	if s.Revocations != nil {
+		s.Revocations.put(claims, true)
+	}
+
+	return nil
+}
+
+// LogoutAll revokes every access and refresh token of the user issued so far.
+func (s *Service) LogoutAll(ctx context.Context, claims *Claims) error {
+	if err := s.revokeUserSessions(ctx, claims.UserID); err != nil {
+		return err
+	}
+
+	return s.Logout(ctx, claims)
+}
+
+// issuedBeforeCutoff tells whether the token has been issued before the user has logged out of all sessions.
+// iat has whole seconds, so tokens without a session are rejected within the second of the cutoff as well.
+// Tokens of the sessions existing at the cutoff are rejected by their revoked refresh token family,
+// so a session started within that second, e.g. by ChangePassword, keeps working.
+func issuedBeforeCutoff(claims *Claims, cutoff time.Time) bool {
+	if cutoff.IsZero() {
+		return false
+	}
+	if claims.SessionID != "" {
+		return claims.IssuedAt.Unix() < cutoff.Unix()
+	}
+	return claims.IssuedAt.Unix() <= cutoff.Unix()
+}
+
+func (s *Service) revokeUserSessions(ctx context.Context, userID string) error {
+	if err := s.Storage.RevokeUserSessions(ctx, userID, time.Now()); err != nil {
+		return fmt.Errorf("failed revoke user sessions: %w", err)
+	}
+	s.forgetUserTokens(userID)
+
+	return nil
+}
+
+// forgetUserTokens makes the cached tokens of the user checked in storage again after its sessions are revoked.
+func (s *Service) forgetUserTokens(userID string) {
+	if s.Revocations != nil {
+		s.Revocations.forgetUser(userID)
+	}
+}
+
+var ErrTokenRevoked = errors.New("token has been revoked")
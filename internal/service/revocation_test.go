@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/RIBorisov/gophermart/internal/config"
+	"github.com/RIBorisov/gophermart/internal/logger"
+	"github.com/RIBorisov/gophermart/internal/models/register"
+	"github.com/RIBorisov/gophermart/internal/storage"
+)
+
+func TestRevokeUserSessionsCutoff(t *testing.T) {
+	ctx := context.Background()
+	log := &logger.Log{}
+	log.Initialize("ERROR")
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	keys, err := NewEphemeralKeySet()
+	if err != nil {
+		t.Fatalf("NewEphemeralKeySet() error = %v", err)
+	}
+	mem := storage.NewMemory()
+	svc := &Service{Config: cfg, Log: log, Storage: mem, Keys: keys}
+
+	userID, err := mem.SaveUser(ctx, &register.Request{Login: "vasiliy", Password: "pwd"})
+	if err != nil {
+		t.Fatalf("SaveUser() error = %v", err)
+	}
+	// the challenge token has no session, so only the cutoff can reject it
+	challenge, err := svc.twoFactorChallenge(userID)
+	if err != nil {
+		t.Fatalf("twoFactorChallenge() error = %v", err)
+	}
+	revoked, err := svc.IssueTokens(ctx, userID, "")
+	if err != nil {
+		t.Fatalf("IssueTokens() error = %v", err)
+	}
+	if err = svc.revokeUserSessions(ctx, userID); err != nil {
+		t.Fatalf("revokeUserSessions() error = %v", err)
+	}
+	tokens, err := svc.IssueTokens(ctx, userID, "")
+	if err != nil {
+		t.Fatalf("IssueTokens() error = %v", err)
+	}
+
+	tests := []struct {
+		wantErr error
+		name    string
+		token   string
+	}{
+		{name: "issued before the cutoff", token: challenge.TwoFactorToken, wantErr: ErrTokenRevoked},
+		{name: "session started before the cutoff", token: revoked.AccessToken, wantErr: ErrTokenRevoked},
+		{name: "session started after the cutoff", token: tokens.AccessToken},
+	}
+	for _, tt := range tests {
+		claims, err := svc.ParseToken(tt.token)
+		if err != nil {
+			t.Fatalf("%s: ParseToken() error = %v", tt.name, err)
+		}
+		if err = svc.CheckToken(ctx, claims); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: CheckToken() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -4,56 +4,180 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"net/http"
 	"sort"
-	"strconv"
+	"sync/atomic"
 	"time"
 
-	"github.com/go-resty/resty/v2"
 	"github.com/golang-jwt/jwt/v4"
-	"golang.org/x/crypto/bcrypt"
 
 	"github.com/RIBorisov/gophermart/internal/config"
 	"github.com/RIBorisov/gophermart/internal/logger"
 	accmodels "github.com/RIBorisov/gophermart/internal/models/accrual"
+	"github.com/RIBorisov/gophermart/internal/models/admin"
 	"github.com/RIBorisov/gophermart/internal/models/balance"
+	"github.com/RIBorisov/gophermart/internal/models/health"
+	"github.com/RIBorisov/gophermart/internal/models/ledger"
 	"github.com/RIBorisov/gophermart/internal/models/orders"
 	"github.com/RIBorisov/gophermart/internal/models/register"
+	"github.com/RIBorisov/gophermart/internal/models/token"
 	"github.com/RIBorisov/gophermart/internal/storage"
 )
 
 type Store interface {
 	SaveUser(ctx context.Context, user *register.Request) (string, error)
 	GetUser(ctx context.Context, login string) (*storage.UserRow, error)
+	GetUserByID(ctx context.Context, userID string) (*storage.UserRow, error)
+	UpdatePassword(ctx context.Context, userID, password string) error
+	ChangePassword(ctx context.Context, userID, password string, cutoff time.Time) error
+	SavePasswordReset(ctx context.Context, reset *storage.PasswordReset) error
+	ResetPassword(ctx context.Context, hash []byte, password string, cutoff time.Time) (string, error)
+	GetTwoFactor(ctx context.Context, userID string) (*storage.TwoFactor, error)
+	SaveTOTPSecret(ctx context.Context, userID string, secret []byte) error
+	EnableTwoFactor(ctx context.Context, userID string, step int64, recoveryCodes [][]byte) error
+	UseTOTPStep(ctx context.Context, userID string, step int64) error
+	UseRecoveryCode(ctx context.Context, userID string, hash []byte) error
+	DisableTwoFactor(ctx context.Context, userID string) error
+	SearchUsers(ctx context.Context, loginPrefix string, limit int) ([]storage.UserRow, error)
+	CountPasswordHashesWithoutPrefix(ctx context.Context, prefixes []string) (int, error)
+	SetUserRole(ctx context.Context, userID string, role admin.Role) error
+	SetUserBlocked(ctx context.Context, userID string, blocked bool) error
+	AdjustBalance(ctx context.Context, adj *admin.Adjustment) error
+	GetAdjustments(ctx context.Context, userID string) ([]admin.Adjustment, error)
+	SaveRefreshToken(ctx context.Context, token *storage.RefreshToken) error
+	RotateRefreshToken(ctx context.Context, used []byte, next *storage.RefreshToken) error
+	GetTokenState(ctx context.Context, jti, userID, sessionID string) (*storage.TokenState, error)
+	RevokeSession(ctx context.Context, jti string, expiresAt time.Time, familyID string) error
+	RevokeUserSessions(ctx context.Context, userID string, cutoff time.Time) error
+	GetLoginFailures(ctx context.Context, keys []string) (map[string]storage.LoginFailures, error)
+	AddLoginFailure(ctx context.Context, key string, now time.Time, limit storage.LoginFailureLimit) (bool, error)
+	DeleteLoginFailures(ctx context.Context, key string) (bool, error)
+	PruneLoginFailures(ctx context.Context, now, before time.Time) error
 	SaveOrder(ctx context.Context, orderNo string) error
 	GetUserOrders(ctx context.Context) ([]storage.OrderEntity, error)
 	GetBalance(ctx context.Context) (*storage.BalanceEntity, error)
 	BalanceWithdraw(ctx context.Context, req balance.WithdrawRequest) error
 	GetWithdrawals(ctx context.Context) ([]storage.WithdrawalsEntity, error)
-	GetOrdersList(ctx context.Context) ([]string, error)
+	GetLedger(ctx context.Context) ([]storage.LedgerEntity, error)
+	ReconcileLedger(ctx context.Context) ([]storage.LedgerMismatch, error)
+	GetOrdersList(ctx context.Context, lease *orders.Lease) ([]orders.Pending, error)
 	UpdateOrder(ctx context.Context, data *orders.UpdateOrder) error
+	FailOrder(ctx context.Context, data *orders.Failure) error
 	ClosePool() error
 }
 
+// AccrualClient requests order info from the accrual system. Besides the successful response
+// implementations model the accrual system contract with typed errors: ErrOrderNotRegistered
+// for unknown order, *ToManyRequestsError for exceeded rate limit and *AccrualServerError
+// for failure of the accrual system itself.
+type AccrualClient interface {
+	FetchOrderInfo(ctx context.Context, orderNo string) (*accmodels.OrderInfoResponse, error)
+}
+
+// BatchAccrualClient is implemented by AccrualClient able to look many orders up with one request.
+// Orders missing in FetchOrdersInfo result are not registered in the accrual system.
+type BatchAccrualClient interface {
+	AccrualClient
+	FetchOrdersInfo(ctx context.Context, orderNos []string) (map[string]*accmodels.OrderInfoResponse, error)
+	// BatchSupported is false when batch lookup is not configured or the accrual system turned out
+	// to have no batch endpoint.
+	BatchSupported() bool
+}
+
+// AccrualStats is a snapshot of the accrual pipeline exposed in health output and metrics.
+type AccrualStats struct {
+	// BreakerState is one of "closed", "open" and "half-open".
+	BreakerState string
+	Processed    int64
+	Failed       int64
+	DeadLettered int64
+	Restarts     int64
+}
+
+const breakerClosed = "closed"
+
+// AccrualMonitor reports state of the accrual pipeline.
+type AccrualMonitor interface {
+	Stats() AccrualStats
+}
+
 type Service struct {
 	Log     *logger.Log
 	Storage Store
-	Config  *config.Config
+	Accrual AccrualClient
+	Monitor AccrualMonitor
+	// Revocations caches CheckToken results, tokens are checked in storage every time when it is nil.
+	Revocations *RevocationCache
+	// Keys signs and verifies access tokens.
+	Keys *KeySet
+	// Notifier delivers password reset tokens, they are written to the log when it is nil.
+	Notifier Notifier
+	// Policy checks new logins and passwords, only their presence is checked when it is nil.
+	Policy *Policy
+	// LoginGuard throttles password guessing, logins aren't limited when it is nil.
+	LoginGuard *LoginGuard
+	// Hasher hashes and verifies passwords, it is made of the config when nil.
+	Hasher *PasswordHasher
+	Config *config.Config
+	// ledgerMismatches is the number of users whose balance didn't reconcile with the ledger
+	// at the last ReconcileLedger.
+	ledgerMismatches atomic.Int64
+}
+
+// passwordHasher returns Hasher or, when it isn't set, the hasher made of the config.
+func (s *Service) passwordHasher() (*PasswordHasher, error) {
+	if s.Hasher != nil {
+		return s.Hasher, nil
+	}
+	return NewPasswordHasher(s.Config.PasswordHash, s.Config.Secret)
 }
 
-func hashPassword(secret, data string) (string, error) {
-	hashed, err := bcrypt.GenerateFromPassword([]byte(data+secret), bcrypt.DefaultCost)
+func (s *Service) hashPassword(password string) (string, error) {
+	hasher, err := s.passwordHasher()
 	if err != nil {
-		return "", fmt.Errorf("failed hash password: %w", err)
+		return "", err
 	}
+	return hasher.Hash(password)
+}
 
-	return string(hashed), nil
+// verifyPassword returns ErrIncorrectPassword when the password doesn't match the hash,
+// otherwise it reports whether the hash has to be remade.
+func (s *Service) verifyPassword(encoded, password string) (bool, error) {
+	hasher, err := s.passwordHasher()
+	if err != nil {
+		return false, err
+	}
+	return hasher.Verify(encoded, password)
 }
 
-func comparePasswords(secret, hashedPassword, password string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password+secret))
+// rehashPassword upgrades the hash of the password just verified, the user is logged in anyway.
+func (s *Service) rehashPassword(ctx context.Context, userID, password string) {
+	encrypted, err := s.hashPassword(password)
+	if err == nil {
+		err = s.Storage.UpdatePassword(ctx, userID, encrypted)
+	}
 	if err != nil {
-		return ErrIncorrectPassword
+		s.Log.Warn("failed rehash password", "user_id", userID, "error", err)
+		return
+	}
+	s.Log.Debug("password rehashed", "user_id", userID)
+}
+
+// CheckLegacyPasswordHashes fails when users still have hashes of the former bcrypt with SECRET_KEY scheme
+// and SECRET_KEY isn't set, so the service doesn't start instead of failing their logins.
+func (s *Service) CheckLegacyPasswordHashes(ctx context.Context) error {
+	hasher, err := s.passwordHasher()
+	if err != nil {
+		return err
+	}
+	if hasher.legacyKey != "" {
+		return nil
+	}
+	count, err := s.Storage.CountPasswordHashesWithoutPrefix(ctx, []string{argon2Prefix, bcryptPrefix})
+	if err != nil {
+		return fmt.Errorf("failed count legacy password hashes: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %d users have them, set SECRET_KEY to the key they were made with", ErrNoLegacyKey, count)
 	}
 
 	return nil
@@ -62,61 +186,132 @@ func comparePasswords(secret, hashedPassword, password string) error {
 type Claims struct {
 	jwt.RegisteredClaims
 	UserID string
+	// SessionID is the refresh token family the access token has been issued with.
+	SessionID string `json:"sid,omitempty"`
+	// Scope limits what the token is good for, access tokens have none, see ScopeTwoFactor.
+	Scope string `json:"scope,omitempty"`
+	// Role grants access to operator endpoints, tokens without it have the user role.
+	Role admin.Role `json:"role,omitempty"`
 }
 
-func (s *Service) BuildJWTString(secretKey string, userID string) (string, error) {
-	const tokenExp = time.Hour * 720
+// BuildJWTString issues the access token living for ACCESS_TOKEN_TTL with unique jti, so it can be revoked.
+// The token is signed with the signing key of the service key set.
+func (s *Service) BuildJWTString(userID, sessionID string, role admin.Role) (string, error) {
+	return s.buildToken(&Claims{UserID: userID, SessionID: sessionID, Role: role}, s.Config.Auth.AccessTokenTTL)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenExp)),
-		},
-		UserID: userID,
-	})
+// ParseToken verifies the access token signature and expiration and returns its claims.
+func (s *Service) ParseToken(tokenString string) (*Claims, error) {
+	return s.Keys.Parse(tokenString)
+}
 
-	tokenString, err := token.SignedString([]byte(secretKey))
-	if err != nil {
-		return "", fmt.Errorf("failed to create token string: %w", err)
+func (s *Service) RegisterUser(ctx context.Context, user *register.Request) (token.Response, error) {
+	if s.Policy != nil {
+		user.Login = NormalizeLogin(user.Login)
+	}
+	if err := s.checkRegistration(user.Login, user.Password); err != nil {
+		return token.Response{}, err
 	}
 
-	return tokenString, nil
-}
-
-func (s *Service) RegisterUser(ctx context.Context, user *register.Request) (string, error) {
-	encrypted, err := hashPassword(s.Config.Secret.SecretKey, user.Password)
+	encrypted, err := s.hashPassword(user.Password)
 	if err != nil {
-		return "", fmt.Errorf("failed hashPassword user data: %w", err)
+		return token.Response{}, fmt.Errorf("failed hashPassword user data: %w", err)
 	}
 	user.Password = encrypted
 
 	userID, err := s.Storage.SaveUser(ctx, user)
 	if err != nil {
-		return "", fmt.Errorf("failed register user: %w", err)
+		return token.Response{}, fmt.Errorf("failed register user: %w", err)
 	}
 
-	authToken, err := s.BuildJWTString(s.Config.Secret.SecretKey, userID)
+	tokens, err := s.IssueTokens(ctx, userID, admin.RoleUser)
 	if err != nil {
-		return "", fmt.Errorf("failed generate authorization token: %w", err)
+		return token.Response{}, fmt.Errorf("failed generate authorization token: %w", err)
 	}
 
-	return authToken, nil
+	return tokens, nil
 }
 
-func (s *Service) LoginUser(ctx context.Context, user *register.Request) (string, error) {
-	fromDB, err := s.Storage.GetUser(ctx, user.Login)
+// LoginUser checks the password unless the login or the client address has to wait after failed attempts,
+// then *LoginThrottledError is returned. Users with the second factor enabled get TwoFactorToken
+// for CompleteLogin instead of the tokens. Blocked users get ErrUserBlocked once the password is verified,
+// so the block isn't disclosed to whoever guesses passwords.
+func (s *Service) LoginUser(ctx context.Context, user *register.Request, clientIP string) (token.Response, error) {
+	if err := s.checkLoginAllowed(ctx, user.Login, clientIP); err != nil {
+		return token.Response{}, err
+	}
+
+	fromDB, err := s.findUser(ctx, user.Login)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotExists) {
+			s.loginFailed(ctx, user.Login, clientIP)
+		}
+		return token.Response{}, fmt.Errorf("failed get user from DB: %w", err)
+	}
+
+	rehash, err := s.verifyPassword(fromDB.Password, user.Password)
 	if err != nil {
-		return "", fmt.Errorf("failed get user from DB: %w", err)
+		if errors.Is(err, ErrIncorrectPassword) {
+			s.loginFailed(ctx, user.Login, clientIP)
+			return token.Response{}, ErrIncorrectPassword
+		}
+		return token.Response{}, fmt.Errorf("failed verify password: %w", err)
+	}
+	if rehash {
+		s.rehashPassword(ctx, fromDB.ID, user.Password)
+	}
+	if fromDB.BlockedAt != nil {
+		return token.Response{}, ErrUserBlocked
 	}
 
-	if err = comparePasswords(s.Config.Secret.SecretKey, fromDB.Password, user.Password); err != nil {
-		return "", ErrIncorrectPassword
+	tf, err := s.Storage.GetTwoFactor(ctx, fromDB.ID)
+	if err != nil {
+		return token.Response{}, fmt.Errorf("failed get two-factor state: %w", err)
 	}
-	authToken, err := s.BuildJWTString(s.Config.Secret.SecretKey, fromDB.ID)
+	if tf.Enabled {
+		// failures are kept until the second factor succeeds, otherwise the right password
+		// would reset the limit of code guesses
+		return s.twoFactorChallenge(fromDB.ID)
+	}
+	s.loginSucceeded(ctx, user.Login)
+
+	tokens, err := s.IssueTokens(ctx, fromDB.ID, fromDB.Role)
 	if err != nil {
-		return "", fmt.Errorf("failed generate authToken: %w", err)
+		return token.Response{}, fmt.Errorf("failed generate authToken: %w", err)
 	}
 
-	return authToken, nil
+	return tokens, nil
+}
+
+// loginFailed counts the failed attempt, the error is only logged since the attempt has failed anyway.
+func (s *Service) loginFailed(ctx context.Context, login, clientIP string) {
+	if s.LoginGuard == nil {
+		return
+	}
+	locked, err := s.LoginGuard.Fail(ctx, login, clientIP)
+	if err != nil {
+		s.Log.Warn("failed count login failure", "login", login, "error", err)
+		return
+	}
+	if locked {
+		s.Log.Warn("login locked after failed attempts", "login", login, "ip", clientIP)
+	}
+}
+
+// findUser looks the user up by normalized login when the policy is enabled. Users registered
+// before the normalization are found by the login as is.
+func (s *Service) findUser(ctx context.Context, login string) (*storage.UserRow, error) {
+	if s.Policy == nil {
+		return s.Storage.GetUser(ctx, login)
+	}
+
+	normalized := NormalizeLogin(login)
+	user, err := s.Storage.GetUser(ctx, normalized)
+	if errors.Is(err, storage.ErrUserNotExists) && normalized != login {
+		return s.Storage.GetUser(ctx, login)
+	}
+
+	return user, err
 }
 
 func (s *Service) CreateOrder(ctx context.Context, orderNo string) error {
@@ -158,7 +353,12 @@ func (s *Service) GetBalance(ctx context.Context) (balance.Response, error) {
 	return balance.Response{Current: raw.Current, Withdrawn: raw.Withdrawn}, nil
 }
 
-func (s *Service) BalanceWithdraw(ctx context.Context, withdraw balance.WithdrawRequest) error {
+// BalanceWithdraw takes the second factor code for withdrawals above WITHDRAW_2FA_THRESHOLD,
+// ErrTwoFactorRequired is returned when there is none or the user hasn't enabled the second factor.
+func (s *Service) BalanceWithdraw(ctx context.Context, withdraw balance.WithdrawRequest, code string) error {
+	if err := s.checkWithdrawal(ctx, withdraw, code); err != nil {
+		return err
+	}
 	if err := s.Storage.BalanceWithdraw(ctx, withdraw); err != nil {
 		return fmt.Errorf("failed make balance withdraw request: %w", err)
 	}
@@ -190,8 +390,70 @@ func (s *Service) GetWithdrawals(ctx context.Context) ([]balance.Withdrawal, err
 	return wList, nil
 }
 
-func (s *Service) GetOrdersForProcessing(ctx context.Context) ([]string, error) {
-	oList, err := s.Storage.GetOrdersList(ctx)
+// GetLedger returns ledger entries of the user together with the balance derived from them.
+// The derived balance is verified against the stored one and any drift is reported.
+func (s *Service) GetLedger(ctx context.Context) (ledger.Response, error) {
+	raw, err := s.Storage.GetLedger(ctx)
+	if err != nil {
+		return ledger.Response{}, fmt.Errorf("failed get ledger from storage: %w", err)
+	}
+
+	resp := ledger.Response{Entries: make([]ledger.Entry, 0, len(raw))}
+	for _, e := range raw {
+		resp.Balance += e.Amount
+		resp.Entries = append(resp.Entries, ledger.Entry{
+			ID:        e.ID,
+			Kind:      e.Kind,
+			Order:     e.OrderID,
+			Amount:    e.Amount,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+	sort.Slice(resp.Entries, func(i, j int) bool {
+		return resp.Entries[i].ID > resp.Entries[j].ID
+	})
+
+	current, err := s.Storage.GetBalance(ctx)
+	if err != nil {
+		return ledger.Response{}, fmt.Errorf("failed get balance from storage: %w", err)
+	}
+	if current.Current != resp.Balance {
+		s.Log.Warn("ledger does not reconcile with balance",
+			"balance", current.Current, "ledger", resp.Balance)
+	}
+
+	return resp, nil
+}
+
+// ReconcileLedger compares the balance of every user with the ledger, the users which don't reconcile
+// are logged and counted in LedgerMismatches.
+func (s *Service) ReconcileLedger(ctx context.Context) error {
+	mList, err := s.Storage.ReconcileLedger(ctx)
+	if err != nil {
+		return fmt.Errorf("failed reconcile ledger in storage: %w", err)
+	}
+	for _, m := range mList {
+		s.Log.Warn("ledger does not reconcile with balance",
+			"user_id", m.UserID, "balance", m.Balance, "ledger", m.Ledger)
+	}
+	s.ledgerMismatches.Store(int64(len(mList)))
+
+	return nil
+}
+
+// LedgerMismatches returns the number of users found not reconciling by the last ReconcileLedger.
+func (s *Service) LedgerMismatches() int64 {
+	return s.ledgerMismatches.Load()
+}
+
+// GetOrdersForProcessing claims a batch of orders for this instance, see Store.GetOrdersList.
+func (s *Service) GetOrdersForProcessing(ctx context.Context) ([]orders.Pending, error) {
+	lease := &orders.Lease{
+		Owner:     s.Config.Service.InstanceID,
+		Duration:  s.Config.Service.AccrualClaimLease,
+		BatchSize: s.Config.Service.AccrualClaimBatchSize,
+	}
+	oList, err := s.Storage.GetOrdersList(ctx, lease)
 	if err != nil {
 		return nil, err
 	}
@@ -199,45 +461,89 @@ func (s *Service) GetOrdersForProcessing(ctx context.Context) ([]string, error)
 	return oList, nil
 }
 
-func (s *Service) FetchOrderInfo(
+// FetchOrderInfo requests accrual info of the order with the configured AccrualClient.
+func (s *Service) FetchOrderInfo(ctx context.Context, orderNo string) (*accmodels.OrderInfoResponse, error) {
+	s.Log.Debug("fetching order info", "order_id", orderNo)
+
+	return s.Accrual.FetchOrderInfo(ctx, orderNo)
+}
+
+// BatchSupported reports whether orders can be looked up with FetchOrdersInfo.
+func (s *Service) BatchSupported() bool {
+	batch, ok := s.Accrual.(BatchAccrualClient)
+	return ok && batch.BatchSupported()
+}
+
+// FetchOrdersInfo requests accrual info of many orders at once, ErrBatchUnsupported is returned
+// when the client has no batch lookup, so the caller falls back to FetchOrderInfo.
+func (s *Service) FetchOrdersInfo(
 	ctx context.Context,
-	client *resty.Client,
-	orderNo string,
-) (*accmodels.OrderInfoResponse, error) {
-	var updatedInfo accmodels.OrderInfoResponse
+	orderNos []string,
+) (map[string]*accmodels.OrderInfoResponse, error) {
+	batch, ok := s.Accrual.(BatchAccrualClient)
+	if !ok || !batch.BatchSupported() {
+		return nil, ErrBatchUnsupported
+	}
+	s.Log.Debug("fetching orders info", "count", len(orderNos))
 
-	url := s.Config.Service.AccrualSystemAddress + s.Config.Service.AccrualOrderInfoRoute
+	return batch.FetchOrdersInfo(ctx, orderNos)
+}
 
-	s.Log.Debug("fetching order info", "order_id", orderNo)
-	resp, err := client.R().
-		SetContext(ctx).
-		SetPathParam("orderID", orderNo).
-		SetResult(&updatedInfo).
-		Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed make request to accrual: %w", err)
+// Health reports the service status, it is degraded while the accrual circuit breaker isn't closed.
+func (s *Service) Health() health.Response {
+	resp := health.Response{Status: health.StatusOK}
+	if s.Monitor == nil {
+		return resp
 	}
 
-	if resp.StatusCode() == http.StatusTooManyRequests {
-		retryAfter, convertErr := strconv.Atoi(resp.Header().Get("Retry-After"))
-		if convertErr != nil {
-			return nil, fmt.Errorf("failed convert Retry-After header to int: %w", convertErr)
-		}
-		err := &ToManyRequestsError{
-			RetryAfter: time.Duration(retryAfter) * time.Second,
-			Message:    "Got StatusTooManyRequests error, should wait..."}
-		s.Log.Info(err.Error())
-		return nil, err
+	stats := s.Monitor.Stats()
+	resp.Accrual = health.Accrual{
+		Breaker:      stats.BreakerState,
+		Processed:    stats.Processed,
+		Failed:       stats.Failed,
+		DeadLettered: stats.DeadLettered,
+		Restarts:     stats.Restarts,
+	}
+	if stats.BreakerState != breakerClosed {
+		resp.Status = health.StatusDegraded
+	}
+
+	return resp
+}
+
+// HandleUnregisteredOrder applies the policy to the order which is unknown to the accrual system:
+// it is polled again for ACCRUAL_UNREGISTERED_TTL since upload and then marked INVALID.
+func (s *Service) HandleUnregisteredOrder(ctx context.Context, order *orders.Pending) error {
+	if time.Since(order.UploadedAt) < s.Config.Service.AccrualUnregisteredTTL {
+		s.Log.Debug("order is not registered in accrual system yet", "order_id", order.Number)
+		return s.PostponeOrder(ctx, order)
+	}
+
+	s.Log.Warn("order is not registered in accrual system, marking it invalid", "order_id", order.Number)
+	data := &orders.UpdateOrder{Number: order.Number, Status: orders.Invalid, Owner: s.Config.Service.InstanceID}
+	if err := s.Storage.UpdateOrder(ctx, data); err != nil {
+		return fmt.Errorf("failed invalidate order: '%v', details: %w", order.Number, err)
 	}
 
-	if !resp.IsSuccess() {
-		return nil, fmt.Errorf("got unexpected request error: %s", resp.Error())
+	return nil
+}
+
+// PostponeOrder keeps the order in its current status and schedules the next check with backoff.
+func (s *Service) PostponeOrder(ctx context.Context, order *orders.Pending) error {
+	data := &orders.UpdateOrder{Number: order.Number, Status: order.Status, Owner: s.Config.Service.InstanceID}
+	s.scheduleNextCheck(order, data)
+
+	if err := s.Storage.UpdateOrder(ctx, data); err != nil {
+		return fmt.Errorf("failed postpone order: '%v', details: %w", order.Number, err)
 	}
 
-	return &updatedInfo, nil
+	return nil
 }
 
-func (s *Service) UpdateOrder(ctx context.Context, data *accmodels.OrderInfoResponse) error {
+// UpdateOrder saves accrual info of the order. When the order was claimed for polling, the update
+// requires the lease of this instance and, unless the order is processed, the next check is scheduled
+// with exponential backoff.
+func (s *Service) UpdateOrder(ctx context.Context, order *orders.Pending, data *accmodels.OrderInfoResponse) error {
 	s.Log.Debug("updating order", "order_id", data.Order)
 
 	status, err := data.Status.ConvertToOrderStatus()
@@ -246,6 +552,12 @@ func (s *Service) UpdateOrder(ctx context.Context, data *accmodels.OrderInfoResp
 	}
 
 	updData := &orders.UpdateOrder{Status: status, Number: data.Order, Accrual: data.Accrual}
+	if order != nil {
+		updData.Owner = s.Config.Service.InstanceID
+		if !status.IsFinal() {
+			s.scheduleNextCheck(order, updData)
+		}
+	}
 
 	if err = s.Storage.UpdateOrder(ctx, updData); err != nil {
 		return fmt.Errorf("failed update order: '%v', details: %w", data.Order, err)
@@ -254,16 +566,72 @@ func (s *Service) UpdateOrder(ctx context.Context, data *accmodels.OrderInfoResp
 	return nil
 }
 
+// FailOrder requeues the order which failed processing with exponential backoff by its consecutive failures.
+// After ACCRUAL_MAX_FAILURES failures in a row the order is moved to the dead-letter state and isn't polled anymore.
+// It returns true when the order has been dead-lettered.
+func (s *Service) FailOrder(ctx context.Context, order *orders.Pending, cause error) (bool, error) {
+	cfg := s.Config.Service
+	data := &orders.Failure{
+		Number:      order.Number,
+		Error:       cause.Error(),
+		NextCheckAt: time.Now().Add(nextCheckDelay(cfg.AccrualBackoffBase, cfg.AccrualBackoffMax, order.Failures)),
+		DeadLetter:  order.Failures+1 >= cfg.AccrualMaxFailures,
+		Owner:       cfg.InstanceID,
+	}
+
+	if err := s.Storage.FailOrder(ctx, data); err != nil {
+		return false, fmt.Errorf("failed save order failure: '%v', details: %w", order.Number, err)
+	}
+
+	return data.DeadLetter, nil
+}
+
+// scheduleNextCheck fills in when the order should be polled again and flags it as stuck
+// once it stays unprocessed longer than ACCRUAL_ORDER_MAX_AGE.
+func (s *Service) scheduleNextCheck(order *orders.Pending, data *orders.UpdateOrder) {
+	cfg := s.Config.Service
+	data.NextCheckAt = time.Now().Add(nextCheckDelay(cfg.AccrualBackoffBase, cfg.AccrualBackoffMax, order.Attempts))
+
+	if age := time.Since(order.UploadedAt); age > cfg.AccrualOrderMaxAge {
+		data.Stuck = true
+		s.Log.Warn("order is stuck in accrual system", "order_id", order.Number, "age", age, "attempts", order.Attempts)
+	}
+}
+
 var (
-	ErrNoWithdrawals     = errors.New("user has no withdrawals yet")
-	ErrIncorrectPassword = errors.New("invalid password")
+	ErrNoWithdrawals      = errors.New("user has no withdrawals yet")
+	ErrIncorrectPassword  = errors.New("invalid password")
+	ErrOrderNotRegistered = errors.New("order is not registered in accrual system")
+	ErrBatchUnsupported   = errors.New("accrual batch lookup is not supported")
 )
 
+// AccrualServerError is returned when the accrual system responds with 5xx status.
+type AccrualServerError struct {
+	Body       string
+	StatusCode int
+}
+
+func (e *AccrualServerError) Error() string {
+	return fmt.Sprintf("accrual system error, status: %d, body: %s", e.StatusCode, e.Body)
+}
+
 type ToManyRequestsError struct {
 	Message    string
 	RetryAfter time.Duration
+	// Limit is requests per minute allowed by the accrual system, zero if it is unknown.
+	Limit int
 }
 
 func (e *ToManyRequestsError) Error() string {
-	return fmt.Sprintf("error: %s, duration: %v", e.Message, e.RetryAfter)
+	return fmt.Sprintf("error: %s, duration: %v, limit: %d", e.Message, e.RetryAfter, e.Limit)
+}
+
+// CircuitOpenError is returned instead of calling the accrual system while it is considered down.
+type CircuitOpenError struct {
+	// RetryAfter is the time left until the next probe request is allowed.
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("accrual circuit breaker is open, retry after: %v", e.RetryAfter)
 }
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/RIBorisov/gophermart/internal/models/admin"
+	"github.com/RIBorisov/gophermart/internal/models/token"
+	"github.com/RIBorisov/gophermart/internal/storage"
+)
+
+const (
+	tokenTypeBearer = "Bearer"
+	refreshTokenLen = 32
+	jtiLen          = 16
+	csrfTokenLen    = 32
+)
+
+// IssueTokens starts a new session of the user: a short-lived access token and the first refresh token
+// of a new token family. The access token carries the role of the user.
+func (s *Service) IssueTokens(ctx context.Context, userID string, role admin.Role) (token.Response, error) {
+	refresh, stored, err := s.newRefreshToken()
+	if err != nil {
+		return token.Response{}, err
+	}
+	stored.UserID = userID
+	if err = s.Storage.SaveRefreshToken(ctx, stored); err != nil {
+		return token.Response{}, fmt.Errorf("failed save refresh token: %w", err)
+	}
+
+	return s.tokenResponse(userID, stored.FamilyID, role, refresh)
+}
+
+// RefreshTokens exchanges the refresh token for the next pair of tokens, the presented token can't be used
+// again. Presenting the used token revokes all the tokens of its family, because either the user or
+// an attacker holds a stolen copy. The role is read again, so the next access token follows its changes.
+func (s *Service) RefreshTokens(ctx context.Context, refreshToken string) (token.Response, error) {
+	refresh, next, err := s.newRefreshToken()
+	if err != nil {
+		return token.Response{}, err
+	}
+	if err = s.Storage.RotateRefreshToken(ctx, hashToken(refreshToken), next); err != nil {
+		return token.Response{}, fmt.Errorf("failed rotate refresh token: %w", err)
+	}
+	user, err := s.Storage.GetUserByID(ctx, next.UserID)
+	if err != nil {
+		return token.Response{}, fmt.Errorf("failed get user: %w", err)
+	}
+	if user.BlockedAt != nil {
+		return token.Response{}, ErrUserBlocked
+	}
+
+	return s.tokenResponse(next.UserID, next.FamilyID, user.Role, refresh)
+}
+
+func (s *Service) tokenResponse(userID, sessionID string, role admin.Role, refresh string) (token.Response, error) {
+	access, err := s.BuildJWTString(userID, sessionID, role)
+	if err != nil {
+		return token.Response{}, err
+	}
+
+	return token.Response{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    tokenTypeBearer,
+		ExpiresIn:    int64(s.Config.Auth.AccessTokenTTL / time.Second),
+	}, nil
+}
+
+// buildToken signs the claims living for ttl with unique jti, scoped tokens aren't access tokens.
+func (s *Service) buildToken(claims *Claims, ttl time.Duration) (string, error) {
+	jti, err := randomString(jtiLen)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        jti,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+	}
+
+	return s.Keys.Sign(*claims)
+}
+
+// NewCSRFToken generates random value for the double-submit CSRF protection of cookie sessions.
+func NewCSRFToken() (string, error) {
+	return randomString(csrfTokenLen)
+}
+
+// newRefreshToken generates random opaque token, only its hash is stored.
+func (s *Service) newRefreshToken() (string, *storage.RefreshToken, error) {
+	refresh, err := randomString(refreshTokenLen)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return refresh, &storage.RefreshToken{
+		Hash:      hashToken(refresh),
+		ExpiresAt: time.Now().Add(s.Config.Auth.RefreshTokenTTL),
+	}, nil
+}
+
+// hashToken is how opaque refresh and password reset tokens are stored, they are random enough
+// to not need a slow hash.
+func hashToken(opaque string) []byte {
+	sum := sha256.Sum256([]byte(opaque))
+	return sum[:]
+}
+
+// randomString returns n random bytes encoded with URL safe base64.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed read random bytes: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
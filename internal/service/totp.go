@@ -0,0 +1,140 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // RFC 6238 default, authenticator apps support nothing else reliably
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	totpPeriod = 30 * time.Second
+	totpDigits = 6
+	// totpSkew is how many time steps the clock of the authenticator may be off by.
+	totpSkew      = 1
+	totpSecretLen = 20
+
+	recoveryCodesCount = 10
+	recoveryCodeLen    = 10
+	recoveryGroupLen   = 4
+)
+
+// totpEncoding is how secrets are shown to users and put into otpauth URIs.
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func newTOTPSecret() ([]byte, error) {
+	secret := make([]byte, totpSecretLen)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed read random bytes: %w", err)
+	}
+
+	return secret, nil
+}
+
+// totpURI is the key URI understood by authenticator apps, usually shown as a QR code.
+func totpURI(issuer, login string, secret []byte) string {
+	params := url.Values{}
+	params.Set("secret", totpEncoding.EncodeToString(secret))
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(int(totpPeriod/time.Second)))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + login,
+		RawQuery: params.Encode(),
+	}
+
+	return u.String()
+}
+
+func totpStep(t time.Time) int64 {
+	return t.Unix() / int64(totpPeriod/time.Second)
+}
+
+// totpCode computes HOTP (RFC 4226) of the time step, which makes TOTP of RFC 6238.
+func totpCode(secret []byte, step int64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, bin%mod)
+}
+
+// matchTOTP finds the time step around now the code has been generated for.
+func matchTOTP(secret []byte, code string, now time.Time) (int64, bool) {
+	current := totpStep(now)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(secret, step, totpDigits)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// isTOTPCode tells TOTP codes from recovery codes, which are longer and contain letters.
+func isTOTPCode(code string) bool {
+	if len(code) != totpDigits {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newRecoveryCodes generates recovery codes formatted for reading, e.g. ABCD-EFGH-IJKL-MNOP,
+// together with their hashes to store.
+func newRecoveryCodes() ([]string, [][]byte, error) {
+	codes := make([]string, 0, recoveryCodesCount)
+	hashes := make([][]byte, 0, recoveryCodesCount)
+	for i := 0; i < recoveryCodesCount; i++ {
+		b := make([]byte, recoveryCodeLen)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, fmt.Errorf("failed read random bytes: %w", err)
+		}
+		raw := totpEncoding.EncodeToString(b)
+
+		groups := make([]string, 0, len(raw)/recoveryGroupLen)
+		for j := 0; j < len(raw); j += recoveryGroupLen {
+			groups = append(groups, raw[j:min(j+recoveryGroupLen, len(raw))])
+		}
+		codes = append(codes, strings.Join(groups, "-"))
+		hashes = append(hashes, hashToken(raw))
+	}
+
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode accepts the code typed in any case, with or without separators.
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(code))
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// test vectors of RFC 6238 appendix B for SHA1
+	secret := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "94287082"},
+		{unix: 1111111109, want: "07081804"},
+		{unix: 1111111111, want: "14050471"},
+		{unix: 1234567890, want: "89005924"},
+		{unix: 2000000000, want: "69279037"},
+		{unix: 20000000000, want: "65353130"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(secret, totpStep(time.Unix(tt.unix, 0)), 8); got != tt.want {
+			t.Errorf("totpCode() at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1111111111, 0)
+	current := totpStep(now)
+
+	for _, step := range []int64{current - 1, current, current + 1} {
+		got, ok := matchTOTP(secret, totpCode(secret, step, totpDigits), now)
+		if !ok || got != step {
+			t.Errorf("matchTOTP() of step %d = %d, %v", step, got, ok)
+		}
+	}
+	if _, ok := matchTOTP(secret, totpCode(secret, current+2, totpDigits), now); ok {
+		t.Error("matchTOTP() accepted the code beyond the skew")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	u, err := url.Parse(totpURI("Gophermart", "vasiliy", []byte("12345678901234567890")))
+	if err != nil {
+		t.Fatalf("url.Parse() error = %v", err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Gophermart:vasiliy" {
+		t.Errorf("totpURI() = %s", u)
+	}
+	if got := u.Query().Get("secret"); got != "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" {
+		t.Errorf("totpURI() secret = %s", got)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatalf("newRecoveryCodes() error = %v", err)
+	}
+	if len(codes) != recoveryCodesCount || len(hashes) != recoveryCodesCount {
+		t.Fatalf("newRecoveryCodes() made %d codes and %d hashes", len(codes), len(hashes))
+	}
+	for i, code := range codes {
+		if isTOTPCode(code) {
+			t.Errorf("recovery code %s looks like TOTP code", code)
+		}
+		// the code may be typed in lowercase and without separators
+		typed := " " + strings.ToLower(strings.ReplaceAll(code, "-", ""))
+		if !bytes.Equal(hashToken(normalizeRecoveryCode(typed)), hashes[i]) {
+			t.Errorf("normalized code %s doesn't match its hash", code)
+		}
+	}
+}
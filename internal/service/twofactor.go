@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/RIBorisov/gophermart/internal/models"
+	"github.com/RIBorisov/gophermart/internal/models/balance"
+	"github.com/RIBorisov/gophermart/internal/models/token"
+	"github.com/RIBorisov/gophermart/internal/models/twofactor"
+	"github.com/RIBorisov/gophermart/internal/storage"
+)
+
+// ScopeTwoFactor limits the token to completing the login with the second factor, protected endpoints
+// reject it.
+const ScopeTwoFactor = "2fa"
+
+// EnrollTwoFactor generates the TOTP secret of the user, the second factor is required only after
+// ConfirmTwoFactor gets the first code of it. Enrolling again before the confirmation replaces the secret.
+// The current password is required, wrong passwords are throttled together with failed logins.
+func (s *Service) EnrollTwoFactor(
+	ctx context.Context,
+	claims *Claims,
+	password string,
+) (twofactor.EnrollResponse, error) {
+	user, err := s.Storage.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		return twofactor.EnrollResponse{}, fmt.Errorf("failed get user: %w", err)
+	}
+	if err = s.reauthenticate(ctx, user, password); err != nil {
+		return twofactor.EnrollResponse{}, err
+	}
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return twofactor.EnrollResponse{}, err
+	}
+	if err = s.Storage.SaveTOTPSecret(ctx, user.ID, secret); err != nil {
+		return twofactor.EnrollResponse{}, fmt.Errorf("failed save totp secret: %w", err)
+	}
+
+	return twofactor.EnrollResponse{
+		Secret: totpEncoding.EncodeToString(secret),
+		URI:    totpURI(s.Config.Auth.TOTPIssuer, user.Login, secret),
+	}, nil
+}
+
+// ConfirmTwoFactor enables the second factor when the code matches the enrolled secret
+// and returns recovery codes, only their hashes are kept.
+func (s *Service) ConfirmTwoFactor(ctx context.Context, claims *Claims, code string) ([]string, error) {
+	tf, err := s.Storage.GetTwoFactor(ctx, claims.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed get two-factor state: %w", err)
+	}
+	if tf.Enabled {
+		return nil, storage.ErrTwoFactorEnabled
+	}
+	if tf.Secret == nil {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	step, ok := matchTOTP(tf.Secret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err = s.Storage.EnableTwoFactor(ctx, claims.UserID, step, hashes); err != nil {
+		return nil, fmt.Errorf("failed enable two-factor: %w", err)
+	}
+
+	return codes, nil
+}
+
+// DisableTwoFactor turns the second factor off, it takes a valid TOTP or recovery code.
+func (s *Service) DisableTwoFactor(ctx context.Context, claims *Claims, code string) error {
+	user, err := s.Storage.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		return fmt.Errorf("failed get user: %w", err)
+	}
+	if err = s.verifySecondFactor(ctx, user, code, ""); err != nil {
+		return err
+	}
+	if err = s.Storage.DisableTwoFactor(ctx, user.ID); err != nil {
+		return fmt.Errorf("failed disable two-factor: %w", err)
+	}
+
+	return nil
+}
+
+// reauthenticate checks the password of the user who is logged in already.
+func (s *Service) reauthenticate(ctx context.Context, user *storage.UserRow, password string) error {
+	if err := s.checkLoginAllowed(ctx, user.Login, ""); err != nil {
+		return err
+	}
+	if _, err := s.verifyPassword(user.Password, password); err != nil {
+		if errors.Is(err, ErrIncorrectPassword) {
+			s.loginFailed(ctx, user.Login, "")
+			return ErrIncorrectPassword
+		}
+		return fmt.Errorf("failed verify password: %w", err)
+	}
+
+	return nil
+}
+
+// twoFactorChallenge issues the token which only lets the user complete the login with CompleteLogin.
+func (s *Service) twoFactorChallenge(userID string) (token.Response, error) {
+	challenge, err := s.buildToken(&Claims{UserID: userID, Scope: ScopeTwoFactor}, s.Config.Auth.TwoFactorTokenTTL)
+	if err != nil {
+		return token.Response{}, err
+	}
+
+	return token.Response{TwoFactorToken: challenge}, nil
+}
+
+// CompleteLogin exchanges the token issued by LoginUser and the second factor code for a new session.
+// The token can't be used again, failed codes are throttled together with failed passwords of the login.
+func (s *Service) CompleteLogin(
+	ctx context.Context,
+	req *twofactor.LoginRequest,
+	clientIP string,
+) (token.Response, error) {
+	claims, err := s.ParseToken(req.TwoFactorToken)
+	if err != nil || claims.Scope != ScopeTwoFactor {
+		return token.Response{}, ErrInvalidTwoFactorToken
+	}
+	if err = s.CheckToken(ctx, claims); err != nil {
+		if errors.Is(err, ErrTokenRevoked) {
+			return token.Response{}, ErrInvalidTwoFactorToken
+		}
+		return token.Response{}, err
+	}
+
+	user, err := s.Storage.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		return token.Response{}, fmt.Errorf("failed get user: %w", err)
+	}
+	if user.BlockedAt != nil {
+		return token.Response{}, ErrUserBlocked
+	}
+	if err = s.verifySecondFactor(ctx, user, req.Code, clientIP); err != nil {
+		return token.Response{}, err
+	}
+	if err = s.Logout(ctx, claims); err != nil {
+		return token.Response{}, err
+	}
+
+	return s.IssueTokens(ctx, user.ID, user.Role)
+}
+
+// verifySecondFactor accepts the TOTP code of a time step not used yet or an unused recovery code.
+// Attempts are limited by LoginGuard the same way as passwords of the login.
+func (s *Service) verifySecondFactor(ctx context.Context, user *storage.UserRow, code, clientIP string) error {
+	if err := s.checkLoginAllowed(ctx, user.Login, clientIP); err != nil {
+		return err
+	}
+
+	tf, err := s.Storage.GetTwoFactor(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("failed get two-factor state: %w", err)
+	}
+	if !tf.Enabled {
+		return ErrTwoFactorDisabled
+	}
+
+	if err = s.useSecondFactor(ctx, user.ID, tf, strings.TrimSpace(code)); err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			s.loginFailed(ctx, user.Login, clientIP)
+		}
+		return err
+	}
+	s.loginSucceeded(ctx, user.Login)
+
+	return nil
+}
+
+func (s *Service) useSecondFactor(ctx context.Context, userID string, tf *storage.TwoFactor, code string) error {
+	if isTOTPCode(code) {
+		step, ok := matchTOTP(tf.Secret, code, time.Now())
+		if !ok || step <= tf.LastStep {
+			return ErrInvalidTwoFactorCode
+		}
+		if err := s.Storage.UseTOTPStep(ctx, userID, step); err != nil {
+			if errors.Is(err, storage.ErrTOTPStepUsed) {
+				return ErrInvalidTwoFactorCode
+			}
+			return fmt.Errorf("failed use totp step: %w", err)
+		}
+		return nil
+	}
+
+	if err := s.Storage.UseRecoveryCode(ctx, userID, hashToken(normalizeRecoveryCode(code))); err != nil {
+		if errors.Is(err, storage.ErrRecoveryCodeInvalid) {
+			return ErrInvalidTwoFactorCode
+		}
+		return fmt.Errorf("failed use recovery code: %w", err)
+	}
+	s.Log.Info("recovery code used", "user_id", userID)
+
+	return nil
+}
+
+// checkWithdrawal requires the second factor for withdrawals above WITHDRAW_2FA_THRESHOLD.
+// Non-positive sums are rejected, they would credit the balance bypassing the threshold.
+func (s *Service) checkWithdrawal(ctx context.Context, withdraw balance.WithdrawRequest, code string) error {
+	if withdraw.Sum <= 0 {
+		return ErrInvalidWithdrawSum
+	}
+	threshold := s.Config.Auth.WithdrawTwoFactorThreshold
+	if threshold <= 0 || withdraw.Sum <= threshold {
+		return nil
+	}
+	if code == "" {
+		return ErrTwoFactorRequired
+	}
+
+	userID, ok := ctx.Value(models.CtxUserIDKey).(string)
+	if !ok {
+		return errors.New("no user id in context")
+	}
+	user, err := s.Storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed get user: %w", err)
+	}
+	if err = s.verifySecondFactor(ctx, user, code, ""); err != nil {
+		if errors.Is(err, ErrTwoFactorDisabled) {
+			return ErrTwoFactorRequired
+		}
+		return err
+	}
+
+	return nil
+}
+
+var (
+	ErrTwoFactorNotEnrolled  = errors.New("two-factor authentication is not enrolled")
+	ErrTwoFactorDisabled     = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorRequired     = errors.New("second factor is required")
+	ErrInvalidTwoFactorCode  = errors.New("invalid second factor code")
+	ErrInvalidTwoFactorToken = errors.New("invalid or expired two-factor token")
+	ErrInvalidWithdrawSum    = errors.New("withdrawal sum must be positive")
+)
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/RIBorisov/gophermart/internal/config"
+	"github.com/RIBorisov/gophermart/internal/logger"
+	"github.com/RIBorisov/gophermart/internal/models"
+	"github.com/RIBorisov/gophermart/internal/models/balance"
+	"github.com/RIBorisov/gophermart/internal/models/money"
+	"github.com/RIBorisov/gophermart/internal/models/register"
+	"github.com/RIBorisov/gophermart/internal/models/twofactor"
+	"github.com/RIBorisov/gophermart/internal/storage"
+)
+
+func TestTwoFactorFlow(t *testing.T) {
+	ctx := context.Background()
+	log := &logger.Log{}
+	log.Initialize("ERROR")
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	cfg.Auth.WithdrawTwoFactorThreshold = money.FromFloat(100)
+	keys, err := NewEphemeralKeySet()
+	if err != nil {
+		t.Fatalf("NewEphemeralKeySet() error = %v", err)
+	}
+	svc := &Service{Config: cfg, Log: log, Storage: storage.NewMemory(), Keys: keys}
+
+	user := &register.Request{Login: "vasiliy", Password: "pwd"}
+	tokens, err := svc.RegisterUser(ctx, &register.Request{Login: user.Login, Password: user.Password})
+	if err != nil {
+		t.Fatalf("RegisterUser() error = %v", err)
+	}
+	claims, err := svc.ParseToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("ParseToken() error = %v", err)
+	}
+	userCtx := context.WithValue(ctx, models.CtxUserIDKey, claims.UserID)
+	bigWithdraw := balance.WithdrawRequest{Order: "2377225624", Sum: money.FromFloat(100.01)}
+
+	negative := balance.WithdrawRequest{Order: "2377225624", Sum: money.FromFloat(-100.01)}
+	if err = svc.checkWithdrawal(userCtx, negative, ""); !errors.Is(err, ErrInvalidWithdrawSum) {
+		t.Fatalf("negative withdrawal error = %v, want ErrInvalidWithdrawSum", err)
+	}
+	if err = svc.checkWithdrawal(userCtx, bigWithdraw, "123456"); !errors.Is(err, ErrTwoFactorRequired) {
+		t.Fatalf("withdrawal without 2FA enabled error = %v, want ErrTwoFactorRequired", err)
+	}
+
+	if _, err = svc.EnrollTwoFactor(ctx, claims, "wrong"); !errors.Is(err, ErrIncorrectPassword) {
+		t.Fatalf("EnrollTwoFactor() with wrong password error = %v, want ErrIncorrectPassword", err)
+	}
+	enrollment, err := svc.EnrollTwoFactor(ctx, claims, user.Password)
+	if err != nil {
+		t.Fatalf("EnrollTwoFactor() error = %v", err)
+	}
+	secret, err := totpEncoding.DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatalf("secret isn't base32: %v", err)
+	}
+	now := totpStep(time.Now())
+
+	if _, err = svc.ConfirmTwoFactor(ctx, claims, totpCode(secret, now+5, totpDigits)); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("ConfirmTwoFactor() of wrong code error = %v", err)
+	}
+	recoveryCodes, err := svc.ConfirmTwoFactor(ctx, claims, totpCode(secret, now, totpDigits))
+	if err != nil {
+		t.Fatalf("ConfirmTwoFactor() error = %v", err)
+	}
+	if _, err = svc.EnrollTwoFactor(ctx, claims, user.Password); !errors.Is(err, storage.ErrTwoFactorEnabled) {
+		t.Fatalf("EnrollTwoFactor() of enabled 2FA error = %v", err)
+	}
+
+	// the password alone gives the challenge token only, it isn't an access token
+	challenge, err := svc.LoginUser(ctx, user, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("LoginUser() error = %v", err)
+	}
+	if challenge.AccessToken != "" || challenge.TwoFactorToken == "" {
+		t.Fatalf("LoginUser() = %+v, want two-factor token only", challenge)
+	}
+	if _, err = svc.CompleteLogin(ctx, &twofactor.LoginRequest{
+		TwoFactorToken: tokens.AccessToken,
+		Code:           recoveryCodes[0],
+	}, ""); !errors.Is(err, ErrInvalidTwoFactorToken) {
+		t.Fatalf("CompleteLogin() with access token error = %v", err)
+	}
+
+	// the code confirming the enrollment can't be replayed
+	req := &twofactor.LoginRequest{TwoFactorToken: challenge.TwoFactorToken, Code: totpCode(secret, now, totpDigits)}
+	if _, err = svc.CompleteLogin(ctx, req, ""); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("CompleteLogin() with used code error = %v", err)
+	}
+	req.Code = totpCode(secret, now+1, totpDigits)
+	session, err := svc.CompleteLogin(ctx, req, "")
+	if err != nil || session.AccessToken == "" {
+		t.Fatalf("CompleteLogin() = %+v, %v", session, err)
+	}
+	req.Code = recoveryCodes[0]
+	if _, err = svc.CompleteLogin(ctx, req, ""); !errors.Is(err, ErrInvalidTwoFactorToken) {
+		t.Fatalf("CompleteLogin() with used token error = %v", err)
+	}
+
+	if err = svc.checkWithdrawal(userCtx, bigWithdraw, ""); !errors.Is(err, ErrTwoFactorRequired) {
+		t.Fatalf("withdrawal without code error = %v, want ErrTwoFactorRequired", err)
+	}
+	if err = svc.checkWithdrawal(userCtx, balance.WithdrawRequest{Sum: money.FromFloat(100)}, ""); err != nil {
+		t.Fatalf("withdrawal up to the threshold error = %v", err)
+	}
+	if err = svc.checkWithdrawal(userCtx, bigWithdraw, recoveryCodes[1]); err != nil {
+		t.Fatalf("withdrawal with recovery code error = %v", err)
+	}
+	if err = svc.checkWithdrawal(userCtx, bigWithdraw, recoveryCodes[1]); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("withdrawal with used recovery code error = %v", err)
+	}
+
+	if err = svc.DisableTwoFactor(ctx, claims, recoveryCodes[2]); err != nil {
+		t.Fatalf("DisableTwoFactor() error = %v", err)
+	}
+	tokens, err = svc.LoginUser(ctx, user, "10.0.0.1")
+	if err != nil || tokens.AccessToken == "" {
+		t.Fatalf("LoginUser() after disabling 2FA = %+v, %v", tokens, err)
+	}
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/RIBorisov/gophermart/internal/models/admin"
+	"github.com/RIBorisov/gophermart/internal/models/ledger"
+	"github.com/RIBorisov/gophermart/internal/models/money"
+)
+
+// AdjustBalance credits or debits the balance of adj.UserID, records the ledger transaction and the audit
+// record of it in one transaction. The balance can't go below zero, the reference is unique for the user.
+// ID, BalanceAfter and CreatedAt of adj are set on success.
+func (d *DB) AdjustBalance(ctx context.Context, adj *admin.Adjustment) error {
+	const (
+		selectStmt = `SELECT current FROM balance WHERE user_id = $1 FOR UPDATE`
+		updateStmt = `UPDATE balance SET current = current + $1, updated_at = NOW() WHERE user_id = $2`
+		insertStmt = `INSERT INTO balance_adjustments
+						  (user_id, operator_id, transaction_id, reason, reference, comment, amount, balance_after)
+					  VALUES (@userID, @operatorID, currval('ledger_transaction_seq'), @reason, @reference, @comment,
+							  @amount, @balanceAfter)
+					  RETURNING adjustment_id, created_at`
+		referenceShouldBeUniq = "idx_adjustment_reference_is_unique"
+	)
+
+	tx, err := d.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "read committed"})
+	if err != nil {
+		return fmt.Errorf("failed begin tx: %w", err)
+	}
+	defer func() {
+		if err = tx.Rollback(ctx); err != nil {
+			d.log.Warn("failed rollback transaction", "txError", err)
+		}
+	}()
+
+	var current money.Amount
+	if err = tx.QueryRow(ctx, selectStmt, adj.UserID).Scan(&current); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) || malformedID(err) {
+			return ErrUserNotExists
+		}
+		return fmt.Errorf("failed select balance: %w", err)
+	}
+	if current+adj.Amount < 0 {
+		return ErrInsufficientFunds
+	}
+
+	if _, err = tx.Exec(ctx, updateStmt, adj.Amount, adj.UserID); err != nil {
+		return fmt.Errorf("failed execute update balance stmt: %w", err)
+	}
+
+	posting := &ledger.Posting{Kind: ledger.Adjustment, UserID: adj.UserID, Amount: adj.Amount}
+	if err = insertPosting(ctx, tx, posting); err != nil {
+		return err
+	}
+
+	balanceAfter := current + adj.Amount
+	err = tx.QueryRow(ctx, insertStmt, pgx.NamedArgs{
+		"userID":       adj.UserID,
+		"operatorID":   adj.OperatorID,
+		"reason":       adj.Reason,
+		"reference":    adj.Reference,
+		"comment":      adj.Comment,
+		"amount":       adj.Amount,
+		"balanceAfter": balanceAfter,
+	}).Scan(&adj.ID, &adj.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation &&
+			pgErr.ConstraintName == referenceShouldBeUniq {
+			return ErrAdjustmentExists
+		}
+		return fmt.Errorf("failed insert balance adjustment: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed commit tx: %w", err)
+	}
+	adj.BalanceAfter = balanceAfter
+
+	return nil
+}
+
+// GetAdjustments returns balance adjustments of the user, the latest first.
+func (d *DB) GetAdjustments(ctx context.Context, userID string) ([]admin.Adjustment, error) {
+	const stmt = `SELECT adjustment_id, user_id, operator_id, reason, reference, comment, amount, balance_after,
+					  created_at
+				  FROM balance_adjustments WHERE user_id = $1 ORDER BY adjustment_id DESC`
+
+	rows, err := d.pool.Query(ctx, stmt, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed query balance adjustments: %w", err)
+	}
+	defer rows.Close()
+
+	aList := make([]admin.Adjustment, 0)
+	for rows.Next() {
+		var a admin.Adjustment
+		err = rows.Scan(&a.ID, &a.UserID, &a.OperatorID, &a.Reason, &a.Reference, &a.Comment, &a.Amount,
+			&a.BalanceAfter, &a.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed scan balance adjustment row: %w", err)
+		}
+		aList = append(aList, a)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed read balance adjustments: %w", err)
+	}
+
+	return aList, nil
+}
+
+var ErrAdjustmentExists = errors.New("adjustment with this reference already exists for the user")
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// LoginFailures are failed attempts of the login or the client address.
+type LoginFailures struct {
+	LastFailure time.Time
+	LockedUntil time.Time
+	Failures    int
+}
+
+// LoginFailureLimit is how failures are counted: failures older than Window are forgotten
+// and MaxFailures of them lock the key for Lockout, keys aren't locked when MaxFailures is not positive.
+type LoginFailureLimit struct {
+	Window      time.Duration
+	Lockout     time.Duration
+	MaxFailures int
+}
+
+// GetLoginFailures returns failures by key, keys without failures are missing.
+func (d *DB) GetLoginFailures(ctx context.Context, keys []string) (map[string]LoginFailures, error) {
+	const selectStmt = `SELECT key, failures, last_failure, COALESCE(locked_until, 'epoch'::timestamptz)
+						FROM login_failures WHERE key = ANY($1)`
+
+	rows, err := d.pool.Query(ctx, selectStmt, keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed select login failures: %w", err)
+	}
+	defer rows.Close()
+
+	failures := make(map[string]LoginFailures, len(keys))
+	for rows.Next() {
+		var (
+			key string
+			f   LoginFailures
+		)
+		if err = rows.Scan(&key, &f.Failures, &f.LastFailure, &f.LockedUntil); err != nil {
+			return nil, fmt.Errorf("failed scan login failures: %w", err)
+		}
+		failures[key] = f
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed read login failures: %w", err)
+	}
+
+	return failures, nil
+}
+
+// AddLoginFailure counts the failure of the key made at now and reports whether the key got locked by it.
+// The row is locked by the upsert, so failures counted by several instances at once aren't lost.
+func (d *DB) AddLoginFailure(ctx context.Context, key string, now time.Time, limit LoginFailureLimit) (bool, error) {
+	const (
+		upsertStmt = `INSERT INTO login_failures AS f (key, failures, last_failure) VALUES (@key, 1, @now)
+					  ON CONFLICT (key) DO UPDATE
+					  SET failures = CASE WHEN f.last_failure < @windowStart THEN 1 ELSE f.failures + 1 END,
+						  last_failure = @now
+					  RETURNING failures`
+		lockStmt = `UPDATE login_failures SET failures = 0, locked_until = $2 WHERE key = $1`
+	)
+
+	tx, err := d.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "read committed"})
+	if err != nil {
+		return false, fmt.Errorf("failed begin tx: %w", err)
+	}
+
+	defer func() {
+		if err = tx.Rollback(ctx); err != nil {
+			d.log.Warn("failed rollback transaction", "txError", err)
+		}
+	}()
+
+	var failures int
+	err = tx.QueryRow(ctx, upsertStmt, pgx.NamedArgs{
+		"key":         key,
+		"now":         now,
+		"windowStart": now.Add(-limit.Window),
+	}).Scan(&failures)
+	if err != nil {
+		return false, fmt.Errorf("failed count login failure: %w", err)
+	}
+	locked := limit.MaxFailures > 0 && failures >= limit.MaxFailures
+	if locked {
+		if _, err = tx.Exec(ctx, lockStmt, key, now.Add(limit.Lockout)); err != nil {
+			return false, fmt.Errorf("failed lock login: %w", err)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed commit tx: %w", err)
+	}
+
+	return locked, nil
+}
+
+// DeleteLoginFailures forgets failures and lockout of the key and reports whether there were any.
+func (d *DB) DeleteLoginFailures(ctx context.Context, key string) (bool, error) {
+	const deleteStmt = `DELETE FROM login_failures WHERE key = $1`
+
+	tag, err := d.pool.Exec(ctx, deleteStmt, key)
+	if err != nil {
+		return false, fmt.Errorf("failed delete login failures: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// PruneLoginFailures deletes keys which have neither lockout nor failures after before.
+func (d *DB) PruneLoginFailures(ctx context.Context, now, before time.Time) error {
+	const deleteStmt = `DELETE FROM login_failures
+						WHERE last_failure < $2 AND (locked_until IS NULL OR locked_until < $1)`
+
+	if _, err := d.pool.Exec(ctx, deleteStmt, now, before); err != nil {
+		return fmt.Errorf("failed prune login failures: %w", err)
+	}
+
+	return nil
+}
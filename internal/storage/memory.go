@@ -0,0 +1,910 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RIBorisov/gophermart/internal/models/admin"
+	"github.com/RIBorisov/gophermart/internal/models/balance"
+	"github.com/RIBorisov/gophermart/internal/models/ledger"
+	"github.com/RIBorisov/gophermart/internal/models/money"
+	"github.com/RIBorisov/gophermart/internal/models/orders"
+	"github.com/RIBorisov/gophermart/internal/models/register"
+)
+
+// Memory is an in-memory storage used when DATABASE_URI is not provided.
+// Every method holds the single mutex for its whole duration, so each call is
+// atomic in the same way as a transaction in DB.
+type Memory struct {
+	users       map[string]*UserRow
+	orders      map[string]*memoryOrder
+	balances    map[string]*BalanceEntity
+	withdrawals []WithdrawalsEntity
+	ledger      []memoryLedgerEntry
+	// refreshTokens are keyed by token hash
+	refreshTokens map[string]*memoryRefreshToken
+	// revokedTokens are expiration times of revoked access tokens by jti
+	revokedTokens map[string]time.Time
+	// tokensValidAfter are cutoffs of the users by user id
+	tokensValidAfter map[string]time.Time
+	// passwordResets are keyed by token hash
+	passwordResets map[string]*memoryPasswordReset
+	// twoFactors are keyed by user id
+	twoFactors map[string]*memoryTwoFactor
+	// loginFailures are keyed by login or client address key of LoginGuard
+	loginFailures map[string]*LoginFailures
+	adjustments   []admin.Adjustment
+	mu            sync.Mutex
+}
+
+type memoryTwoFactor struct {
+	TwoFactor
+	// recoveryCodes tell by code hash whether the code has been used
+	recoveryCodes map[string]bool
+}
+
+type memoryPasswordReset struct {
+	PasswordReset
+	used bool
+}
+
+type memoryRefreshToken struct {
+	RefreshToken
+	used    bool
+	revoked bool
+}
+
+type memoryOrder struct {
+	OrderEntity
+	lockedUntil time.Time
+	nextCheckAt time.Time
+	lockedBy    string
+	lastError   string
+	attempts    int
+	failures    int
+	stuck       bool
+	deadLetter  bool
+}
+
+type memoryLedgerEntry struct {
+	LedgerEntity
+	account       string
+	userID        string
+	transactionID int64
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		users:    make(map[string]*UserRow),
+		orders:   make(map[string]*memoryOrder),
+		balances: make(map[string]*BalanceEntity),
+
+		refreshTokens:    make(map[string]*memoryRefreshToken),
+		revokedTokens:    make(map[string]time.Time),
+		tokensValidAfter: make(map[string]time.Time),
+		passwordResets:   make(map[string]*memoryPasswordReset),
+		twoFactors:       make(map[string]*memoryTwoFactor),
+		loginFailures:    make(map[string]*LoginFailures),
+	}
+}
+
+// newUUID generates random (version 4) UUID the same way as gen_random_uuid() does.
+func newUUID() (string, error) {
+	const (
+		uuidLen        = 16
+		versionByte    = 6
+		variantByte    = 8
+		versionMask    = 0x0f
+		version4       = 0x40
+		variantMask    = 0x3f
+		variantRFC4122 = 0x80
+	)
+	b := make([]byte, uuidLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed read random bytes: %w", err)
+	}
+	b[versionByte] = b[versionByte]&versionMask | version4
+	b[variantByte] = b[variantByte]&variantMask | variantRFC4122
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+func (m *Memory) ClosePool() error {
+	return nil
+}
+
+func (m *Memory) SaveUser(_ context.Context, user *register.Request) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[user.Login]; ok {
+		return "", ErrUserExists
+	}
+
+	userID, err := newUUID()
+	if err != nil {
+		return "", fmt.Errorf("failed generate user id: %w", err)
+	}
+
+	m.users[user.Login] = &UserRow{ID: userID, Login: user.Login, Password: user.Password, Role: admin.RoleUser}
+	m.balances[userID] = &BalanceEntity{UserID: userID, UpdatedAt: time.Now()}
+
+	return userID, nil
+}
+
+func (m *Memory) GetUser(_ context.Context, login string) (*UserRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[login]
+	if !ok {
+		return nil, ErrUserNotExists
+	}
+	uRow := *u
+
+	return &uRow, nil
+}
+
+// SaveOrder checks if order already registered and returns corresponding error
+// otherwise saving the new order.
+func (m *Memory) SaveOrder(ctx context.Context, orderNo string) error {
+	userID, err := getCtxUserID(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existed, ok := m.orders[orderNo]; ok {
+		if existed.UserID == userID {
+			return ErrOrderCreatedAlready
+		}
+		return ErrAnotherUserOrderCreated
+	}
+
+	now := time.Now()
+	m.orders[orderNo] = &memoryOrder{
+		OrderEntity: OrderEntity{
+			OrderID:    orderNo,
+			UserID:     userID,
+			Status:     orders.New,
+			UploadedAt: now,
+		},
+		nextCheckAt: now,
+	}
+
+	return nil
+}
+
+func (m *Memory) GetUserOrders(ctx context.Context) ([]OrderEntity, error) {
+	userID, err := getCtxUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var oList []OrderEntity
+	for _, o := range m.orders {
+		if o.UserID == userID {
+			oList = append(oList, o.OrderEntity)
+		}
+	}
+
+	return oList, nil
+}
+
+func (m *Memory) GetBalance(ctx context.Context) (*BalanceEntity, error) {
+	userID, err := getCtxUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.balances[userID]
+	if !ok {
+		return nil, ErrUserNotExists
+	}
+	bRow := *b
+
+	return &bRow, nil
+}
+
+func (m *Memory) BalanceWithdraw(ctx context.Context, req balance.WithdrawRequest) error {
+	userID, err := getCtxUserID(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.balances[userID]
+	if !ok {
+		return ErrUserNotExists
+	}
+
+	for _, w := range m.withdrawals {
+		if w.OrderID == req.Order {
+			return ErrWithdrawalExists
+		}
+	}
+
+	if b.Current < req.Sum {
+		return ErrInsufficientFunds
+	}
+
+	now := time.Now()
+	b.Current -= req.Sum
+	b.Withdrawn += req.Sum
+	b.UpdatedAt = now
+
+	m.withdrawals = append(m.withdrawals, WithdrawalsEntity{
+		UserID:      userID,
+		OrderID:     req.Order,
+		Amount:      req.Sum,
+		ProcessedAt: now,
+	})
+	m.insertPosting(&ledger.Posting{Kind: ledger.Withdrawal, UserID: userID, OrderID: req.Order, Amount: -req.Sum})
+
+	return nil
+}
+
+func (m *Memory) GetWithdrawals(ctx context.Context) ([]WithdrawalsEntity, error) {
+	userID, err := getCtxUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var wList []WithdrawalsEntity
+	for _, w := range m.withdrawals {
+		if w.UserID == userID {
+			wList = append(wList, w)
+		}
+	}
+
+	return wList, nil
+}
+
+// GetOrdersList claims up to lease.BatchSize unprocessed orders which are due for the next check
+// and not leased by anyone.
+func (m *Memory) GetOrdersList(_ context.Context, lease *orders.Lease) ([]orders.Pending, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	claimable := make([]*memoryOrder, 0)
+	for _, o := range m.orders {
+		unprocessed := o.Status == orders.New || o.Status == orders.Processing
+		if unprocessed && !o.deadLetter && !o.nextCheckAt.After(now) && !o.lockedUntil.After(now) {
+			claimable = append(claimable, o)
+		}
+	}
+	sort.Slice(claimable, func(i, j int) bool {
+		return claimable[i].nextCheckAt.Before(claimable[j].nextCheckAt)
+	})
+	if len(claimable) > lease.BatchSize {
+		claimable = claimable[:lease.BatchSize]
+	}
+
+	oList := make([]orders.Pending, 0, len(claimable))
+	for _, o := range claimable {
+		o.lockedUntil = now.Add(lease.Duration)
+		o.lockedBy = lease.Owner
+		oList = append(oList, orders.Pending{
+			Number:     o.OrderID,
+			Status:     o.Status,
+			Attempts:   o.attempts,
+			Failures:   o.failures,
+			UploadedAt: o.UploadedAt,
+		})
+	}
+
+	return oList, nil
+}
+
+// UpdateOrder moves order into the new status and credits accrual once the order becomes PROCESSED,
+// see DB.UpdateOrder.
+func (m *Memory) UpdateOrder(_ context.Context, data *orders.UpdateOrder) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o, ok := m.orders[data.Number]
+	if !ok {
+		return ErrOrderNotExists
+	}
+	if data.Owner != "" && o.lockedBy != data.Owner {
+		return ErrLeaseLost
+	}
+
+	b, ok := m.balances[o.UserID]
+	if !ok {
+		return ErrUserNotExists
+	}
+
+	credit, err := checkTransition(o.Status, data)
+	if err != nil {
+		return err
+	}
+
+	o.Status = data.Status
+	o.Bonus = credit
+	o.lockedUntil = time.Time{}
+	o.lockedBy = ""
+	o.attempts++
+	o.failures = 0
+	o.lastError = ""
+	if !data.NextCheckAt.IsZero() {
+		o.nextCheckAt = data.NextCheckAt
+	}
+	o.stuck = o.stuck || data.Stuck
+	if credit != 0 {
+		b.Current += credit
+		b.UpdatedAt = time.Now()
+		m.insertPosting(&ledger.Posting{Kind: ledger.Accrual, UserID: o.UserID, OrderID: o.OrderID, Amount: credit})
+	}
+
+	return nil
+}
+
+// FailOrder records failed processing of the order and releases its lease, see DB.FailOrder.
+func (m *Memory) FailOrder(_ context.Context, data *orders.Failure) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o, ok := m.orders[data.Number]
+	if !ok {
+		return ErrOrderNotExists
+	}
+	if data.Owner != "" && o.lockedBy != data.Owner {
+		return ErrLeaseLost
+	}
+
+	o.failures++
+	o.lastError = data.Error
+	o.deadLetter = data.DeadLetter
+	o.nextCheckAt = data.NextCheckAt
+	o.lockedUntil = time.Time{}
+	o.lockedBy = ""
+
+	return nil
+}
+
+// insertPosting records posting as a ledger transaction, the caller must hold the mutex.
+func (m *Memory) insertPosting(p *ledger.Posting) {
+	var (
+		now           = time.Now()
+		transactionID int64
+		entryID       = int64(len(m.ledger))
+	)
+	if len(m.ledger) > 0 {
+		transactionID = m.ledger[len(m.ledger)-1].transactionID
+	}
+	transactionID++
+
+	m.ledger = append(m.ledger,
+		memoryLedgerEntry{
+			LedgerEntity: LedgerEntity{
+				ID: entryID + 1, Kind: p.Kind, OrderID: p.OrderID, Amount: p.Amount, CreatedAt: now,
+			},
+			account:       ledger.UserAccount,
+			userID:        p.UserID,
+			transactionID: transactionID,
+		},
+		memoryLedgerEntry{
+			LedgerEntity: LedgerEntity{
+				ID: entryID + 2, Kind: p.Kind, OrderID: p.OrderID, Amount: -p.Amount, CreatedAt: now,
+			},
+			account:       p.Kind.CounterAccount(),
+			transactionID: transactionID,
+		},
+	)
+}
+
+// GetLedger returns entries of the user account.
+func (m *Memory) GetLedger(ctx context.Context) ([]LedgerEntity, error) {
+	userID, err := getCtxUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var eList []LedgerEntity
+	for _, e := range m.ledger {
+		if e.account == ledger.UserAccount && e.userID == userID {
+			eList = append(eList, e.LedgerEntity)
+		}
+	}
+
+	return eList, nil
+}
+
+// ReconcileLedger returns every user whose balance doesn't reconcile with the ledger.
+func (m *Memory) ReconcileLedger(_ context.Context) ([]LedgerMismatch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	totals := make(map[string]money.Amount)
+	for _, e := range m.ledger {
+		if e.account == ledger.UserAccount {
+			totals[e.userID] += e.Amount
+		}
+	}
+	var mList []LedgerMismatch
+	for userID, b := range m.balances {
+		if b.Current != totals[userID] {
+			mList = append(mList, LedgerMismatch{UserID: userID, Balance: b.Current, Ledger: totals[userID]})
+		}
+	}
+
+	return mList, nil
+}
+
+func (m *Memory) SaveRefreshToken(_ context.Context, token *RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	familyID, err := newUUID()
+	if err != nil {
+		return fmt.Errorf("failed generate token family id: %w", err)
+	}
+	token.FamilyID = familyID
+	m.refreshTokens[string(token.Hash)] = &memoryRefreshToken{RefreshToken: *token}
+
+	return nil
+}
+
+func (m *Memory) RotateRefreshToken(_ context.Context, used []byte, next *RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.refreshTokens[string(used)]
+	switch {
+	case !ok, t.revoked:
+		return ErrRefreshTokenInvalid
+	case t.used:
+		for _, f := range m.refreshTokens {
+			if f.FamilyID == t.FamilyID {
+				f.revoked = true
+			}
+		}
+		return ErrRefreshTokenReused
+	case time.Now().After(t.ExpiresAt):
+		return ErrRefreshTokenInvalid
+	}
+
+	t.used = true
+	next.UserID = t.UserID
+	next.FamilyID = t.FamilyID
+	m.refreshTokens[string(next.Hash)] = &memoryRefreshToken{RefreshToken: *next}
+
+	return nil
+}
+
+func (m *Memory) GetTokenState(_ context.Context, jti, userID, sessionID string) (*TokenState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, revoked := m.revokedTokens[jti]
+	for _, t := range m.refreshTokens {
+		if t.FamilyID == sessionID && t.revoked {
+			revoked = true
+			break
+		}
+	}
+
+	return &TokenState{Revoked: revoked, ValidAfter: m.tokensValidAfter[userID]}, nil
+}
+
+func (m *Memory) RevokeSession(_ context.Context, jti string, expiresAt time.Time, familyID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for revoked, exp := range m.revokedTokens {
+		if exp.Before(now) {
+			delete(m.revokedTokens, revoked)
+		}
+	}
+	m.revokedTokens[jti] = expiresAt
+
+	if familyID != "" {
+		for _, t := range m.refreshTokens {
+			if t.FamilyID == familyID {
+				t.revoked = true
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *Memory) RevokeUserSessions(_ context.Context, userID string, cutoff time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.balances[userID]; !ok {
+		return ErrUserNotExists
+	}
+	m.revokeUserSessions(userID, cutoff)
+
+	return nil
+}
+
+// revokeUserSessions sets the cutoff and revokes the user refresh tokens, the caller must hold the mutex.
+func (m *Memory) revokeUserSessions(userID string, cutoff time.Time) {
+	m.tokensValidAfter[userID] = cutoff
+	for _, t := range m.refreshTokens {
+		if t.UserID == userID {
+			t.revoked = true
+		}
+	}
+}
+
+func (m *Memory) GetUserByID(_ context.Context, userID string) (*UserRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.userByID(userID)
+	if u == nil {
+		return nil, ErrUserNotExists
+	}
+	uRow := *u
+
+	return &uRow, nil
+}
+
+func (m *Memory) UpdatePassword(_ context.Context, userID, password string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.userByID(userID)
+	if u == nil {
+		return ErrUserNotExists
+	}
+	u.Password = password
+
+	return nil
+}
+
+func (m *Memory) ChangePassword(_ context.Context, userID, password string, cutoff time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.userByID(userID)
+	if u == nil {
+		return ErrUserNotExists
+	}
+	u.Password = password
+	m.revokeUserSessions(userID, cutoff)
+
+	return nil
+}
+
+func (m *Memory) SavePasswordReset(_ context.Context, reset *PasswordReset) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for hash, r := range m.passwordResets {
+		if now.After(r.ExpiresAt) {
+			delete(m.passwordResets, hash)
+		}
+	}
+	m.passwordResets[string(reset.Hash)] = &memoryPasswordReset{PasswordReset: *reset}
+
+	return nil
+}
+
+func (m *Memory) ResetPassword(_ context.Context, hash []byte, password string, cutoff time.Time) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.passwordResets[string(hash)]
+	if !ok || r.used || time.Now().After(r.ExpiresAt) {
+		return "", ErrResetTokenInvalid
+	}
+	u := m.userByID(r.UserID)
+	if u == nil {
+		return "", ErrUserNotExists
+	}
+	for _, other := range m.passwordResets {
+		if other.UserID == r.UserID {
+			other.used = true
+		}
+	}
+	u.Password = password
+	m.revokeUserSessions(r.UserID, cutoff)
+
+	return r.UserID, nil
+}
+
+func (m *Memory) GetTwoFactor(_ context.Context, userID string) (*TwoFactor, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.userByID(userID) == nil {
+		return nil, ErrUserNotExists
+	}
+	var tf TwoFactor
+	if state, ok := m.twoFactors[userID]; ok {
+		tf = state.TwoFactor
+	}
+
+	return &tf, nil
+}
+
+func (m *Memory) SaveTOTPSecret(_ context.Context, userID string, secret []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.userByID(userID) == nil {
+		return ErrUserNotExists
+	}
+	if state, ok := m.twoFactors[userID]; ok && state.Enabled {
+		return ErrTwoFactorEnabled
+	}
+	m.twoFactors[userID] = &memoryTwoFactor{TwoFactor: TwoFactor{Secret: secret}}
+
+	return nil
+}
+
+func (m *Memory) EnableTwoFactor(_ context.Context, userID string, step int64, recoveryCodes [][]byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, ok := m.twoFactors[userID]
+	if !ok || state.Enabled || state.Secret == nil {
+		return ErrTwoFactorEnabled
+	}
+	state.Enabled = true
+	state.LastStep = step
+	state.recoveryCodes = make(map[string]bool, len(recoveryCodes))
+	for _, code := range recoveryCodes {
+		state.recoveryCodes[string(code)] = false
+	}
+
+	return nil
+}
+
+func (m *Memory) UseTOTPStep(_ context.Context, userID string, step int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, ok := m.twoFactors[userID]
+	if !ok || !state.Enabled || state.LastStep >= step {
+		return ErrTOTPStepUsed
+	}
+	state.LastStep = step
+
+	return nil
+}
+
+func (m *Memory) UseRecoveryCode(_ context.Context, userID string, hash []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, ok := m.twoFactors[userID]
+	if !ok {
+		return ErrRecoveryCodeInvalid
+	}
+	used, ok := state.recoveryCodes[string(hash)]
+	if !ok || used {
+		return ErrRecoveryCodeInvalid
+	}
+	state.recoveryCodes[string(hash)] = true
+
+	return nil
+}
+
+func (m *Memory) DisableTwoFactor(_ context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.userByID(userID) == nil {
+		return ErrUserNotExists
+	}
+	delete(m.twoFactors, userID)
+
+	return nil
+}
+
+func (m *Memory) SearchUsers(_ context.Context, loginPrefix string, limit int) ([]UserRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var users []UserRow
+	for login, u := range m.users {
+		if strings.HasPrefix(login, loginPrefix) {
+			uRow := *u
+			uRow.Password = ""
+			users = append(users, uRow)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Login < users[j].Login
+	})
+	if len(users) > limit {
+		users = users[:limit]
+	}
+
+	return users, nil
+}
+
+func (m *Memory) CountPasswordHashesWithoutPrefix(_ context.Context, prefixes []string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count int
+	for _, u := range m.users {
+		if !slices.ContainsFunc(prefixes, func(prefix string) bool {
+			return strings.HasPrefix(u.Password, prefix)
+		}) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (m *Memory) SetUserRole(_ context.Context, userID string, role admin.Role) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.userByID(userID)
+	if u == nil {
+		return ErrUserNotExists
+	}
+	u.Role = role
+
+	return nil
+}
+
+func (m *Memory) SetUserBlocked(_ context.Context, userID string, blocked bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.userByID(userID)
+	if u == nil {
+		return ErrUserNotExists
+	}
+	switch {
+	case !blocked:
+		u.BlockedAt = nil
+	case u.BlockedAt == nil:
+		now := time.Now()
+		u.BlockedAt = &now
+	}
+
+	return nil
+}
+
+func (m *Memory) AdjustBalance(_ context.Context, adj *admin.Adjustment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.balances[adj.UserID]
+	if !ok {
+		return ErrUserNotExists
+	}
+	if b.Current+adj.Amount < 0 {
+		return ErrInsufficientFunds
+	}
+	for i := range m.adjustments {
+		if m.adjustments[i].UserID == adj.UserID && m.adjustments[i].Reference == adj.Reference {
+			return ErrAdjustmentExists
+		}
+	}
+
+	now := time.Now()
+	b.Current += adj.Amount
+	b.UpdatedAt = now
+	m.insertPosting(&ledger.Posting{Kind: ledger.Adjustment, UserID: adj.UserID, Amount: adj.Amount})
+
+	adj.ID = int64(len(m.adjustments) + 1)
+	adj.BalanceAfter = b.Current
+	adj.CreatedAt = now
+	m.adjustments = append(m.adjustments, *adj)
+
+	return nil
+}
+
+func (m *Memory) GetAdjustments(_ context.Context, userID string) ([]admin.Adjustment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	aList := make([]admin.Adjustment, 0)
+	for i := len(m.adjustments) - 1; i >= 0; i-- {
+		if m.adjustments[i].UserID == userID {
+			aList = append(aList, m.adjustments[i])
+		}
+	}
+
+	return aList, nil
+}
+
+// userByID looks the user up by id, users are keyed by login. Must be called with the lock held.
+func (m *Memory) userByID(userID string) *UserRow {
+	for _, u := range m.users {
+		if u.ID == userID {
+			return u
+		}
+	}
+
+	return nil
+}
+
+func (m *Memory) GetLoginFailures(_ context.Context, keys []string) (map[string]LoginFailures, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	failures := make(map[string]LoginFailures, len(keys))
+	for _, key := range keys {
+		if f, ok := m.loginFailures[key]; ok {
+			failures[key] = *f
+		}
+	}
+
+	return failures, nil
+}
+
+func (m *Memory) AddLoginFailure(_ context.Context, key string, now time.Time, limit LoginFailureLimit) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.loginFailures[key]
+	if !ok {
+		f = &LoginFailures{}
+		m.loginFailures[key] = f
+	}
+	if f.LastFailure.Before(now.Add(-limit.Window)) {
+		f.Failures = 0
+	}
+	f.Failures++
+	f.LastFailure = now
+	if limit.MaxFailures <= 0 || f.Failures < limit.MaxFailures {
+		return false, nil
+	}
+	f.Failures = 0
+	f.LockedUntil = now.Add(limit.Lockout)
+
+	return true, nil
+}
+
+func (m *Memory) DeleteLoginFailures(_ context.Context, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.loginFailures[key]
+	delete(m.loginFailures, key)
+
+	return ok, nil
+}
+
+func (m *Memory) PruneLoginFailures(_ context.Context, now, before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, f := range m.loginFailures {
+		if f.LastFailure.Before(before) && f.LockedUntil.Before(now) {
+			delete(m.loginFailures, key)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,436 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RIBorisov/gophermart/internal/models"
+	"github.com/RIBorisov/gophermart/internal/models/admin"
+	"github.com/RIBorisov/gophermart/internal/models/balance"
+	"github.com/RIBorisov/gophermart/internal/models/ledger"
+	"github.com/RIBorisov/gophermart/internal/models/money"
+	"github.com/RIBorisov/gophermart/internal/models/orders"
+	"github.com/RIBorisov/gophermart/internal/models/register"
+)
+
+var testLease = &orders.Lease{Owner: "test", Duration: time.Minute, BatchSize: 10}
+
+func memoryWithUser(t *testing.T, login string) (*Memory, context.Context) {
+	t.Helper()
+
+	m := NewMemory()
+	userID, err := m.SaveUser(context.Background(), &register.Request{Login: login, Password: "pwd"})
+	require.NoError(t, err)
+
+	return m, context.WithValue(context.Background(), models.CtxUserIDKey, userID)
+}
+
+func TestMemorySaveUser(t *testing.T) {
+	m, ctx := memoryWithUser(t, "Vasiliy")
+
+	_, err := m.SaveUser(ctx, &register.Request{Login: "Vasiliy", Password: "another"})
+	assert.ErrorIs(t, err, ErrUserExists)
+
+	_, err = m.GetUser(ctx, "Petr")
+	assert.ErrorIs(t, err, ErrUserNotExists)
+
+	u, err := m.GetUser(ctx, "Vasiliy")
+	require.NoError(t, err)
+	assert.Equal(t, "pwd", u.Password)
+
+	b, err := m.GetBalance(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, money.Amount(0), b.Current)
+}
+
+func TestMemorySaveOrder(t *testing.T) {
+	m, ctx := memoryWithUser(t, "Vasiliy")
+	anotherID, err := m.SaveUser(context.Background(), &register.Request{Login: "Petr", Password: "pwd"})
+	require.NoError(t, err)
+	anotherCtx := context.WithValue(context.Background(), models.CtxUserIDKey, anotherID)
+
+	assert.NoError(t, m.SaveOrder(ctx, "7177570715"))
+	assert.ErrorIs(t, m.SaveOrder(ctx, "7177570715"), ErrOrderCreatedAlready)
+	assert.ErrorIs(t, m.SaveOrder(anotherCtx, "7177570715"), ErrAnotherUserOrderCreated)
+	assert.ErrorIs(t, m.SaveOrder(context.Background(), "3682151158"), ErrGetUserFromContext)
+
+	list, err := m.GetOrdersList(ctx, testLease)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "7177570715", list[0].Number)
+
+	anotherOrders, err := m.GetUserOrders(anotherCtx)
+	require.NoError(t, err)
+	assert.Empty(t, anotherOrders)
+}
+
+func TestMemoryGetOrdersListLease(t *testing.T) {
+	m, ctx := memoryWithUser(t, "Vasiliy")
+	for _, o := range []string{"7177570715", "3682151158", "5116141762"} {
+		require.NoError(t, m.SaveOrder(ctx, o))
+	}
+
+	first, err := m.GetOrdersList(ctx, &orders.Lease{Owner: "first", Duration: time.Minute, BatchSize: 2})
+	require.NoError(t, err)
+	assert.Len(t, first, 2)
+
+	second, err := m.GetOrdersList(ctx, &orders.Lease{Owner: "second", Duration: time.Minute, BatchSize: 2})
+	require.NoError(t, err)
+	assert.Len(t, second, 1)
+	assert.NotContains(t, first, second[0])
+
+	none, err := m.GetOrdersList(ctx, testLease)
+	require.NoError(t, err)
+	assert.Empty(t, none)
+
+	m.orders[first[0].Number].lockedUntil = time.Now().Add(-time.Second)
+	expired, err := m.GetOrdersList(ctx, testLease)
+	require.NoError(t, err)
+	assert.Equal(t, first[:1], expired)
+
+	// the expired lease has passed to testLease, so the first owner can't update the order anymore
+	lost := first[0].Number
+	assert.ErrorIs(t, m.UpdateOrder(ctx, &orders.UpdateOrder{Number: lost, Status: orders.Processing, Owner: "first"}),
+		ErrLeaseLost)
+	assert.ErrorIs(t, m.FailOrder(ctx, &orders.Failure{Number: lost, Error: "timeout", Owner: "first"}), ErrLeaseLost)
+	assert.Equal(t, testLease.Owner, m.orders[lost].lockedBy)
+	require.NoError(t, m.UpdateOrder(ctx, &orders.UpdateOrder{
+		Number: lost, Status: orders.Processing, Owner: testLease.Owner,
+	}))
+}
+
+func TestMemoryGetOrdersListSchedule(t *testing.T) {
+	m, ctx := memoryWithUser(t, "Vasiliy")
+	require.NoError(t, m.SaveOrder(ctx, "7177570715"))
+
+	list, err := m.GetOrdersList(ctx, testLease)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, 0, list[0].Attempts)
+
+	err = m.UpdateOrder(ctx, &orders.UpdateOrder{
+		Number:      "7177570715",
+		Status:      orders.Processing,
+		NextCheckAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	notDue, err := m.GetOrdersList(ctx, testLease)
+	require.NoError(t, err)
+	assert.Empty(t, notDue)
+
+	m.orders["7177570715"].nextCheckAt = time.Now()
+	due, err := m.GetOrdersList(ctx, testLease)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, 1, due[0].Attempts)
+}
+
+func TestMemoryUpdateOrderAndWithdraw(t *testing.T) {
+	m, ctx := memoryWithUser(t, "Vasiliy")
+	require.NoError(t, m.SaveOrder(ctx, "7177570715"))
+
+	err := m.UpdateOrder(ctx, &orders.UpdateOrder{Number: "7177570715", Status: orders.Processed, Accrual: money.FromFloat(500)})
+	require.NoError(t, err)
+	assert.ErrorIs(t, m.UpdateOrder(ctx, &orders.UpdateOrder{Number: "1"}), ErrOrderNotExists)
+
+	// repeated PROCESSED response must not credit accrual twice
+	err = m.UpdateOrder(ctx, &orders.UpdateOrder{Number: "7177570715", Status: orders.Processed, Accrual: money.FromFloat(500)})
+	var errTransition *TransitionError
+	require.ErrorAs(t, err, &errTransition)
+	assert.Equal(t, orders.Processed, errTransition.From)
+
+	list, err := m.GetOrdersList(ctx, testLease)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	assert.ErrorIs(t,
+		m.BalanceWithdraw(ctx, balance.WithdrawRequest{Order: "3682151158", Sum: money.FromFloat(500.01)}),
+		ErrInsufficientFunds,
+	)
+	require.NoError(t, m.BalanceWithdraw(ctx, balance.WithdrawRequest{Order: "3682151158", Sum: money.FromFloat(200)}))
+	assert.ErrorIs(t, m.BalanceWithdraw(ctx, balance.WithdrawRequest{Order: "3682151158", Sum: money.FromFloat(1)}),
+		ErrWithdrawalExists)
+	// the duplicate is reported before the funds are checked, the same way the unique index does it
+	assert.ErrorIs(t, m.BalanceWithdraw(ctx, balance.WithdrawRequest{Order: "3682151158", Sum: money.FromFloat(9999)}),
+		ErrWithdrawalExists)
+
+	b, err := m.GetBalance(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, money.FromFloat(300), b.Current)
+	assert.Equal(t, money.FromFloat(200), b.Withdrawn)
+
+	wList, err := m.GetWithdrawals(ctx)
+	require.NoError(t, err)
+	assert.Len(t, wList, 1)
+
+	eList, err := m.GetLedger(ctx)
+	require.NoError(t, err)
+	require.Len(t, eList, 2)
+	assert.Equal(t, b.Current, eList[0].Amount+eList[1].Amount)
+	assert.Equal(t, ledger.Withdrawal, eList[1].Kind)
+
+	var total money.Amount
+	for _, e := range m.ledger {
+		total += e.Amount
+	}
+	assert.Equal(t, money.Amount(0), total, "ledger transactions must be balanced")
+
+	mList, err := m.ReconcileLedger(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, mList)
+	// the balance drifted from the ledger and the balance without any entries
+	m.balances["no-ledger"] = &BalanceEntity{Current: money.FromFloat(1)}
+	userID, err := getCtxUserID(ctx)
+	require.NoError(t, err)
+	m.balances[userID].Current += money.FromFloat(0.01)
+	mList, err = m.ReconcileLedger(ctx)
+	require.NoError(t, err)
+	assert.Len(t, mList, 2)
+}
+
+func TestMemoryUpdateOrderTransitions(t *testing.T) {
+	m, ctx := memoryWithUser(t, "Vasiliy")
+	require.NoError(t, m.SaveOrder(ctx, "7177570715"))
+	require.NoError(t, m.SaveOrder(ctx, "3682151158"))
+
+	steps := []struct {
+		number  string
+		status  orders.Status
+		accrual money.Amount
+		wantErr bool
+	}{
+		{number: "7177570715", status: orders.Processing, accrual: 0},
+		{number: "7177570715", status: orders.Processing, accrual: 0},
+		{number: "7177570715", status: orders.New, accrual: 0, wantErr: true},
+		{number: "7177570715", status: orders.Processed, accrual: money.FromFloat(100)},
+		{number: "7177570715", status: orders.Invalid, accrual: 0, wantErr: true},
+		{number: "3682151158", status: orders.Invalid, accrual: money.FromFloat(50)},
+		{number: "3682151158", status: orders.Processed, accrual: money.FromFloat(50), wantErr: true},
+	}
+	for _, st := range steps {
+		err := m.UpdateOrder(ctx, &orders.UpdateOrder{Number: st.number, Status: st.status, Accrual: st.accrual})
+		if st.wantErr {
+			var errTransition *TransitionError
+			assert.ErrorAs(t, err, &errTransition, "%s -> %s", st.number, st.status)
+			continue
+		}
+		assert.NoError(t, err, "%s -> %s", st.number, st.status)
+	}
+
+	b, err := m.GetBalance(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, money.FromFloat(100), b.Current)
+}
+
+func TestMemoryConcurrentWithdraw(t *testing.T) {
+	const (
+		workers = 10
+		sum     = money.Amount(10000)
+	)
+	m, ctx := memoryWithUser(t, "Vasiliy")
+	require.NoError(t, m.SaveOrder(ctx, "7177570715"))
+	require.NoError(t, m.UpdateOrder(ctx, &orders.UpdateOrder{
+		Number:  "7177570715",
+		Status:  orders.Processed,
+		Accrual: sum * workers / 2,
+	}))
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		accepted int
+	)
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := balance.WithdrawRequest{Order: string(rune('a' + i)), Sum: sum}
+			if err := m.BalanceWithdraw(ctx, req); err == nil {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	b, err := m.GetBalance(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, workers/2, accepted)
+	assert.Equal(t, money.Amount(0), b.Current)
+}
+
+func TestMemoryRotateRefreshToken(t *testing.T) {
+	m, ctx := memoryWithUser(t, "Vasiliy")
+	userID, err := getCtxUserID(ctx)
+	require.NoError(t, err)
+
+	first := &RefreshToken{Hash: []byte("first"), UserID: userID, ExpiresAt: time.Now().Add(time.Hour)}
+	require.NoError(t, m.SaveRefreshToken(ctx, first))
+	require.NotEmpty(t, first.FamilyID)
+
+	second := &RefreshToken{Hash: []byte("second"), ExpiresAt: time.Now().Add(time.Hour)}
+	require.NoError(t, m.RotateRefreshToken(ctx, first.Hash, second))
+	assert.Equal(t, userID, second.UserID)
+	assert.Equal(t, first.FamilyID, second.FamilyID)
+
+	err = m.RotateRefreshToken(ctx, first.Hash, &RefreshToken{Hash: []byte("third")})
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+	err = m.RotateRefreshToken(ctx, second.Hash, &RefreshToken{Hash: []byte("fourth")})
+	assert.ErrorIs(t, err, ErrRefreshTokenInvalid)
+
+	expired := &RefreshToken{Hash: []byte("expired"), UserID: userID, ExpiresAt: time.Now().Add(-time.Second)}
+	require.NoError(t, m.SaveRefreshToken(ctx, expired))
+	err = m.RotateRefreshToken(ctx, expired.Hash, &RefreshToken{Hash: []byte("fifth")})
+	assert.ErrorIs(t, err, ErrRefreshTokenInvalid)
+
+	err = m.RotateRefreshToken(ctx, []byte("unknown"), &RefreshToken{Hash: []byte("sixth")})
+	assert.ErrorIs(t, err, ErrRefreshTokenInvalid)
+}
+
+func TestMemoryResetPassword(t *testing.T) {
+	m, ctx := memoryWithUser(t, "Vasiliy")
+	user, err := m.GetUser(ctx, "Vasiliy")
+	require.NoError(t, err)
+
+	expired := &PasswordReset{Hash: []byte("expired"), UserID: user.ID, ExpiresAt: time.Now().Add(-time.Minute)}
+	require.NoError(t, m.SavePasswordReset(ctx, expired))
+	_, err = m.ResetPassword(ctx, expired.Hash, "new", time.Now())
+	assert.ErrorIs(t, err, ErrResetTokenInvalid)
+
+	// the newer token doesn't invalidate the previous one, using either of them invalidates both
+	first := &PasswordReset{Hash: []byte("first"), UserID: user.ID, ExpiresAt: time.Now().Add(time.Minute)}
+	second := &PasswordReset{Hash: []byte("second"), UserID: user.ID, ExpiresAt: time.Now().Add(time.Minute)}
+	require.NoError(t, m.SavePasswordReset(ctx, first))
+	require.NoError(t, m.SavePasswordReset(ctx, second))
+
+	cutoff := time.Now()
+	userID, err := m.ResetPassword(ctx, first.Hash, "new", cutoff)
+	require.NoError(t, err)
+	assert.Equal(t, cutoff, m.tokensValidAfter[user.ID])
+	_, err = m.ResetPassword(ctx, second.Hash, "new", cutoff)
+	assert.ErrorIs(t, err, ErrResetTokenInvalid)
+	assert.Equal(t, user.ID, userID)
+
+	byID, err := m.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "new", byID.Password)
+
+	// single use
+	_, err = m.ResetPassword(ctx, first.Hash, "another", time.Now())
+	assert.ErrorIs(t, err, ErrResetTokenInvalid)
+}
+
+func TestMemoryTwoFactor(t *testing.T) {
+	m, ctx := memoryWithUser(t, "Vasiliy")
+	user, err := m.GetUser(ctx, "Vasiliy")
+	require.NoError(t, err)
+
+	tf, err := m.GetTwoFactor(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, TwoFactor{}, *tf)
+
+	require.NoError(t, m.SaveTOTPSecret(ctx, user.ID, []byte("secret")))
+	assert.ErrorIs(t, m.UseTOTPStep(ctx, user.ID, 1), ErrTOTPStepUsed, "pending secret must not be usable")
+	require.NoError(t, m.EnableTwoFactor(ctx, user.ID, 10, [][]byte{[]byte("code")}))
+	assert.ErrorIs(t, m.SaveTOTPSecret(ctx, user.ID, []byte("another")), ErrTwoFactorEnabled)
+
+	// steps go forward only
+	assert.ErrorIs(t, m.UseTOTPStep(ctx, user.ID, 10), ErrTOTPStepUsed)
+	require.NoError(t, m.UseTOTPStep(ctx, user.ID, 11))
+	tf, err = m.GetTwoFactor(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, TwoFactor{Secret: []byte("secret"), LastStep: 11, Enabled: true}, *tf)
+
+	require.NoError(t, m.UseRecoveryCode(ctx, user.ID, []byte("code")))
+	assert.ErrorIs(t, m.UseRecoveryCode(ctx, user.ID, []byte("code")), ErrRecoveryCodeInvalid)
+
+	require.NoError(t, m.DisableTwoFactor(ctx, user.ID))
+	tf, err = m.GetTwoFactor(ctx, user.ID)
+	require.NoError(t, err)
+	assert.False(t, tf.Enabled)
+}
+
+func TestMemorySearchAndBlockUsers(t *testing.T) {
+	m, ctx := memoryWithUser(t, "vasiliy")
+	for _, login := range []string{"vasilisa", "petr"} {
+		_, err := m.SaveUser(ctx, &register.Request{Login: login, Password: "pwd"})
+		require.NoError(t, err)
+	}
+
+	found, err := m.SearchUsers(ctx, "vasil", 10)
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	assert.Equal(t, "vasilisa", found[0].Login)
+	assert.Empty(t, found[0].Password)
+
+	found, err = m.SearchUsers(ctx, "", 1)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, "petr", found[0].Login)
+
+	user, err := m.GetUser(ctx, "vasiliy")
+	require.NoError(t, err)
+	require.NoError(t, m.SetUserBlocked(ctx, user.ID, true))
+	blocked, err := m.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	require.NotNil(t, blocked.BlockedAt)
+
+	// blocking again keeps the time of the first block
+	require.NoError(t, m.SetUserBlocked(ctx, user.ID, true))
+	again, err := m.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, blocked.BlockedAt, again.BlockedAt)
+
+	require.NoError(t, m.SetUserBlocked(ctx, user.ID, false))
+	unblocked, err := m.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Nil(t, unblocked.BlockedAt)
+
+	assert.ErrorIs(t, m.SetUserRole(ctx, "unknown", admin.RoleAdmin), ErrUserNotExists)
+}
+
+func TestMemoryAdjustBalance(t *testing.T) {
+	m, ctx := memoryWithUser(t, "vasiliy")
+	userID, err := getCtxUserID(ctx)
+	require.NoError(t, err)
+
+	credit := &admin.Adjustment{UserID: userID, OperatorID: "operator", Reason: admin.ReasonGoodwill,
+		Reference: "T-1", Amount: money.FromFloat(50)}
+	require.NoError(t, m.AdjustBalance(ctx, credit))
+	assert.Equal(t, money.FromFloat(50), credit.BalanceAfter)
+
+	again := *credit
+	assert.ErrorIs(t, m.AdjustBalance(ctx, &again), ErrAdjustmentExists)
+
+	debit := &admin.Adjustment{UserID: userID, OperatorID: "operator", Reason: admin.ReasonFraud,
+		Reference: "T-2", Amount: money.FromFloat(-50.01)}
+	assert.ErrorIs(t, m.AdjustBalance(ctx, debit), ErrInsufficientFunds)
+	debit.Amount = money.FromFloat(-20)
+	require.NoError(t, m.AdjustBalance(ctx, debit))
+
+	assert.ErrorIs(t, m.AdjustBalance(ctx, &admin.Adjustment{UserID: "unknown", Reference: "T-3", Amount: 1}),
+		ErrUserNotExists)
+
+	b, err := m.GetBalance(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, money.FromFloat(30), b.Current)
+	assert.Zero(t, b.Withdrawn)
+
+	entries, err := m.GetLedger(ctx)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, ledger.Adjustment, entries[1].Kind)
+	assert.Equal(t, money.FromFloat(-20), entries[1].Amount)
+
+	trail, err := m.GetAdjustments(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, trail, 2)
+	assert.Equal(t, "T-2", trail[0].Reference)
+}
@@ -0,0 +1,15 @@
+BEGIN TRANSACTION;
+
+-- 3. every transaction is balanced at commit
+DROP TRIGGER IF EXISTS trg_ledger_transaction_is_balanced ON ledger;
+DROP FUNCTION IF EXISTS ledger_transaction_is_balanced;
+
+-- 2. ledger entries are immutable
+DROP TRIGGER IF EXISTS trg_ledger_is_immutable ON ledger;
+DROP FUNCTION IF EXISTS ledger_is_immutable;
+
+-- 1. ledger
+DROP TABLE IF EXISTS ledger;
+DROP SEQUENCE IF EXISTS ledger_transaction_seq;
+
+COMMIT;
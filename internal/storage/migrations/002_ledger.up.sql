@@ -0,0 +1,79 @@
+BEGIN TRANSACTION;
+
+-- 1. ledger
+-- Every movement of points is a transaction of two entries: one on the user account
+-- and the opposite one on the system account, so entries of a transaction sum up to zero.
+CREATE SEQUENCE IF NOT EXISTS ledger_transaction_seq;
+
+CREATE TABLE IF NOT EXISTS ledger(
+    entry_id BIGSERIAL PRIMARY KEY,
+    transaction_id BIGINT NOT NULL,
+    account VARCHAR(50) NOT NULL,
+    user_id UUID,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('ACCRUAL', 'WITHDRAWAL', 'ADJUSTMENT', 'REVERSAL')),
+    amount DECIMAL(10, 2) NOT NULL CHECK (amount <> 0),
+    order_id VARCHAR(200),
+    created_at TIMESTAMP DEFAULT NOW(),
+
+    FOREIGN KEY (user_id) REFERENCES users(user_id),
+    CHECK ((account = 'user') = (user_id IS NOT NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_user_id ON ledger (user_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_transaction_id ON ledger (transaction_id);
+
+-- 2. ledger entries are immutable
+CREATE OR REPLACE FUNCTION ledger_is_immutable() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'ledger entries are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_ledger_is_immutable
+    BEFORE UPDATE OR DELETE ON ledger
+    FOR EACH ROW EXECUTE FUNCTION ledger_is_immutable();
+
+-- 3. every transaction is balanced at commit
+CREATE OR REPLACE FUNCTION ledger_transaction_is_balanced() RETURNS TRIGGER AS $$
+BEGIN
+    IF (SELECT SUM(amount) FROM ledger WHERE transaction_id = NEW.transaction_id) <> 0 THEN
+        RAISE EXCEPTION 'ledger transaction % is not balanced', NEW.transaction_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER trg_ledger_transaction_is_balanced
+    AFTER INSERT ON ledger
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION ledger_transaction_is_balanced();
+
+-- 4. opening entries for the data created before the ledger
+CREATE TEMPORARY TABLE ledger_opening ON COMMIT DROP AS
+SELECT nextval('ledger_transaction_seq') AS transaction_id, user_id, kind, amount, order_id, created_at
+FROM (
+    SELECT user_id, 'ACCRUAL' AS kind, bonus AS amount, order_id, uploaded_at AS created_at
+    FROM orders WHERE status = 'PROCESSED' AND bonus > 0
+    UNION ALL
+    SELECT user_id, 'WITHDRAWAL', -amount, order_id, processed_at
+    FROM withdrawals WHERE amount > 0
+) AS movements;
+
+-- balance could drift from the movements above, so the difference is recorded as an adjustment
+INSERT INTO ledger_opening (transaction_id, user_id, kind, amount, created_at)
+SELECT nextval('ledger_transaction_seq'), b.user_id, 'ADJUSTMENT', b.current - COALESCE(m.total, 0), NOW()
+FROM balance b
+LEFT JOIN (SELECT user_id, SUM(amount) AS total FROM ledger_opening GROUP BY user_id) m ON m.user_id = b.user_id
+WHERE b.current <> COALESCE(m.total, 0);
+
+INSERT INTO ledger (transaction_id, account, user_id, kind, amount, order_id, created_at)
+SELECT transaction_id, 'user', user_id, kind, amount, order_id, created_at FROM ledger_opening
+UNION ALL
+SELECT transaction_id,
+       CASE kind WHEN 'ACCRUAL' THEN 'system:accrual'
+                 WHEN 'WITHDRAWAL' THEN 'system:withdrawals'
+                 ELSE 'system:adjustments' END,
+       NULL, kind, -amount, order_id, created_at
+FROM ledger_opening;
+
+COMMIT;
@@ -0,0 +1,8 @@
+BEGIN TRANSACTION;
+
+-- 1. orders leasing for accrual polling
+DROP INDEX IF EXISTS idx_orders_unprocessed;
+ALTER TABLE orders DROP COLUMN IF EXISTS locked_by;
+ALTER TABLE orders DROP COLUMN IF EXISTS locked_until;
+
+COMMIT;
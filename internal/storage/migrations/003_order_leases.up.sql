@@ -0,0 +1,9 @@
+BEGIN TRANSACTION;
+
+-- 1. orders leasing for accrual polling
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS locked_until TIMESTAMPTZ;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS locked_by VARCHAR(200);
+
+CREATE INDEX IF NOT EXISTS idx_orders_unprocessed ON orders (uploaded_at) WHERE status IN ('NEW', 'PROCESSING');
+
+COMMIT;
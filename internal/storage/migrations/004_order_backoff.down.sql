@@ -0,0 +1,11 @@
+BEGIN TRANSACTION;
+
+-- 1. orders polling schedule
+DROP INDEX IF EXISTS idx_orders_unprocessed;
+CREATE INDEX IF NOT EXISTS idx_orders_unprocessed ON orders (uploaded_at) WHERE status IN ('NEW', 'PROCESSING');
+
+ALTER TABLE orders DROP COLUMN IF EXISTS stuck;
+ALTER TABLE orders DROP COLUMN IF EXISTS next_check_at;
+ALTER TABLE orders DROP COLUMN IF EXISTS attempts;
+
+COMMIT;
@@ -0,0 +1,11 @@
+BEGIN TRANSACTION;
+
+-- 1. orders polling schedule
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS next_check_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS stuck BOOLEAN NOT NULL DEFAULT FALSE;
+
+DROP INDEX IF EXISTS idx_orders_unprocessed;
+CREATE INDEX IF NOT EXISTS idx_orders_unprocessed ON orders (next_check_at) WHERE status IN ('NEW', 'PROCESSING');
+
+COMMIT;
@@ -0,0 +1,11 @@
+BEGIN TRANSACTION;
+
+-- 1. orders processing failures
+DROP INDEX IF EXISTS idx_orders_unprocessed;
+CREATE INDEX IF NOT EXISTS idx_orders_unprocessed ON orders (next_check_at) WHERE status IN ('NEW', 'PROCESSING');
+
+ALTER TABLE orders DROP COLUMN IF EXISTS dead_letter;
+ALTER TABLE orders DROP COLUMN IF EXISTS last_error;
+ALTER TABLE orders DROP COLUMN IF EXISTS failures;
+
+COMMIT;
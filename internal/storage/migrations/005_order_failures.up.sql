@@ -0,0 +1,12 @@
+BEGIN TRANSACTION;
+
+-- 1. orders processing failures
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS failures INT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS last_error TEXT;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS dead_letter BOOLEAN NOT NULL DEFAULT FALSE;
+
+DROP INDEX IF EXISTS idx_orders_unprocessed;
+CREATE INDEX IF NOT EXISTS idx_orders_unprocessed ON orders (next_check_at)
+    WHERE status IN ('NEW', 'PROCESSING') AND NOT dead_letter;
+
+COMMIT;
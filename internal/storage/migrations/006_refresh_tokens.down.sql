@@ -0,0 +1,6 @@
+BEGIN TRANSACTION;
+
+-- 1. refresh tokens
+DROP TABLE IF EXISTS refresh_tokens;
+
+COMMIT;
@@ -0,0 +1,18 @@
+BEGIN TRANSACTION;
+
+-- 1. refresh tokens, only SHA-256 of the token is stored
+CREATE TABLE IF NOT EXISTS refresh_tokens(
+    token_hash BYTEA PRIMARY KEY,
+    family_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (user_id) REFERENCES users(user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens (family_id);
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN TRANSACTION;
+
+-- 1. revoked access tokens
+DROP TABLE IF EXISTS revoked_tokens;
+
+-- 2. tokens cutoff
+ALTER TABLE users DROP COLUMN IF EXISTS tokens_valid_after;
+
+COMMIT;
@@ -0,0 +1,12 @@
+BEGIN TRANSACTION;
+
+-- 1. revoked access tokens, kept until they expire
+CREATE TABLE IF NOT EXISTS revoked_tokens(
+    jti VARCHAR(64) PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- 2. tokens issued before the cutoff are rejected, it is set by logging out of all sessions
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tokens_valid_after TIMESTAMPTZ;
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN TRANSACTION;
+
+-- 1. password reset tokens
+DROP TABLE IF EXISTS password_resets;
+
+COMMIT;
@@ -0,0 +1,16 @@
+BEGIN TRANSACTION;
+
+-- 1. password reset tokens, only SHA-256 of the token is stored
+CREATE TABLE IF NOT EXISTS password_resets(
+    token_hash BYTEA PRIMARY KEY,
+    user_id UUID NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (user_id) REFERENCES users(user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_resets_user ON password_resets (user_id);
+
+COMMIT;
@@ -0,0 +1,11 @@
+BEGIN TRANSACTION;
+
+-- 1. recovery codes
+DROP TABLE IF EXISTS recovery_codes;
+
+-- 2. TOTP secret
+ALTER TABLE users DROP COLUMN IF EXISTS totp_last_step;
+ALTER TABLE users DROP COLUMN IF EXISTS totp_enabled;
+ALTER TABLE users DROP COLUMN IF EXISTS totp_secret;
+
+COMMIT;
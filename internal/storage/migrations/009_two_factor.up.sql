@@ -0,0 +1,19 @@
+BEGIN TRANSACTION;
+
+-- 1. TOTP secret, it is pending until the first code confirms the enrollment;
+-- the last used time step rejects replayed codes
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret BYTEA;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+-- 2. single use recovery codes, only SHA-256 of the code is stored
+CREATE TABLE IF NOT EXISTS recovery_codes(
+    user_id UUID NOT NULL,
+    code_hash BYTEA NOT NULL,
+    used_at TIMESTAMPTZ,
+
+    PRIMARY KEY (user_id, code_hash),
+    FOREIGN KEY (user_id) REFERENCES users(user_id)
+);
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN TRANSACTION;
+
+-- 1. blocked users
+ALTER TABLE users DROP COLUMN IF EXISTS blocked_at;
+
+-- 2. roles
+ALTER TABLE users DROP COLUMN IF EXISTS role;
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN TRANSACTION;
+
+-- 1. role of the user, operators are granted support or admin by an admin
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user'
+    CHECK (role IN ('user', 'support', 'admin'));
+
+-- 2. blocked users can't log in
+ALTER TABLE users ADD COLUMN IF NOT EXISTS blocked_at TIMESTAMPTZ;
+
+COMMIT;
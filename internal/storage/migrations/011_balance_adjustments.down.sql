@@ -0,0 +1,10 @@
+BEGIN TRANSACTION;
+
+-- 2. audit records are immutable
+DROP TRIGGER IF EXISTS trg_balance_adjustments_are_immutable ON balance_adjustments;
+DROP FUNCTION IF EXISTS balance_adjustments_are_immutable;
+
+-- 1. audit trail of balance adjustments
+DROP TABLE IF EXISTS balance_adjustments;
+
+COMMIT;
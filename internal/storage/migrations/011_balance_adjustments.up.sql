@@ -0,0 +1,35 @@
+BEGIN TRANSACTION;
+
+-- 1. audit trail of balance adjustments made by operators, each one is a transaction of the ledger
+CREATE TABLE IF NOT EXISTS balance_adjustments(
+    adjustment_id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    operator_id UUID NOT NULL,
+    transaction_id BIGINT NOT NULL,
+    reason VARCHAR(20) NOT NULL
+        CHECK (reason IN ('COMPENSATION', 'GOODWILL', 'CORRECTION', 'CHARGEBACK', 'FRAUD')),
+    reference VARCHAR(200) NOT NULL,
+    comment TEXT NOT NULL DEFAULT '',
+    amount DECIMAL(10, 2) NOT NULL CHECK (amount <> 0),
+    balance_after DECIMAL(10, 2) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (user_id) REFERENCES users(user_id),
+    FOREIGN KEY (operator_id) REFERENCES users(user_id)
+);
+
+-- the reference is unique for the user, so a retried request isn't applied twice
+CREATE UNIQUE INDEX IF NOT EXISTS idx_adjustment_reference_is_unique ON balance_adjustments (user_id, reference);
+
+-- 2. audit records are immutable as the ledger entries are
+CREATE OR REPLACE FUNCTION balance_adjustments_are_immutable() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'balance adjustments are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_balance_adjustments_are_immutable
+    BEFORE UPDATE OR DELETE ON balance_adjustments
+    FOR EACH ROW EXECUTE FUNCTION balance_adjustments_are_immutable();
+
+COMMIT;
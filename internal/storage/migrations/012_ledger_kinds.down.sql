@@ -0,0 +1,8 @@
+BEGIN TRANSACTION;
+
+-- 1. ledger kinds
+ALTER TABLE ledger DROP CONSTRAINT IF EXISTS ledger_kind_check;
+ALTER TABLE ledger ADD CONSTRAINT ledger_kind_check
+    CHECK (kind IN ('ACCRUAL', 'WITHDRAWAL', 'ADJUSTMENT', 'REVERSAL'));
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN TRANSACTION;
+
+-- 1. corrections of the ledger are recorded as ADJUSTMENT transactions, there are no reversals
+ALTER TABLE ledger DROP CONSTRAINT IF EXISTS ledger_kind_check;
+ALTER TABLE ledger ADD CONSTRAINT ledger_kind_check CHECK (kind IN ('ACCRUAL', 'WITHDRAWAL', 'ADJUSTMENT'));
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN TRANSACTION;
+
+-- 1. login failures
+DROP TABLE IF EXISTS login_failures;
+
+COMMIT;
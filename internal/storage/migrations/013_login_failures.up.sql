@@ -0,0 +1,13 @@
+BEGIN TRANSACTION;
+
+-- 1. failed attempts of logins and client addresses shared by the instances
+CREATE TABLE IF NOT EXISTS login_failures(
+    key TEXT PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_failures_last_failure ON login_failures (last_failure);
+
+COMMIT;
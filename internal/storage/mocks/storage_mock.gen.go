@@ -12,7 +12,9 @@ package mocks
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
+	admin "github.com/RIBorisov/gophermart/internal/models/admin"
 	balance "github.com/RIBorisov/gophermart/internal/models/balance"
 	orders "github.com/RIBorisov/gophermart/internal/models/orders"
 	register "github.com/RIBorisov/gophermart/internal/models/register"
@@ -43,6 +45,35 @@ func (m *MockStore) EXPECT() *MockStoreMockRecorder {
 	return m.recorder
 }
 
+// AddLoginFailure mocks base method.
+func (m *MockStore) AddLoginFailure(ctx context.Context, key string, now time.Time, limit storage.LoginFailureLimit) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddLoginFailure", ctx, key, now, limit)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddLoginFailure indicates an expected call of AddLoginFailure.
+func (mr *MockStoreMockRecorder) AddLoginFailure(ctx, key, now, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddLoginFailure", reflect.TypeOf((*MockStore)(nil).AddLoginFailure), ctx, key, now, limit)
+}
+
+// AdjustBalance mocks base method.
+func (m *MockStore) AdjustBalance(ctx context.Context, adj *admin.Adjustment) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AdjustBalance", ctx, adj)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AdjustBalance indicates an expected call of AdjustBalance.
+func (mr *MockStoreMockRecorder) AdjustBalance(ctx, adj any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AdjustBalance", reflect.TypeOf((*MockStore)(nil).AdjustBalance), ctx, adj)
+}
+
 // BalanceWithdraw mocks base method.
 func (m *MockStore) BalanceWithdraw(ctx context.Context, req balance.WithdrawRequest) error {
 	m.ctrl.T.Helper()
@@ -57,6 +88,20 @@ func (mr *MockStoreMockRecorder) BalanceWithdraw(ctx, req any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BalanceWithdraw", reflect.TypeOf((*MockStore)(nil).BalanceWithdraw), ctx, req)
 }
 
+// ChangePassword mocks base method.
+func (m *MockStore) ChangePassword(ctx context.Context, userID string, password string, cutoff time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChangePassword", ctx, userID, password, cutoff)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ChangePassword indicates an expected call of ChangePassword.
+func (mr *MockStoreMockRecorder) ChangePassword(ctx, userID, password, cutoff any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangePassword", reflect.TypeOf((*MockStore)(nil).ChangePassword), ctx, userID, password, cutoff)
+}
+
 // ClosePool mocks base method.
 func (m *MockStore) ClosePool() error {
 	m.ctrl.T.Helper()
@@ -71,6 +116,93 @@ func (mr *MockStoreMockRecorder) ClosePool() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClosePool", reflect.TypeOf((*MockStore)(nil).ClosePool))
 }
 
+// CountPasswordHashesWithoutPrefix mocks base method.
+func (m *MockStore) CountPasswordHashesWithoutPrefix(ctx context.Context, prefixes []string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountPasswordHashesWithoutPrefix", ctx, prefixes)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountPasswordHashesWithoutPrefix indicates an expected call of CountPasswordHashesWithoutPrefix.
+func (mr *MockStoreMockRecorder) CountPasswordHashesWithoutPrefix(ctx, prefixes any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountPasswordHashesWithoutPrefix", reflect.TypeOf((*MockStore)(nil).CountPasswordHashesWithoutPrefix), ctx, prefixes)
+}
+
+// DeleteLoginFailures mocks base method.
+func (m *MockStore) DeleteLoginFailures(ctx context.Context, key string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteLoginFailures", ctx, key)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteLoginFailures indicates an expected call of DeleteLoginFailures.
+func (mr *MockStoreMockRecorder) DeleteLoginFailures(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteLoginFailures", reflect.TypeOf((*MockStore)(nil).DeleteLoginFailures), ctx, key)
+}
+
+// DisableTwoFactor mocks base method.
+func (m *MockStore) DisableTwoFactor(ctx context.Context, userID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DisableTwoFactor", ctx, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DisableTwoFactor indicates an expected call of DisableTwoFactor.
+func (mr *MockStoreMockRecorder) DisableTwoFactor(ctx, userID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisableTwoFactor", reflect.TypeOf((*MockStore)(nil).DisableTwoFactor), ctx, userID)
+}
+
+// EnableTwoFactor mocks base method.
+func (m *MockStore) EnableTwoFactor(ctx context.Context, userID string, step int64, recoveryCodes [][]byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnableTwoFactor", ctx, userID, step, recoveryCodes)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnableTwoFactor indicates an expected call of EnableTwoFactor.
+func (mr *MockStoreMockRecorder) EnableTwoFactor(ctx, userID, step, recoveryCodes any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnableTwoFactor", reflect.TypeOf((*MockStore)(nil).EnableTwoFactor), ctx, userID, step, recoveryCodes)
+}
+
+// FailOrder mocks base method.
+func (m *MockStore) FailOrder(ctx context.Context, data *orders.Failure) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FailOrder", ctx, data)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FailOrder indicates an expected call of FailOrder.
+func (mr *MockStoreMockRecorder) FailOrder(ctx, data any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FailOrder", reflect.TypeOf((*MockStore)(nil).FailOrder), ctx, data)
+}
+
+// GetAdjustments mocks base method.
+func (m *MockStore) GetAdjustments(ctx context.Context, userID string) ([]admin.Adjustment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAdjustments", ctx, userID)
+	ret0, _ := ret[0].([]admin.Adjustment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAdjustments indicates an expected call of GetAdjustments.
+func (mr *MockStoreMockRecorder) GetAdjustments(ctx, userID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAdjustments", reflect.TypeOf((*MockStore)(nil).GetAdjustments), ctx, userID)
+}
+
 // GetBalance mocks base method.
 func (m *MockStore) GetBalance(ctx context.Context) (*storage.BalanceEntity, error) {
 	m.ctrl.T.Helper()
@@ -86,19 +218,79 @@ func (mr *MockStoreMockRecorder) GetBalance(ctx any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBalance", reflect.TypeOf((*MockStore)(nil).GetBalance), ctx)
 }
 
+// GetLedger mocks base method.
+func (m *MockStore) GetLedger(ctx context.Context) ([]storage.LedgerEntity, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLedger", ctx)
+	ret0, _ := ret[0].([]storage.LedgerEntity)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLedger indicates an expected call of GetLedger.
+func (mr *MockStoreMockRecorder) GetLedger(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLedger", reflect.TypeOf((*MockStore)(nil).GetLedger), ctx)
+}
+
+// GetLoginFailures mocks base method.
+func (m *MockStore) GetLoginFailures(ctx context.Context, keys []string) (map[string]storage.LoginFailures, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLoginFailures", ctx, keys)
+	ret0, _ := ret[0].(map[string]storage.LoginFailures)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLoginFailures indicates an expected call of GetLoginFailures.
+func (mr *MockStoreMockRecorder) GetLoginFailures(ctx, keys any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLoginFailures", reflect.TypeOf((*MockStore)(nil).GetLoginFailures), ctx, keys)
+}
+
 // GetOrdersList mocks base method.
-func (m *MockStore) GetOrdersList(ctx context.Context) ([]string, error) {
+func (m *MockStore) GetOrdersList(ctx context.Context, lease *orders.Lease) ([]orders.Pending, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetOrdersList", ctx)
-	ret0, _ := ret[0].([]string)
+	ret := m.ctrl.Call(m, "GetOrdersList", ctx, lease)
+	ret0, _ := ret[0].([]orders.Pending)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetOrdersList indicates an expected call of GetOrdersList.
-func (mr *MockStoreMockRecorder) GetOrdersList(ctx any) *gomock.Call {
+func (mr *MockStoreMockRecorder) GetOrdersList(ctx, lease any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrdersList", reflect.TypeOf((*MockStore)(nil).GetOrdersList), ctx)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrdersList", reflect.TypeOf((*MockStore)(nil).GetOrdersList), ctx, lease)
+}
+
+// GetTokenState mocks base method.
+func (m *MockStore) GetTokenState(ctx context.Context, jti string, userID string, sessionID string) (*storage.TokenState, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTokenState", ctx, jti, userID, sessionID)
+	ret0, _ := ret[0].(*storage.TokenState)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTokenState indicates an expected call of GetTokenState.
+func (mr *MockStoreMockRecorder) GetTokenState(ctx, jti, userID, sessionID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTokenState", reflect.TypeOf((*MockStore)(nil).GetTokenState), ctx, jti, userID, sessionID)
+}
+
+// GetTwoFactor mocks base method.
+func (m *MockStore) GetTwoFactor(ctx context.Context, userID string) (*storage.TwoFactor, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTwoFactor", ctx, userID)
+	ret0, _ := ret[0].(*storage.TwoFactor)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTwoFactor indicates an expected call of GetTwoFactor.
+func (mr *MockStoreMockRecorder) GetTwoFactor(ctx, userID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTwoFactor", reflect.TypeOf((*MockStore)(nil).GetTwoFactor), ctx, userID)
 }
 
 // GetUser mocks base method.
@@ -116,6 +308,21 @@ func (mr *MockStoreMockRecorder) GetUser(ctx, login any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockStore)(nil).GetUser), ctx, login)
 }
 
+// GetUserByID mocks base method.
+func (m *MockStore) GetUserByID(ctx context.Context, userID string) (*storage.UserRow, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByID", ctx, userID)
+	ret0, _ := ret[0].(*storage.UserRow)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByID indicates an expected call of GetUserByID.
+func (mr *MockStoreMockRecorder) GetUserByID(ctx, userID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByID", reflect.TypeOf((*MockStore)(nil).GetUserByID), ctx, userID)
+}
+
 // GetUserOrders mocks base method.
 func (m *MockStore) GetUserOrders(ctx context.Context) ([]storage.OrderEntity, error) {
 	m.ctrl.T.Helper()
@@ -146,6 +353,92 @@ func (mr *MockStoreMockRecorder) GetWithdrawals(ctx any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWithdrawals", reflect.TypeOf((*MockStore)(nil).GetWithdrawals), ctx)
 }
 
+// PruneLoginFailures mocks base method.
+func (m *MockStore) PruneLoginFailures(ctx context.Context, now time.Time, before time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PruneLoginFailures", ctx, now, before)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PruneLoginFailures indicates an expected call of PruneLoginFailures.
+func (mr *MockStoreMockRecorder) PruneLoginFailures(ctx, now, before any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PruneLoginFailures", reflect.TypeOf((*MockStore)(nil).PruneLoginFailures), ctx, now, before)
+}
+
+// ReconcileLedger mocks base method.
+func (m *MockStore) ReconcileLedger(ctx context.Context) ([]storage.LedgerMismatch, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReconcileLedger", ctx)
+	ret0, _ := ret[0].([]storage.LedgerMismatch)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReconcileLedger indicates an expected call of ReconcileLedger.
+func (mr *MockStoreMockRecorder) ReconcileLedger(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReconcileLedger", reflect.TypeOf((*MockStore)(nil).ReconcileLedger), ctx)
+}
+
+// ResetPassword mocks base method.
+func (m *MockStore) ResetPassword(ctx context.Context, hash []byte, password string, cutoff time.Time) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetPassword", ctx, hash, password, cutoff)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ResetPassword indicates an expected call of ResetPassword.
+func (mr *MockStoreMockRecorder) ResetPassword(ctx, hash, password, cutoff any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetPassword", reflect.TypeOf((*MockStore)(nil).ResetPassword), ctx, hash, password, cutoff)
+}
+
+// RevokeSession mocks base method.
+func (m *MockStore) RevokeSession(ctx context.Context, jti string, expiresAt time.Time, familyID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeSession", ctx, jti, expiresAt, familyID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeSession indicates an expected call of RevokeSession.
+func (mr *MockStoreMockRecorder) RevokeSession(ctx, jti, expiresAt, familyID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeSession", reflect.TypeOf((*MockStore)(nil).RevokeSession), ctx, jti, expiresAt, familyID)
+}
+
+// RevokeUserSessions mocks base method.
+func (m *MockStore) RevokeUserSessions(ctx context.Context, userID string, cutoff time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeUserSessions", ctx, userID, cutoff)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeUserSessions indicates an expected call of RevokeUserSessions.
+func (mr *MockStoreMockRecorder) RevokeUserSessions(ctx, userID, cutoff any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeUserSessions", reflect.TypeOf((*MockStore)(nil).RevokeUserSessions), ctx, userID, cutoff)
+}
+
+// RotateRefreshToken mocks base method.
+func (m *MockStore) RotateRefreshToken(ctx context.Context, used []byte, next *storage.RefreshToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateRefreshToken", ctx, used, next)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RotateRefreshToken indicates an expected call of RotateRefreshToken.
+func (mr *MockStoreMockRecorder) RotateRefreshToken(ctx, used, next any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateRefreshToken", reflect.TypeOf((*MockStore)(nil).RotateRefreshToken), ctx, used, next)
+}
+
 // SaveOrder mocks base method.
 func (m *MockStore) SaveOrder(ctx context.Context, orderNo string) error {
 	m.ctrl.T.Helper()
@@ -160,6 +453,48 @@ func (mr *MockStoreMockRecorder) SaveOrder(ctx, orderNo any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveOrder", reflect.TypeOf((*MockStore)(nil).SaveOrder), ctx, orderNo)
 }
 
+// SavePasswordReset mocks base method.
+func (m *MockStore) SavePasswordReset(ctx context.Context, reset *storage.PasswordReset) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SavePasswordReset", ctx, reset)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SavePasswordReset indicates an expected call of SavePasswordReset.
+func (mr *MockStoreMockRecorder) SavePasswordReset(ctx, reset any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SavePasswordReset", reflect.TypeOf((*MockStore)(nil).SavePasswordReset), ctx, reset)
+}
+
+// SaveRefreshToken mocks base method.
+func (m *MockStore) SaveRefreshToken(ctx context.Context, token *storage.RefreshToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveRefreshToken", ctx, token)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveRefreshToken indicates an expected call of SaveRefreshToken.
+func (mr *MockStoreMockRecorder) SaveRefreshToken(ctx, token any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveRefreshToken", reflect.TypeOf((*MockStore)(nil).SaveRefreshToken), ctx, token)
+}
+
+// SaveTOTPSecret mocks base method.
+func (m *MockStore) SaveTOTPSecret(ctx context.Context, userID string, secret []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveTOTPSecret", ctx, userID, secret)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveTOTPSecret indicates an expected call of SaveTOTPSecret.
+func (mr *MockStoreMockRecorder) SaveTOTPSecret(ctx, userID, secret any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveTOTPSecret", reflect.TypeOf((*MockStore)(nil).SaveTOTPSecret), ctx, userID, secret)
+}
+
 // SaveUser mocks base method.
 func (m *MockStore) SaveUser(ctx context.Context, user *register.Request) (string, error) {
 	m.ctrl.T.Helper()
@@ -175,6 +510,49 @@ func (mr *MockStoreMockRecorder) SaveUser(ctx, user any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveUser", reflect.TypeOf((*MockStore)(nil).SaveUser), ctx, user)
 }
 
+// SearchUsers mocks base method.
+func (m *MockStore) SearchUsers(ctx context.Context, loginPrefix string, limit int) ([]storage.UserRow, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchUsers", ctx, loginPrefix, limit)
+	ret0, _ := ret[0].([]storage.UserRow)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchUsers indicates an expected call of SearchUsers.
+func (mr *MockStoreMockRecorder) SearchUsers(ctx, loginPrefix, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchUsers", reflect.TypeOf((*MockStore)(nil).SearchUsers), ctx, loginPrefix, limit)
+}
+
+// SetUserBlocked mocks base method.
+func (m *MockStore) SetUserBlocked(ctx context.Context, userID string, blocked bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserBlocked", ctx, userID, blocked)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUserBlocked indicates an expected call of SetUserBlocked.
+func (mr *MockStoreMockRecorder) SetUserBlocked(ctx, userID, blocked any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserBlocked", reflect.TypeOf((*MockStore)(nil).SetUserBlocked), ctx, userID, blocked)
+}
+
+// SetUserRole mocks base method.
+func (m *MockStore) SetUserRole(ctx context.Context, userID string, role admin.Role) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserRole", ctx, userID, role)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUserRole indicates an expected call of SetUserRole.
+func (mr *MockStoreMockRecorder) SetUserRole(ctx, userID, role any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserRole", reflect.TypeOf((*MockStore)(nil).SetUserRole), ctx, userID, role)
+}
+
 // UpdateOrder mocks base method.
 func (m *MockStore) UpdateOrder(ctx context.Context, data *orders.UpdateOrder) error {
 	m.ctrl.T.Helper()
@@ -188,3 +566,45 @@ func (mr *MockStoreMockRecorder) UpdateOrder(ctx, data any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOrder", reflect.TypeOf((*MockStore)(nil).UpdateOrder), ctx, data)
 }
+
+// UpdatePassword mocks base method.
+func (m *MockStore) UpdatePassword(ctx context.Context, userID string, password string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePassword", ctx, userID, password)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePassword indicates an expected call of UpdatePassword.
+func (mr *MockStoreMockRecorder) UpdatePassword(ctx, userID, password any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePassword", reflect.TypeOf((*MockStore)(nil).UpdatePassword), ctx, userID, password)
+}
+
+// UseRecoveryCode mocks base method.
+func (m *MockStore) UseRecoveryCode(ctx context.Context, userID string, hash []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRecoveryCode", ctx, userID, hash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseRecoveryCode indicates an expected call of UseRecoveryCode.
+func (mr *MockStoreMockRecorder) UseRecoveryCode(ctx, userID, hash any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRecoveryCode", reflect.TypeOf((*MockStore)(nil).UseRecoveryCode), ctx, userID, hash)
+}
+
+// UseTOTPStep mocks base method.
+func (m *MockStore) UseTOTPStep(ctx context.Context, userID string, step int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseTOTPStep", ctx, userID, step)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseTOTPStep indicates an expected call of UseTOTPStep.
+func (mr *MockStoreMockRecorder) UseTOTPStep(ctx, userID, step any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseTOTPStep", reflect.TypeOf((*MockStore)(nil).UseTOTPStep), ctx, userID, step)
+}
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// PasswordReset is the server side state of the password reset token, only hash of the token is stored.
+type PasswordReset struct {
+	ExpiresAt time.Time
+	UserID    string
+	Hash      []byte
+}
+
+func (d *DB) GetUserByID(ctx context.Context, userID string) (*UserRow, error) {
+	const getStmt = `SELECT user_id, login, password, role, blocked_at FROM users WHERE user_id = $1`
+
+	var (
+		uRow UserRow
+		pass []byte
+	)
+	if err := d.pool.QueryRow(ctx, getStmt, userID).Scan(&uRow.ID, &uRow.Login, &pass, &uRow.Role, &uRow.BlockedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) || malformedID(err) {
+			return nil, ErrUserNotExists
+		}
+		return nil, fmt.Errorf("failed scan row: %w", err)
+	}
+	uRow.Password = string(pass)
+
+	return &uRow, nil
+}
+
+// UpdatePassword replaces password hash of the user.
+func (d *DB) UpdatePassword(ctx context.Context, userID, password string) error {
+	const updateStmt = `UPDATE users SET password = $2 WHERE user_id = $1`
+
+	tag, err := d.pool.Exec(ctx, updateStmt, userID, password)
+	if err != nil {
+		return fmt.Errorf("failed update password: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotExists
+	}
+
+	return nil
+}
+
+// ChangePassword replaces password hash of the user and revokes the user sessions like RevokeUserSessions
+// in one transaction, so the password doesn't change while the sessions stay alive.
+func (d *DB) ChangePassword(ctx context.Context, userID, password string, cutoff time.Time) error {
+	const updateStmt = `UPDATE users SET password = $2 WHERE user_id = $1`
+
+	tx, err := d.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "read committed"})
+	if err != nil {
+		return fmt.Errorf("failed begin tx: %w", err)
+	}
+
+	defer func() {
+		if err = tx.Rollback(ctx); err != nil {
+			d.log.Warn("failed rollback transaction", "txError", err)
+		}
+	}()
+
+	tag, err := tx.Exec(ctx, updateStmt, userID, password)
+	if err != nil {
+		return fmt.Errorf("failed update password: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotExists
+	}
+	if err = revokeUserSessions(ctx, tx, userID, cutoff); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed commit tx: %w", err)
+	}
+
+	return nil
+}
+
+// SavePasswordReset saves the reset token, tokens requested by the user earlier stay valid until they expire
+// or one of them is used, so repeated requests can't invalidate the link the user has got.
+func (d *DB) SavePasswordReset(ctx context.Context, reset *PasswordReset) error {
+	const (
+		deleteStmt = `DELETE FROM password_resets WHERE expires_at < NOW()`
+		insertStmt = `INSERT INTO password_resets (token_hash, user_id, expires_at) VALUES ($1, $2, $3)`
+	)
+
+	tx, err := d.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "read committed"})
+	if err != nil {
+		return fmt.Errorf("failed begin tx: %w", err)
+	}
+
+	defer func() {
+		if err = tx.Rollback(ctx); err != nil {
+			d.log.Warn("failed rollback transaction", "txError", err)
+		}
+	}()
+
+	if _, err = tx.Exec(ctx, deleteStmt); err != nil {
+		return fmt.Errorf("failed delete expired password resets: %w", err)
+	}
+	if _, err = tx.Exec(ctx, insertStmt, reset.Hash, reset.UserID, reset.ExpiresAt); err != nil {
+		return fmt.Errorf("failed insert password reset: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed commit tx: %w", err)
+	}
+
+	return nil
+}
+
+// ResetPassword uses the reset token to replace password of its user, revokes the user sessions like
+// RevokeUserSessions and returns the user id. Every reset token of the user becomes used.
+// ErrResetTokenInvalid is returned for unknown, expired and used tokens.
+func (d *DB) ResetPassword(ctx context.Context, hash []byte, password string, cutoff time.Time) (string, error) {
+	const (
+		selectStmt = `SELECT user_id, expires_at, used_at IS NOT NULL
+					  FROM password_resets WHERE token_hash = $1 FOR UPDATE`
+		markUsedStmt = `UPDATE password_resets SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`
+		updateStmt   = `UPDATE users SET password = $2 WHERE user_id = $1`
+	)
+
+	tx, err := d.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "read committed"})
+	if err != nil {
+		return "", fmt.Errorf("failed begin tx: %w", err)
+	}
+
+	defer func() {
+		if err = tx.Rollback(ctx); err != nil {
+			d.log.Warn("failed rollback transaction", "txError", err)
+		}
+	}()
+
+	var (
+		userID      string
+		expiresAt   time.Time
+		alreadyUsed bool
+	)
+	if err = tx.QueryRow(ctx, selectStmt, hash).Scan(&userID, &expiresAt, &alreadyUsed); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrResetTokenInvalid
+		}
+		return "", fmt.Errorf("failed select password reset: %w", err)
+	}
+	if alreadyUsed || time.Now().After(expiresAt) {
+		return "", ErrResetTokenInvalid
+	}
+
+	if _, err = tx.Exec(ctx, markUsedStmt, userID); err != nil {
+		return "", fmt.Errorf("failed mark password resets used: %w", err)
+	}
+	if _, err = tx.Exec(ctx, updateStmt, userID, password); err != nil {
+		return "", fmt.Errorf("failed update password: %w", err)
+	}
+	if err = revokeUserSessions(ctx, tx, userID, cutoff); err != nil {
+		return "", err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("failed commit tx: %w", err)
+	}
+
+	return userID, nil
+}
+
+var ErrResetTokenInvalid = errors.New("password reset token is invalid, expired or used")
@@ -13,7 +13,10 @@ import (
 	"github.com/RIBorisov/gophermart/internal/config"
 	"github.com/RIBorisov/gophermart/internal/logger"
 	"github.com/RIBorisov/gophermart/internal/models"
+	"github.com/RIBorisov/gophermart/internal/models/admin"
 	"github.com/RIBorisov/gophermart/internal/models/balance"
+	"github.com/RIBorisov/gophermart/internal/models/ledger"
+	"github.com/RIBorisov/gophermart/internal/models/money"
 	"github.com/RIBorisov/gophermart/internal/models/orders"
 	"github.com/RIBorisov/gophermart/internal/models/register"
 )
@@ -90,19 +93,21 @@ func (d *DB) SaveUser(ctx context.Context, user *register.Request) (string, erro
 }
 
 type UserRow struct {
-	ID       string `db:"user_id"`
-	Login    string `db:"login"`
-	Password string `db:"password"`
+	BlockedAt *time.Time `db:"blocked_at"`
+	ID        string     `db:"user_id"`
+	Login     string     `db:"login"`
+	Password  string     `db:"password"`
+	Role      admin.Role `db:"role"`
 }
 
 func (d *DB) GetUser(ctx context.Context, login string) (*UserRow, error) {
-	const getStmt = `SELECT user_id, login, password FROM users WHERE login = $1`
+	const getStmt = `SELECT user_id, login, password, role, blocked_at FROM users WHERE login = $1`
 	row := d.pool.QueryRow(ctx, getStmt, login)
 	var (
 		uRow UserRow
 		pass []byte
 	)
-	if err := row.Scan(&uRow.ID, &uRow.Login, &pass); err != nil {
+	if err := row.Scan(&uRow.ID, &uRow.Login, &pass, &uRow.Role, &uRow.BlockedAt); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, ErrUserNotExists
 		}
@@ -172,11 +177,11 @@ type OrderEntity struct {
 	UploadedAt time.Time     `db:"uploaded_at"`
 	OrderID    string        `db:"order_id"`
 	UserID     string        `db:"user_id"`
-	Bonus      float32       `db:"bonus"`
+	Bonus      money.Amount  `db:"bonus"`
 }
 
 func (d *DB) GetUserOrders(ctx context.Context) ([]OrderEntity, error) {
-	const stmt = `SELECT * FROM orders WHERE user_id = $1`
+	const stmt = `SELECT order_id, user_id, status, bonus, uploaded_at FROM orders WHERE user_id = $1`
 	var oList []OrderEntity
 
 	userID, err := getCtxUserID(ctx)
@@ -199,10 +204,10 @@ func (d *DB) GetUserOrders(ctx context.Context) ([]OrderEntity, error) {
 }
 
 type BalanceEntity struct {
-	UpdatedAt time.Time `db:"updated_at"`
-	UserID    string    `db:"user_id"`
-	Current   float32   `db:"current"`
-	Withdrawn float32   `db:"withdrawn"`
+	UpdatedAt time.Time    `db:"updated_at"`
+	UserID    string       `db:"user_id"`
+	Current   money.Amount `db:"current"`
+	Withdrawn money.Amount `db:"withdrawn"`
 }
 
 func (d *DB) GetBalance(ctx context.Context) (*BalanceEntity, error) {
@@ -223,9 +228,11 @@ func (d *DB) GetBalance(ctx context.Context) (*BalanceEntity, error) {
 	return &b, nil
 }
 
+// BalanceWithdraw debits the balance, records the withdrawal and its ledger transaction in one transaction.
+// The balance row is locked, so concurrent withdrawals are checked against the funds one by one.
 func (d *DB) BalanceWithdraw(ctx context.Context, req balance.WithdrawRequest) error {
 	const (
-		selectStmt = `SELECT current FROM balance WHERE user_id = $1`
+		selectStmt = `SELECT current FROM balance WHERE user_id = $1 FOR UPDATE`
 		updateStmt = `UPDATE balance 
 					  SET current = current - @sum, withdrawn = withdrawn + @sum, updated_at = NOW()
 					  WHERE user_id = @userID`
@@ -237,7 +244,7 @@ func (d *DB) BalanceWithdraw(ctx context.Context, req balance.WithdrawRequest) e
 		return err
 	}
 
-	var current float32
+	var current money.Amount
 
 	tx, err := d.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "read committed"})
 	if err != nil {
@@ -251,6 +258,9 @@ func (d *DB) BalanceWithdraw(ctx context.Context, req balance.WithdrawRequest) e
 	}()
 
 	if err = tx.QueryRow(ctx, selectStmt, userID).Scan(&current); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotExists
+		}
 		return fmt.Errorf("failed query row: %w", err)
 	}
 
@@ -265,9 +275,18 @@ func (d *DB) BalanceWithdraw(ctx context.Context, req balance.WithdrawRequest) e
 
 	_, err = tx.Exec(ctx, insertWithdrawalsStmt, pgx.NamedArgs{"userID": userID, "orderID": req.Order, "sum": req.Sum})
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return ErrWithdrawalExists
+		}
 		return fmt.Errorf("failed execute withdrawal request stmt: %w", err)
 	}
 
+	posting := &ledger.Posting{Kind: ledger.Withdrawal, UserID: userID, OrderID: req.Order, Amount: -req.Sum}
+	if err = insertPosting(ctx, tx, posting); err != nil {
+		return err
+	}
+
 	if err = tx.Commit(ctx); err != nil {
 		return fmt.Errorf("failed commit tx: %w", err)
 	}
@@ -276,10 +295,10 @@ func (d *DB) BalanceWithdraw(ctx context.Context, req balance.WithdrawRequest) e
 }
 
 type WithdrawalsEntity struct {
-	ProcessedAt time.Time `db:"processed_at"`
-	UserID      string    `db:"user_id"`
-	OrderID     string    `db:"order_id"`
-	Amount      float32   `db:"amount"`
+	ProcessedAt time.Time    `db:"processed_at"`
+	UserID      string       `db:"user_id"`
+	OrderID     string       `db:"order_id"`
+	Amount      money.Amount `db:"amount"`
 }
 
 func (d *DB) GetWithdrawals(ctx context.Context) ([]WithdrawalsEntity, error) {
@@ -307,28 +326,59 @@ func (d *DB) GetWithdrawals(ctx context.Context) ([]WithdrawalsEntity, error) {
 	return wList, nil
 }
 
-func (d *DB) GetOrdersList(ctx context.Context) ([]string, error) {
-	const stmt = `SELECT order_id FROM orders WHERE status IN ('NEW', 'PROCESSING')`
-	rows, err := d.pool.Query(ctx, stmt)
+// GetOrdersList claims up to lease.BatchSize unprocessed orders which are due for the next check
+// and not leased by anyone, so every order is processed by exactly one instance until the lease
+// expires or the order is updated.
+func (d *DB) GetOrdersList(ctx context.Context, lease *orders.Lease) ([]orders.Pending, error) {
+	const stmt = `UPDATE orders SET locked_until = NOW() + make_interval(secs => @leaseSeconds), locked_by = @owner
+				  WHERE order_id IN (
+					  SELECT order_id FROM orders
+					  WHERE status IN ('NEW', 'PROCESSING')
+						AND NOT dead_letter
+						AND next_check_at <= NOW()
+						AND (locked_until IS NULL OR locked_until < NOW())
+					  ORDER BY next_check_at
+					  LIMIT @batchSize
+					  FOR UPDATE SKIP LOCKED
+				  )
+				  RETURNING order_id, status, attempts, failures, uploaded_at::timestamptz`
+	rows, err := d.pool.Query(ctx, stmt, pgx.NamedArgs{
+		"leaseSeconds": lease.Duration.Seconds(),
+		"owner":        lease.Owner,
+		"batchSize":    lease.BatchSize,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed query rows: %w", err)
 	}
+	defer rows.Close()
 
-	oList := make([]string, 0)
+	oList := make([]orders.Pending, 0)
 	for rows.Next() {
-		var row string
-		if err = rows.Scan(&row); err != nil {
+		var row orders.Pending
+		if err = rows.Scan(&row.Number, &row.Status, &row.Attempts, &row.Failures, &row.UploadedAt); err != nil {
 			return nil, fmt.Errorf("failed scan row: %w", err)
 		}
 		oList = append(oList, row)
 	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed read claimed orders: %w", err)
+	}
 	return oList, nil
 }
 
-// UpdateOrder updates order with new status then updates user balance using transaction.
+// UpdateOrder moves order into the new status following orders.Status.CanTransitionTo, releases its lease
+// and schedules the next check. The order leased by another instance than data.Owner is left as is with
+// ErrLeaseLost. Accrual is credited to user balance only once, when order becomes PROCESSED, illegal transitions
+// (e.g. repeated PROCESSED response) are rejected with TransitionError.
 func (d *DB) UpdateOrder(ctx context.Context, data *orders.UpdateOrder) error {
 	const (
-		updOrdersStmt  = `UPDATE orders SET status = $1, bonus = $2 WHERE order_id = $3 RETURNING user_id`
+		selectStmt    = `SELECT user_id, status, COALESCE(locked_by, '') FROM orders WHERE order_id = $1 FOR UPDATE`
+		updOrdersStmt = `UPDATE orders
+						 SET status = @status, bonus = @bonus, locked_until = NULL, locked_by = NULL,
+							 attempts = attempts + 1, failures = 0, last_error = NULL,
+							 next_check_at = COALESCE(@nextCheckAt, next_check_at),
+							 stuck = stuck OR @stuck
+						 WHERE order_id = @orderID`
 		updBalanceStmt = `UPDATE balance SET current = current + $1 WHERE user_id = $2`
 	)
 
@@ -342,13 +392,50 @@ func (d *DB) UpdateOrder(ctx context.Context, data *orders.UpdateOrder) error {
 		}
 	}()
 
-	var userID string
-	if err = tx.QueryRow(ctx, updOrdersStmt, data.Status, data.Accrual, data.Number).Scan(&userID); err != nil {
+	var (
+		userID   string
+		status   orders.Status
+		lockedBy string
+	)
+	if err = tx.QueryRow(ctx, selectStmt, data.Number).Scan(&userID, &status, &lockedBy); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrOrderNotExists
+		}
+		return fmt.Errorf("failed select order: %w", err)
+	}
+	if data.Owner != "" && lockedBy != data.Owner {
+		return ErrLeaseLost
+	}
+
+	credit, err := checkTransition(status, data)
+	if err != nil {
+		return err
+	}
+
+	var nextCheckAt *time.Time
+	if !data.NextCheckAt.IsZero() {
+		nextCheckAt = &data.NextCheckAt
+	}
+	_, err = tx.Exec(ctx, updOrdersStmt, pgx.NamedArgs{
+		"status":      data.Status,
+		"bonus":       credit,
+		"nextCheckAt": nextCheckAt,
+		"stuck":       data.Stuck,
+		"orderID":     data.Number,
+	})
+	if err != nil {
 		return fmt.Errorf("failed execute order stmt: %w", err)
 	}
 
-	if _, err = tx.Exec(ctx, updBalanceStmt, data.Accrual, userID); err != nil {
-		return fmt.Errorf("failed execute balance stmt: %w", err)
+	if credit != 0 {
+		if _, err = tx.Exec(ctx, updBalanceStmt, credit, userID); err != nil {
+			return fmt.Errorf("failed execute balance stmt: %w", err)
+		}
+
+		posting := &ledger.Posting{Kind: ledger.Accrual, UserID: userID, OrderID: data.Number, Amount: credit}
+		if err = insertPosting(ctx, tx, posting); err != nil {
+			return err
+		}
 	}
 
 	if err = tx.Commit(ctx); err != nil {
@@ -358,10 +445,164 @@ func (d *DB) UpdateOrder(ctx context.Context, data *orders.UpdateOrder) error {
 	return nil
 }
 
+// FailOrder records failed processing of the order and releases its lease, so the order is claimed
+// again at data.NextCheckAt unless it is moved to the dead-letter state. The order leased by another
+// instance than data.Owner is left as is with ErrLeaseLost.
+func (d *DB) FailOrder(ctx context.Context, data *orders.Failure) error {
+	const stmt = `UPDATE orders
+				  SET failures = failures + 1, last_error = @error, dead_letter = @deadLetter,
+					  next_check_at = @nextCheckAt, locked_until = NULL, locked_by = NULL
+				  WHERE order_id = @orderID AND (@owner = '' OR locked_by = @owner)`
+
+	tag, err := d.pool.Exec(ctx, stmt, pgx.NamedArgs{
+		"error":       data.Error,
+		"deadLetter":  data.DeadLetter,
+		"nextCheckAt": data.NextCheckAt,
+		"orderID":     data.Number,
+		"owner":       data.Owner,
+	})
+	if err != nil {
+		return fmt.Errorf("failed execute order stmt: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		if data.Owner != "" {
+			return ErrLeaseLost
+		}
+		return ErrOrderNotExists
+	}
+
+	return nil
+}
+
+// checkTransition validates status transition of the order and returns accrual to be credited.
+func checkTransition(current orders.Status, data *orders.UpdateOrder) (money.Amount, error) {
+	if !current.CanTransitionTo(data.Status) {
+		return 0, &TransitionError{Number: data.Number, From: current, To: data.Status}
+	}
+	if data.Status != orders.Processed {
+		return 0, nil
+	}
+
+	return data.Accrual, nil
+}
+
+// insertPosting records posting as a ledger transaction: the entry on the user account
+// and the opposite entry on the system account.
+func insertPosting(ctx context.Context, tx pgx.Tx, p *ledger.Posting) error {
+	const stmt = `WITH t AS (SELECT nextval('ledger_transaction_seq') AS id)
+				  INSERT INTO ledger (transaction_id, account, user_id, kind, amount, order_id)
+				  SELECT t.id, @userAccount, @userID::uuid, @kind, @amount, NULLIF(@orderID, '') FROM t
+				  UNION ALL
+				  SELECT t.id, @counterAccount, NULL, @kind, @counterAmount, NULLIF(@orderID, '') FROM t`
+
+	_, err := tx.Exec(ctx, stmt, pgx.NamedArgs{
+		"userAccount":    ledger.UserAccount,
+		"userID":         p.UserID,
+		"kind":           p.Kind,
+		"amount":         p.Amount,
+		"orderID":        p.OrderID,
+		"counterAccount": p.Kind.CounterAccount(),
+		"counterAmount":  -p.Amount,
+	})
+	if err != nil {
+		return fmt.Errorf("failed insert ledger entries: %w", err)
+	}
+
+	return nil
+}
+
+type LedgerEntity struct {
+	CreatedAt time.Time    `db:"created_at"`
+	Kind      ledger.Kind  `db:"kind"`
+	OrderID   string       `db:"order_id"`
+	ID        int64        `db:"entry_id"`
+	Amount    money.Amount `db:"amount"`
+}
+
+// GetLedger returns entries of the user account.
+func (d *DB) GetLedger(ctx context.Context) ([]LedgerEntity, error) {
+	const stmt = `SELECT entry_id, kind, amount, COALESCE(order_id, ''), created_at::timestamptz
+				  FROM ledger WHERE account = $1 AND user_id = $2 ORDER BY entry_id`
+
+	userID, err := getCtxUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := d.pool.Query(ctx, stmt, ledger.UserAccount, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed query ledger: %w", err)
+	}
+	defer rows.Close()
+
+	var eList []LedgerEntity
+	for rows.Next() {
+		var e LedgerEntity
+		if err = rows.Scan(&e.ID, &e.Kind, &e.Amount, &e.OrderID, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed scan ledger row: %w", err)
+		}
+		eList = append(eList, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed read ledger: %w", err)
+	}
+
+	return eList, nil
+}
+
+// LedgerMismatch is the user whose stored balance differs from the sum of the ledger entries of the user account.
+type LedgerMismatch struct {
+	UserID  string
+	Balance money.Amount
+	Ledger  money.Amount
+}
+
+// ReconcileLedger returns every user whose balance doesn't reconcile with the ledger.
+func (d *DB) ReconcileLedger(ctx context.Context) ([]LedgerMismatch, error) {
+	const stmt = `SELECT b.user_id, b.current, COALESCE(l.total, 0)
+				  FROM balance b
+				  LEFT JOIN (SELECT user_id, SUM(amount) AS total FROM ledger WHERE account = $1 GROUP BY user_id) l
+					  ON l.user_id = b.user_id
+				  WHERE b.current <> COALESCE(l.total, 0)`
+
+	rows, err := d.pool.Query(ctx, stmt, ledger.UserAccount)
+	if err != nil {
+		return nil, fmt.Errorf("failed query ledger reconciliation: %w", err)
+	}
+	defer rows.Close()
+
+	var mList []LedgerMismatch
+	for rows.Next() {
+		var m LedgerMismatch
+		if err = rows.Scan(&m.UserID, &m.Balance, &m.Ledger); err != nil {
+			return nil, fmt.Errorf("failed scan ledger reconciliation row: %w", err)
+		}
+		mList = append(mList, m)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed read ledger reconciliation: %w", err)
+	}
+
+	return mList, nil
+}
+
 var (
 	ErrInsufficientFunds       = errors.New("insufficient funds")
 	ErrOrderCreatedAlready     = errors.New("order number already created by this user")
 	ErrUserExists              = errors.New("user already exists")
 	ErrUserNotExists           = errors.New("user not exists")
+	ErrOrderNotExists          = errors.New("order not exists")
 	ErrAnotherUserOrderCreated = errors.New("order number already created by another user")
+	ErrWithdrawalExists        = errors.New("withdrawal for this order number already exists")
+	ErrLeaseLost               = errors.New("order lease has passed to another instance")
 )
+
+// TransitionError is returned when order status can't be changed, e.g. the order is already PROCESSED.
+type TransitionError struct {
+	Number string
+	From   orders.Status
+	To     orders.Status
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("illegal order '%s' status transition: %s -> %s", e.Number, e.From, e.To)
+}
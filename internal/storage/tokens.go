@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RefreshToken is the server side state of the refresh token, only hash of the token is stored.
+// Tokens issued one from another by rotation form a family, which is revoked as a whole
+// once an already used token is presented again.
+type RefreshToken struct {
+	ExpiresAt time.Time
+	UserID    string
+	FamilyID  string
+	Hash      []byte
+}
+
+// SaveRefreshToken saves the first token of a new family and fills its FamilyID.
+func (d *DB) SaveRefreshToken(ctx context.Context, token *RefreshToken) error {
+	const insertStmt = `INSERT INTO refresh_tokens (token_hash, family_id, user_id, expires_at)
+						VALUES ($1, gen_random_uuid(), $2, $3)
+						RETURNING family_id`
+
+	if err := d.pool.QueryRow(ctx, insertStmt, token.Hash, token.UserID, token.ExpiresAt).
+		Scan(&token.FamilyID); err != nil {
+		return fmt.Errorf("failed insert refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// RotateRefreshToken marks the used token and saves the next one into the same family, filling its
+// UserID and FamilyID. ErrRefreshTokenInvalid is returned for unknown, expired and revoked tokens.
+// When the token has been used already the whole family is revoked and ErrRefreshTokenReused is returned.
+func (d *DB) RotateRefreshToken(ctx context.Context, used []byte, next *RefreshToken) error {
+	const (
+		selectStmt = `SELECT family_id, user_id, expires_at, used_at IS NOT NULL, revoked_at IS NOT NULL
+					  FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE`
+		revokeFamilyStmt = `UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`
+		markUsedStmt     = `UPDATE refresh_tokens SET used_at = NOW() WHERE token_hash = $1`
+		insertStmt       = `INSERT INTO refresh_tokens (token_hash, family_id, user_id, expires_at)
+							VALUES ($1, $2, $3, $4)`
+	)
+
+	tx, err := d.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "read committed"})
+	if err != nil {
+		return fmt.Errorf("failed begin tx: %w", err)
+	}
+
+	defer func() {
+		if err = tx.Rollback(ctx); err != nil {
+			d.log.Warn("failed rollback transaction", "txError", err)
+		}
+	}()
+
+	var (
+		expiresAt      time.Time
+		alreadyUsed    bool
+		alreadyRevoked bool
+	)
+	err = tx.QueryRow(ctx, selectStmt, used).Scan(&next.FamilyID, &next.UserID, &expiresAt, &alreadyUsed, &alreadyRevoked)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrRefreshTokenInvalid
+		}
+		return fmt.Errorf("failed select refresh token: %w", err)
+	}
+
+	switch {
+	case alreadyRevoked:
+		return ErrRefreshTokenInvalid
+	case alreadyUsed:
+		if _, err = tx.Exec(ctx, revokeFamilyStmt, next.FamilyID); err != nil {
+			return fmt.Errorf("failed revoke refresh token family: %w", err)
+		}
+		if err = tx.Commit(ctx); err != nil {
+			return fmt.Errorf("failed commit tx: %w", err)
+		}
+		return ErrRefreshTokenReused
+	case time.Now().After(expiresAt):
+		return ErrRefreshTokenInvalid
+	}
+
+	if _, err = tx.Exec(ctx, markUsedStmt, used); err != nil {
+		return fmt.Errorf("failed mark refresh token used: %w", err)
+	}
+	if _, err = tx.Exec(ctx, insertStmt, next.Hash, next.FamilyID, next.UserID, next.ExpiresAt); err != nil {
+		return fmt.Errorf("failed insert refresh token: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed commit tx: %w", err)
+	}
+
+	return nil
+}
+
+// TokenState is what is known about the access token on the server side.
+type TokenState struct {
+	// ValidAfter is the cutoff of the user, tokens issued before it are rejected. Zero when not set.
+	ValidAfter time.Time
+	// Revoked is true when either the token or its session (refresh token family) has been revoked.
+	Revoked bool
+}
+
+func (d *DB) GetTokenState(ctx context.Context, jti, userID, sessionID string) (*TokenState, error) {
+	const selectStmt = `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)
+							OR EXISTS (SELECT 1 FROM refresh_tokens WHERE family_id::text = $3 AND revoked_at IS NOT NULL),
+						  (SELECT tokens_valid_after FROM users WHERE user_id = $2)`
+
+	var (
+		state      TokenState
+		validAfter *time.Time
+	)
+	if err := d.pool.QueryRow(ctx, selectStmt, jti, userID, sessionID).Scan(&state.Revoked, &validAfter); err != nil {
+		return nil, fmt.Errorf("failed select token state: %w", err)
+	}
+	if validAfter != nil {
+		state.ValidAfter = *validAfter
+	}
+
+	return &state, nil
+}
+
+// RevokeSession revokes the access token until it expires together with the refresh token family
+// of the session. Revoked tokens which have expired already are cleaned up.
+func (d *DB) RevokeSession(ctx context.Context, jti string, expiresAt time.Time, familyID string) error {
+	const (
+		cleanupStmt = `DELETE FROM revoked_tokens WHERE expires_at < NOW()`
+		revokeStmt  = `INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING`
+		familyStmt  = `UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`
+	)
+
+	tx, err := d.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "read committed"})
+	if err != nil {
+		return fmt.Errorf("failed begin tx: %w", err)
+	}
+
+	defer func() {
+		if err = tx.Rollback(ctx); err != nil {
+			d.log.Warn("failed rollback transaction", "txError", err)
+		}
+	}()
+
+	if _, err = tx.Exec(ctx, cleanupStmt); err != nil {
+		return fmt.Errorf("failed clean up revoked tokens: %w", err)
+	}
+	if _, err = tx.Exec(ctx, revokeStmt, jti, expiresAt); err != nil {
+		return fmt.Errorf("failed revoke token: %w", err)
+	}
+	if familyID != "" {
+		if _, err = tx.Exec(ctx, familyStmt, familyID); err != nil {
+			return fmt.Errorf("failed revoke refresh token family: %w", err)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed commit tx: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeUserSessions rejects access tokens of the user issued before the cutoff and revokes
+// all of the user refresh tokens.
+func (d *DB) RevokeUserSessions(ctx context.Context, userID string, cutoff time.Time) error {
+	tx, err := d.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "read committed"})
+	if err != nil {
+		return fmt.Errorf("failed begin tx: %w", err)
+	}
+
+	defer func() {
+		if err = tx.Rollback(ctx); err != nil {
+			d.log.Warn("failed rollback transaction", "txError", err)
+		}
+	}()
+
+	if err = revokeUserSessions(ctx, tx, userID, cutoff); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed commit tx: %w", err)
+	}
+
+	return nil
+}
+
+// revokeUserSessions sets the cutoff of the user access tokens and revokes the user refresh tokens in tx.
+func revokeUserSessions(ctx context.Context, tx pgx.Tx, userID string, cutoff time.Time) error {
+	const (
+		cutoffStmt  = `UPDATE users SET tokens_valid_after = $2 WHERE user_id = $1`
+		refreshStmt = `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	)
+
+	tag, err := tx.Exec(ctx, cutoffStmt, userID, cutoff)
+	if err != nil {
+		return fmt.Errorf("failed update tokens cutoff: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotExists
+	}
+	if _, err = tx.Exec(ctx, refreshStmt, userID); err != nil {
+		return fmt.Errorf("failed revoke refresh tokens: %w", err)
+	}
+
+	return nil
+}
+
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+	ErrRefreshTokenReused  = errors.New("refresh token has been used already, token family is revoked")
+)
@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// TwoFactor is the TOTP state of the user. Secret is set but not Enabled while the enrollment
+// waits for the first code.
+type TwoFactor struct {
+	Secret []byte
+	// LastStep is the TOTP time step of the last accepted code, codes of it and earlier steps are rejected.
+	LastStep int64
+	Enabled  bool
+}
+
+func (d *DB) GetTwoFactor(ctx context.Context, userID string) (*TwoFactor, error) {
+	const selectStmt = `SELECT totp_secret, totp_enabled, totp_last_step FROM users WHERE user_id = $1`
+
+	var tf TwoFactor
+	if err := d.pool.QueryRow(ctx, selectStmt, userID).Scan(&tf.Secret, &tf.Enabled, &tf.LastStep); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotExists
+		}
+		return nil, fmt.Errorf("failed select two-factor state: %w", err)
+	}
+
+	return &tf, nil
+}
+
+// SaveTOTPSecret starts the enrollment replacing the pending secret if any.
+// ErrTwoFactorEnabled is returned when the enrollment is confirmed already.
+func (d *DB) SaveTOTPSecret(ctx context.Context, userID string, secret []byte) error {
+	const updateStmt = `UPDATE users SET totp_secret = $2, totp_last_step = 0 WHERE user_id = $1 AND NOT totp_enabled`
+
+	tag, err := d.pool.Exec(ctx, updateStmt, userID, secret)
+	if err != nil {
+		return fmt.Errorf("failed save totp secret: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return d.twoFactorUnchanged(ctx, userID)
+	}
+
+	return nil
+}
+
+// EnableTwoFactor confirms the enrollment by the code of the time step and replaces recovery codes.
+func (d *DB) EnableTwoFactor(ctx context.Context, userID string, step int64, recoveryCodes [][]byte) error {
+	const (
+		enableStmt = `UPDATE users SET totp_enabled = TRUE, totp_last_step = $2
+					  WHERE user_id = $1 AND NOT totp_enabled AND totp_secret IS NOT NULL`
+		deleteCodesStmt = `DELETE FROM recovery_codes WHERE user_id = $1`
+		insertCodeStmt  = `INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`
+	)
+
+	tx, err := d.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "read committed"})
+	if err != nil {
+		return fmt.Errorf("failed begin tx: %w", err)
+	}
+
+	defer func() {
+		if err = tx.Rollback(ctx); err != nil {
+			d.log.Warn("failed rollback transaction", "txError", err)
+		}
+	}()
+
+	tag, err := tx.Exec(ctx, enableStmt, userID, step)
+	if err != nil {
+		return fmt.Errorf("failed enable two-factor: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTwoFactorEnabled
+	}
+	if _, err = tx.Exec(ctx, deleteCodesStmt, userID); err != nil {
+		return fmt.Errorf("failed delete recovery codes: %w", err)
+	}
+	for _, code := range recoveryCodes {
+		if _, err = tx.Exec(ctx, insertCodeStmt, userID, code); err != nil {
+			return fmt.Errorf("failed insert recovery code: %w", err)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed commit tx: %w", err)
+	}
+
+	return nil
+}
+
+// UseTOTPStep accepts the code of the time step once, ErrTOTPStepUsed is returned for the same
+// or an earlier step.
+func (d *DB) UseTOTPStep(ctx context.Context, userID string, step int64) error {
+	const updateStmt = `UPDATE users SET totp_last_step = $2
+						WHERE user_id = $1 AND totp_enabled AND totp_last_step < $2`
+
+	tag, err := d.pool.Exec(ctx, updateStmt, userID, step)
+	if err != nil {
+		return fmt.Errorf("failed update totp step: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTOTPStepUsed
+	}
+
+	return nil
+}
+
+func (d *DB) UseRecoveryCode(ctx context.Context, userID string, hash []byte) error {
+	const updateStmt = `UPDATE recovery_codes SET used_at = NOW()
+						WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+
+	tag, err := d.pool.Exec(ctx, updateStmt, userID, hash)
+	if err != nil {
+		return fmt.Errorf("failed use recovery code: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrRecoveryCodeInvalid
+	}
+
+	return nil
+}
+
+// DisableTwoFactor forgets the secret and the recovery codes.
+func (d *DB) DisableTwoFactor(ctx context.Context, userID string) error {
+	const (
+		disableStmt     = `UPDATE users SET totp_secret = NULL, totp_enabled = FALSE, totp_last_step = 0 WHERE user_id = $1`
+		deleteCodesStmt = `DELETE FROM recovery_codes WHERE user_id = $1`
+	)
+
+	tx, err := d.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: "read committed"})
+	if err != nil {
+		return fmt.Errorf("failed begin tx: %w", err)
+	}
+
+	defer func() {
+		if err = tx.Rollback(ctx); err != nil {
+			d.log.Warn("failed rollback transaction", "txError", err)
+		}
+	}()
+
+	tag, err := tx.Exec(ctx, disableStmt, userID)
+	if err != nil {
+		return fmt.Errorf("failed disable two-factor: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotExists
+	}
+	if _, err = tx.Exec(ctx, deleteCodesStmt, userID); err != nil {
+		return fmt.Errorf("failed delete recovery codes: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed commit tx: %w", err)
+	}
+
+	return nil
+}
+
+// twoFactorUnchanged tells why the update has matched no user.
+func (d *DB) twoFactorUnchanged(ctx context.Context, userID string) error {
+	tf, err := d.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if tf.Enabled {
+		return ErrTwoFactorEnabled
+	}
+
+	return fmt.Errorf("two-factor state of user %s hasn't changed", userID)
+}
+
+var (
+	ErrTwoFactorEnabled    = errors.New("two-factor authentication is enabled already")
+	ErrTOTPStepUsed        = errors.New("totp code of this time step has been used already")
+	ErrRecoveryCodeInvalid = errors.New("recovery code is invalid or used")
+)
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/RIBorisov/gophermart/internal/models/admin"
+)
+
+// likeEscaper escapes LIKE wildcards, so the prefix is matched as is.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchUsers returns at most limit users with logins starting with the prefix ordered by login,
+// password hashes aren't selected.
+func (d *DB) SearchUsers(ctx context.Context, loginPrefix string, limit int) ([]UserRow, error) {
+	const selectStmt = `SELECT user_id, login, role, blocked_at FROM users
+						WHERE login LIKE $1 ESCAPE '\' ORDER BY login LIMIT $2`
+
+	rows, err := d.pool.Query(ctx, selectStmt, likeEscaper.Replace(loginPrefix)+"%", limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed select users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []UserRow
+	for rows.Next() {
+		var u UserRow
+		if err = rows.Scan(&u.ID, &u.Login, &u.Role, &u.BlockedAt); err != nil {
+			return nil, fmt.Errorf("failed scan user: %w", err)
+		}
+		users = append(users, u)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed iterate users: %w", err)
+	}
+
+	return users, nil
+}
+
+// CountPasswordHashesWithoutPrefix returns the number of users whose password hash starts with none of the prefixes.
+func (d *DB) CountPasswordHashesWithoutPrefix(ctx context.Context, prefixes []string) (int, error) {
+	const selectStmt = `SELECT COUNT(*) FROM users WHERE NOT (password ^@ ANY($1))`
+
+	var count int
+	if err := d.pool.QueryRow(ctx, selectStmt, prefixes).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed count password hashes: %w", err)
+	}
+
+	return count, nil
+}
+
+func (d *DB) SetUserRole(ctx context.Context, userID string, role admin.Role) error {
+	const updateStmt = `UPDATE users SET role = $2 WHERE user_id = $1`
+
+	tag, err := d.pool.Exec(ctx, updateStmt, userID, role)
+	if malformedID(err) {
+		return ErrUserNotExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed update role: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotExists
+	}
+
+	return nil
+}
+
+// SetUserBlocked blocks the user keeping the time it has been blocked first or unblocks the user.
+func (d *DB) SetUserBlocked(ctx context.Context, userID string, blocked bool) error {
+	const updateStmt = `UPDATE users SET blocked_at = CASE WHEN $2 THEN COALESCE(blocked_at, NOW()) END
+						WHERE user_id = $1`
+
+	tag, err := d.pool.Exec(ctx, updateStmt, userID, blocked)
+	if malformedID(err) {
+		return ErrUserNotExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed update blocked state: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotExists
+	}
+
+	return nil
+}
+
+// malformedID reports whether the user id isn't a UUID, no user has such an id.
+func malformedID(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgerrcode.InvalidTextRepresentation
+}